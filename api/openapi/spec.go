@@ -0,0 +1,90 @@
+// Package openapi holds the OpenAPI 3 descriptions of the /cash/v1 API and of
+// the /admin/v1 API. The Go client in pkg/cashapi is generated from the first.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BasePath is the server url of the spec, its paths are relative to it.
+const BasePath = "/cash/v1"
+
+// AdminBasePath is the server url of the admin spec.
+const AdminBasePath = "/admin/v1"
+
+//go:embed openapi.json
+var Spec []byte
+
+//go:embed admin.json
+var AdminSpec []byte
+
+var ginParam = regexp.MustCompile(`:([^/]+)`)
+
+// CheckRoutes compares the routes of the router under BasePath and
+// AdminBasePath with their specs and describes every route missing from
+// either. Routes in ignore, given as "METHOD /path", are not checked.
+func CheckRoutes(routes gin.RoutesInfo, ignore ...string) ([]string, error) {
+	var problems []string
+	for _, api := range []struct {
+		basePath string
+		spec     []byte
+	}{{BasePath, Spec}, {AdminBasePath, AdminSpec}} {
+		apiProblems, err := checkSpec(api.spec, api.basePath, routes, ignore)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, apiProblems...)
+	}
+	sort.Strings(problems)
+
+	return problems, nil
+}
+
+// checkSpec compares the routes under basePath with the paths of spec.
+func checkSpec(spec []byte, basePath string, routes gin.RoutesInfo, ignore []string) ([]string, error) {
+	var parsed struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &parsed); err != nil {
+		return nil, err
+	}
+
+	documented := map[string]bool{}
+	for path, operations := range parsed.Paths {
+		for method := range operations {
+			documented[strings.ToUpper(method)+" "+basePath+path] = true
+		}
+	}
+
+	served := map[string]bool{}
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, basePath+"/") {
+			continue
+		}
+		served[route.Method+" "+ginParam.ReplaceAllString(route.Path, "{$1}")] = true
+	}
+
+	for _, route := range ignore {
+		delete(served, route)
+	}
+
+	var problems []string
+	for route := range served {
+		if !documented[route] {
+			problems = append(problems, fmt.Sprintf("%s is served but not documented", route))
+		}
+	}
+	for route := range documented {
+		if !served[route] {
+			problems = append(problems, fmt.Sprintf("%s is documented but not served", route))
+		}
+	}
+
+	return problems, nil
+}
@@ -8,11 +8,523 @@ CREATE TABLE IF NOT EXISTS users (
 CREATE TABLE IF NOT EXISTS  transactions (
     user_uuid UUID,
     trx_uuid UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    trx_date date NOT NULL DEFAULT current_date,
-    u_timestamp integer DEFAULT extract(epoch from now()),
-    trx_time time with time zone NOT NULL DEFAULT current_time,
+    created_at timestamptz NOT NULL DEFAULT clock_timestamp(),
     who text,
     description text,
     amount real,
     currency text
 );
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier text NOT NULL DEFAULT 'default';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS operation text NOT NULL DEFAULT 'update';
+
+-- NULL limit means unlimited, user rows override the user's tier field by field
+CREATE TABLE IF NOT EXISTS spending_limits (
+    subject_type text NOT NULL CHECK (subject_type IN ('user', 'tier')),
+    subject text NOT NULL,
+    max_single real,
+    daily_total real,
+    monthly_total real,
+    hourly_count integer,
+    PRIMARY KEY (subject_type, subject)
+);
+
+-- tier '*' applies to every tier without its own row
+CREATE TABLE IF NOT EXISTS fee_schedule (
+    operation text NOT NULL CHECK (operation IN ('transfer', 'credit', 'debit')),
+    currency text NOT NULL,
+    tier text NOT NULL DEFAULT '*',
+    percent real NOT NULL DEFAULT 0,
+    fixed real NOT NULL DEFAULT 0,
+    max_fee real,
+    PRIMARY KEY (operation, currency, tier)
+);
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id bigserial PRIMARY KEY,
+    event_type text NOT NULL,
+    event_key text NOT NULL,
+    payload jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    published_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (id) WHERE published_at IS NULL;
+
+-- balance changes are announced to the streaming API of every replica, the
+-- payload only names the event so it stays under the NOTIFY size limit
+CREATE OR REPLACE FUNCTION outbox_notify_balance() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('balance_changed', json_build_object('id', NEW.id, 'key', NEW.event_key)::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS outbox_balance_notify ON outbox;
+CREATE TRIGGER outbox_balance_notify AFTER INSERT ON outbox
+    FOR EACH ROW WHEN (NEW.event_type = 'balance.changed') EXECUTE FUNCTION outbox_notify_balance();
+
+-- empty event_types means every event type
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    client_id text NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types text[] NOT NULL DEFAULT '{}',
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    subscription_id UUID NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id bigint NOT NULL,
+    event_type text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    last_status_code integer,
+    last_error text,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    delivered_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, id);
+
+-- a subscription only receives events of these accounts, of every account
+-- when empty
+ALTER TABLE webhook_subscriptions ADD COLUMN IF NOT EXISTS accounts text[] NOT NULL DEFAULT '{}';
+
+-- a dispatcher holds the deliveries it sends until locked_until, another one
+-- takes them over when it passed
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS locked_until timestamptz;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'frozen', 'closed'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now();
+
+CREATE TABLE IF NOT EXISTS manual_adjustments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_uuid UUID NOT NULL,
+    amount real NOT NULL,
+    currency text NOT NULL,
+    reason text NOT NULL,
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'posted', 'failed')),
+    proposed_by text NOT NULL,
+    reviewed_by text,
+    transaction_id UUID,
+    error text,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    reviewed_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id bigserial PRIMARY KEY,
+    adjustment_id UUID NOT NULL REFERENCES manual_adjustments (id),
+    action text NOT NULL,
+    actor text NOT NULL,
+    details text,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- append-only hash chain of balance mutations, hash = sha256(prev_hash|seq|entity|entity_id|payload)
+CREATE TABLE IF NOT EXISTS audit_chain (
+    seq bigint PRIMARY KEY,
+    entity text NOT NULL,
+    entity_id text NOT NULL,
+    payload text NOT NULL,
+    prev_hash text NOT NULL,
+    hash text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- links wait in audit_pending until the sequencer chains them, so writers
+-- never wait for each other to append
+CREATE TABLE IF NOT EXISTS audit_pending (
+    id bigserial PRIMARY KEY,
+    entity text NOT NULL,
+    entity_id text NOT NULL,
+    payload text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE OR REPLACE FUNCTION audit_chain_append(p_entity text, p_entity_id text, p_payload text) RETURNS void AS $$
+BEGIN
+    INSERT INTO audit_pending (entity, entity_id, payload) VALUES (p_entity, p_entity_id, p_payload);
+END;
+$$ LANGUAGE plpgsql;
+
+-- audit_sequencer owns audit_pending and the sequencer, it is the only role
+-- that deletes pending links
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'audit_sequencer') THEN
+        CREATE ROLE audit_sequencer NOLOGIN;
+    END IF;
+END
+$$;
+
+-- audit_chain_sequence chains up to p_limit committed pending links, in the
+-- order they were written, and returns how many it chained. Links of
+-- transactions still running are not visible, they are chained by a later
+-- call once committed. It runs as audit_sequencer whoever calls it.
+CREATE OR REPLACE FUNCTION audit_chain_sequence(p_limit integer) RETURNS integer
+SECURITY DEFINER SET search_path = public, pg_temp AS $$
+DECLARE
+    last_seq bigint;
+    last_hash text;
+    link record;
+    chained integer := 0;
+BEGIN
+    -- one sequencer at a time, writers never take this lock
+    PERFORM pg_advisory_xact_lock(hashtext('audit_chain'));
+
+    SELECT seq, hash INTO last_seq, last_hash FROM audit_chain ORDER BY seq DESC LIMIT 1;
+    IF last_seq IS NULL THEN
+        last_seq := 0;
+        last_hash := repeat('0', 64);
+    END IF;
+
+    FOR link IN
+        WITH moved AS (
+            DELETE FROM audit_pending WHERE id IN (SELECT id FROM audit_pending ORDER BY id LIMIT p_limit)
+            RETURNING *
+        )
+        SELECT * FROM moved ORDER BY id
+    LOOP
+        last_seq := last_seq + 1;
+        INSERT INTO audit_chain (seq, entity, entity_id, payload, prev_hash, hash, created_at)
+        VALUES (last_seq, link.entity, link.entity_id, link.payload, last_hash,
+                encode(sha256(convert_to(last_hash || '|' || last_seq || '|' || link.entity || '|' ||
+                                         link.entity_id || '|' || link.payload, 'UTF8')), 'hex'),
+                link.created_at)
+        RETURNING hash INTO last_hash;
+        chained := chained + 1;
+    END LOOP;
+
+    RETURN chained;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION audit_transaction_insert() RETURNS trigger AS $$
+BEGIN
+    PERFORM audit_chain_append('transaction', NEW.trx_uuid::text, row_to_json(NEW)::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- the balance links of a users row hold the balance of the row alone, for a
+-- hot account its shards are chained on their own
+CREATE OR REPLACE FUNCTION audit_balance_change() RETURNS trigger AS $$
+DECLARE
+    old_balance real;
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        old_balance := OLD.balance;
+    END IF;
+
+    IF TG_OP = 'INSERT' OR OLD.balance IS DISTINCT FROM NEW.balance THEN
+        PERFORM audit_chain_append('balance', NEW.uuid::text,
+            json_build_object('uuid', NEW.uuid, 'old', old_balance, 'new', NEW.balance)::text);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION audit_chain_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_chain is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS transactions_audit ON transactions;
+CREATE TRIGGER transactions_audit AFTER INSERT ON transactions
+    FOR EACH ROW EXECUTE FUNCTION audit_transaction_insert();
+
+DROP TRIGGER IF EXISTS users_balance_audit ON users;
+CREATE TRIGGER users_balance_audit AFTER INSERT OR UPDATE OF balance ON users
+    FOR EACH ROW EXECUTE FUNCTION audit_balance_change();
+
+DROP TRIGGER IF EXISTS audit_chain_append_only ON audit_chain;
+CREATE TRIGGER audit_chain_append_only BEFORE UPDATE OR DELETE ON audit_chain
+    FOR EACH ROW EXECUTE FUNCTION audit_chain_immutable();
+
+-- pending links are never updated and only ever deleted by the sequencer
+CREATE OR REPLACE FUNCTION audit_pending_immutable() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND current_user = 'audit_sequencer' THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'audit_pending links are only removed by audit_chain_sequence';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_pending_append_only ON audit_pending;
+CREATE TRIGGER audit_pending_append_only BEFORE UPDATE OR DELETE ON audit_pending
+    FOR EACH ROW EXECUTE FUNCTION audit_pending_immutable();
+
+DROP TRIGGER IF EXISTS audit_pending_no_truncate ON audit_pending;
+CREATE TRIGGER audit_pending_no_truncate BEFORE TRUNCATE ON audit_pending
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_pending_immutable();
+
+-- the application user only appends pending links, the sequencer moves them
+-- to audit_chain
+ALTER TABLE audit_pending OWNER TO audit_sequencer;
+ALTER FUNCTION audit_chain_sequence(integer) OWNER TO audit_sequencer;
+REVOKE ALL ON audit_pending FROM PUBLIC;
+REVOKE UPDATE, DELETE, TRUNCATE ON audit_pending FROM CURRENT_USER;
+GRANT SELECT, INSERT ON audit_pending TO CURRENT_USER;
+GRANT USAGE ON SEQUENCE audit_pending_id_seq TO CURRENT_USER;
+GRANT SELECT, INSERT ON audit_chain TO audit_sequencer;
+
+-- balance_snapshots hold the ledger balance up to taken_at, point-in-time
+-- queries add the transactions made after the closest snapshot
+CREATE TABLE IF NOT EXISTS balance_snapshots (
+    user_uuid UUID NOT NULL,
+    taken_at timestamptz NOT NULL,
+    balance double precision NOT NULL,
+    PRIMARY KEY (user_uuid, taken_at)
+);
+
+-- created_at replaces trx_date, trx_time and u_timestamp, it is backfilled
+-- from them before they are dropped
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS created_at timestamptz;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'transactions' AND column_name = 'trx_date') THEN
+        UPDATE transactions
+        SET created_at = COALESCE(trx_date + trx_time, to_timestamp(u_timestamp), trx_date::timestamptz)
+        WHERE created_at IS NULL;
+
+        ALTER TABLE transactions DROP COLUMN trx_date, DROP COLUMN trx_time, DROP COLUMN u_timestamp;
+    END IF;
+END $$;
+
+ALTER TABLE transactions ALTER COLUMN created_at SET DEFAULT clock_timestamp();
+ALTER TABLE transactions ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS transactions_user_created_at ON transactions (user_uuid, created_at);
+
+-- payout jobs credit the rows of an uploaded file, a row is marked in the
+-- database transaction that applies it so workers resume where they stopped
+CREATE TABLE IF NOT EXISTS payout_jobs (
+    id bigserial PRIMARY KEY,
+    client text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS payout_job_rows (
+    job_id bigint NOT NULL REFERENCES payout_jobs (id),
+    row_no integer NOT NULL,
+    user_uuid UUID NOT NULL,
+    amount real NOT NULL,
+    description text NOT NULL DEFAULT '',
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'applied', 'failed')),
+    error text,
+    trx_uuid UUID,
+    processed_at timestamptz,
+    PRIMARY KEY (job_id, row_no)
+);
+
+CREATE INDEX IF NOT EXISTS payout_job_rows_pending ON payout_job_rows (job_id, row_no) WHERE status = 'pending';
+
+-- a schedule runs at occurrence_at, or at next_run_at while an occurrence is
+-- retried, running_since marks the occurrence the worker is executing
+CREATE TABLE IF NOT EXISTS scheduled_transfers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    client text NOT NULL,
+    kind text NOT NULL CHECK (kind IN ('transfer', 'update')),
+    user_uuid UUID NOT NULL,
+    to_uuid UUID,
+    amount real NOT NULL,
+    description text NOT NULL DEFAULT '',
+    recurrence text NOT NULL CHECK (recurrence IN ('once', 'daily', 'weekly', 'monthly')),
+    day_of_month integer CHECK (day_of_month BETWEEN 1 AND 31),
+    max_retries integer NOT NULL DEFAULT 0,
+    retry_interval integer NOT NULL DEFAULT 3600,
+    status text NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused', 'completed', 'failed', 'cancelled')),
+    attempt integer NOT NULL DEFAULT 0,
+    occurrence_at timestamptz NOT NULL,
+    next_run_at timestamptz,
+    running_since timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_transfers_due ON scheduled_transfers (next_run_at) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS scheduled_transfer_runs (
+    id bigserial PRIMARY KEY,
+    schedule_id UUID NOT NULL REFERENCES scheduled_transfers (id),
+    occurrence_at timestamptz NOT NULL,
+    attempt integer NOT NULL,
+    status text NOT NULL CHECK (status IN ('running', 'succeeded', 'retrying', 'failed', 'unknown')),
+    error text,
+    trx_uuid UUID,
+    started_at timestamptz NOT NULL DEFAULT now(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_transfer_runs_schedule ON scheduled_transfer_runs (schedule_id, id);
+
+-- the response to a request sent with an Idempotency-Key, status_code is null
+-- while the first request is being handled
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    client_id text NOT NULL,
+    key text NOT NULL,
+    request_hash text NOT NULL,
+    status_code integer,
+    response bytea,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (client_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at ON idempotency_keys (created_at);
+
+-- a run made by hand for a failed one, a run is replayed at most once
+ALTER TABLE scheduled_transfer_runs ADD COLUMN IF NOT EXISTS replay_of bigint REFERENCES scheduled_transfer_runs (id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS scheduled_transfer_runs_replay_of ON scheduled_transfer_runs (replay_of);
+
+-- a hot account spreads its credits over shard rows so they do not all wait
+-- on its users row, its balance is the users row plus the shards
+ALTER TABLE users ADD COLUMN IF NOT EXISTS shards integer NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS balance_shards (
+    uuid UUID NOT NULL REFERENCES users (uuid),
+    shard integer NOT NULL,
+    balance real NOT NULL DEFAULT 0,
+    PRIMARY KEY (uuid, shard)
+);
+
+CREATE OR REPLACE FUNCTION account_balance(u users) RETURNS real AS $$
+    SELECT u.balance + CASE WHEN u.shards = 0 THEN 0
+        ELSE (SELECT COALESCE(SUM(s.balance), 0) FROM balance_shards s WHERE s.uuid = u.uuid) END;
+$$ LANGUAGE sql STABLE;
+
+-- a shard is chained with its own balance, the row lock of the shard orders
+-- its links, so credits of different shards never wait on each other
+CREATE OR REPLACE FUNCTION audit_balance_shard_change() RETURNS trigger AS $$
+BEGIN
+    IF OLD.balance IS DISTINCT FROM NEW.balance THEN
+        PERFORM audit_chain_append('balance', NEW.uuid::text,
+            json_build_object('uuid', NEW.uuid, 'shard', NEW.shard, 'old', OLD.balance, 'new', NEW.balance)::text);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS balance_shards_audit ON balance_shards;
+CREATE TRIGGER balance_shards_audit AFTER UPDATE OF balance ON balance_shards
+    FOR EACH ROW EXECUTE FUNCTION audit_balance_shard_change();
+
+-- transactions are partitioned by month on created_at, months are created
+-- ahead by the archive job and the default partition takes rows written while
+-- their month is missing
+CREATE OR REPLACE FUNCTION create_transactions_partition(p_month timestamptz) RETURNS boolean AS $$
+DECLARE
+    month_start timestamptz := date_trunc('month', p_month AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+    month_end timestamptz := (date_trunc('month', p_month AT TIME ZONE 'UTC') + interval '1 month') AT TIME ZONE 'UTC';
+    partition_name text := 'transactions_' || to_char(p_month AT TIME ZONE 'UTC', 'YYYY_MM');
+BEGIN
+    IF to_regclass(partition_name) IS NOT NULL THEN
+        RETURN false;
+    END IF;
+
+    -- attaching fails while the default partition holds rows of the month
+    EXECUTE format('CREATE TABLE %I (LIKE transactions INCLUDING DEFAULTS INCLUDING CONSTRAINTS)', partition_name);
+    EXECUTE format('WITH moved AS (DELETE FROM transactions_default WHERE created_at >= $1 AND created_at < $2 RETURNING *)
+                    INSERT INTO %I SELECT * FROM moved', partition_name) USING month_start, month_end;
+    EXECUTE format('ALTER TABLE transactions ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+                   partition_name, month_start, month_end);
+    RETURN true;
+END;
+$$ LANGUAGE plpgsql;
+
+DO $$
+DECLARE
+    legacy_month timestamptz;
+BEGIN
+    IF (SELECT relkind FROM pg_class WHERE oid = 'transactions'::regclass) = 'r' THEN
+        ALTER TABLE transactions RENAME TO transactions_unpartitioned;
+        ALTER TABLE transactions_unpartitioned RENAME CONSTRAINT transactions_pkey TO transactions_unpartitioned_pkey;
+        DROP INDEX IF EXISTS transactions_user_created_at;
+
+        -- the key of a partitioned table holds the partition column
+        CREATE TABLE transactions (
+            user_uuid UUID,
+            trx_uuid UUID NOT NULL DEFAULT uuid_generate_v4(),
+            created_at timestamptz NOT NULL DEFAULT clock_timestamp(),
+            who text,
+            description text,
+            amount real,
+            currency text,
+            operation text NOT NULL DEFAULT 'update',
+            PRIMARY KEY (trx_uuid, created_at)
+        ) PARTITION BY RANGE (created_at);
+        CREATE TABLE transactions_default PARTITION OF transactions DEFAULT;
+
+        FOR legacy_month IN SELECT DISTINCT date_trunc('month', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+                     FROM transactions_unpartitioned LOOP
+            PERFORM create_transactions_partition(legacy_month);
+        END LOOP;
+
+        -- copied before the audit trigger is created, the rows are in the chain
+        INSERT INTO transactions (user_uuid, trx_uuid, created_at, who, description, amount, currency, operation)
+        SELECT user_uuid, trx_uuid, created_at, who, description, amount, currency, operation
+        FROM transactions_unpartitioned;
+
+        DROP TABLE transactions_unpartitioned;
+    END IF;
+
+    PERFORM create_transactions_partition(now());
+    PERFORM create_transactions_partition(now() + interval '1 month');
+END $$;
+
+CREATE INDEX IF NOT EXISTS transactions_user_created_at ON transactions (user_uuid, created_at);
+
+DROP TRIGGER IF EXISTS transactions_audit ON transactions;
+CREATE TRIGGER transactions_audit AFTER INSERT ON transactions
+    FOR EACH ROW EXECUTE FUNCTION audit_transaction_insert();
+
+-- reverses is the trx_uuid a reversal undoes. The key of the partitioned table
+-- holds created_at, so it can not be a foreign key. Reversals made before the
+-- column existed are matched by their description once.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reverses UUID;
+
+UPDATE transactions SET reverses = substring(description FROM 'abort transaction (.*)$')::uuid
+WHERE operation = 'reversal' AND reverses IS NULL
+AND description ~ '^abort transaction [0-9a-f-]{36}$';
+
+CREATE INDEX IF NOT EXISTS transactions_reverses ON transactions (reverses) WHERE reverses IS NOT NULL;
+
+-- a month of transactions moved to cold storage, its partition is dropped in
+-- the database transaction that records it
+CREATE TABLE IF NOT EXISTS transaction_archives (
+    partition text PRIMARY KEY,
+    range_start timestamptz NOT NULL,
+    range_end timestamptz NOT NULL,
+    location text NOT NULL,
+    format text NOT NULL,
+    transactions bigint NOT NULL,
+    amount double precision NOT NULL,
+    sha256 text NOT NULL,
+    archived_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- the sum of the archived transactions of a user, ledger queries add it to
+-- the transactions left in the table
+CREATE TABLE IF NOT EXISTS archived_balances (
+    user_uuid UUID PRIMARY KEY,
+    amount double precision NOT NULL,
+    transactions bigint NOT NULL
+);
+
+-- the moment the transactions of a user are complete from, null while none
+-- of them were archived
+CREATE OR REPLACE FUNCTION transactions_archived_before(p_user uuid) RETURNS timestamptz AS $$
+    SELECT max(range_end) FROM transaction_archives
+    WHERE EXISTS (SELECT 1 FROM archived_balances WHERE user_uuid = p_user);
+$$ LANGUAGE sql STABLE;
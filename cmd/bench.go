@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"sync"
+	"time"
+	"users_balance/internal/infrastructure"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+type benchRun struct {
+	Shards       int     `json:"shards"`
+	Credits      int     `json:"credits"`
+	Errors       int     `json:"errors"`
+	PerSecond    float64 `json:"credits_per_second"`
+	P50          string  `json:"p50"`
+	P99          string  `json:"p99"`
+	Credited     float64 `json:"credited"`
+	FinalBalance float64 `json:"final_balance"`
+}
+
+type benchReport struct {
+	Workers  int        `json:"workers"`
+	Duration string     `json:"duration"`
+	Runs     []benchRun `json:"runs"`
+}
+
+// benchHotAccount credits a new account from many workers at once, first kept
+// in its users row and then spread over shards, and prints the throughput of
+// both. Every credit is a real transaction, run it against a scratch database.
+func benchHotAccount(injector infrastructure.IInjector, args []string) int {
+	flags := flag.NewFlagSet("bench-hot-account", flag.ContinueOnError)
+	workers := flags.Int("workers", 32, "concurrent credits, at most the size of the connection pool run at once")
+	duration := flags.Duration("duration", 10*time.Second, "how long each run credits")
+	shards := flags.Int("shards", 16, "shards of the hot account in the second run")
+	amount := flags.Float64("amount", 1, "amount of each credit")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	accounts := injector.InjectAccountService()
+	balances := injector.InjectUserBalanceService()
+	report := benchReport{Workers: *workers, Duration: duration.String()}
+
+	for _, n := range []int{0, *shards} {
+		account, err := accounts.CreateAccount(models.NewAccount{})
+		if err != nil {
+			log.Errorf("bench-hot-account :: %s", err)
+			return 1
+		}
+		if n > 0 {
+			_, err = accounts.SetShards(models.AccountShards{UserID: account.ID, Shards: n})
+			if err != nil {
+				log.Errorf("bench-hot-account :: %s", err)
+				return 1
+			}
+		}
+
+		run := creditConcurrently(balances, account.ID, *workers, *duration, *amount)
+		run.Shards = n
+
+		final, err := balances.GetUserBalance(account.ID, "", nil)
+		if err != nil {
+			log.Errorf("bench-hot-account :: %s", err)
+			return 1
+		}
+		run.FinalBalance = final.Balance
+
+		log.Infof("bench-hot-account :: %d shards :: %.0f credits/s", n, run.PerSecond)
+		report.Runs = append(report.Runs, run)
+	}
+
+	printJSON(report)
+	return 0
+}
+
+// creditConcurrently credits uuid from workers goroutines for d. The final
+// balance is credited less the fees, if credits are charged any.
+func creditConcurrently(balances interfaces.IUserBalanceService, uuid string, workers int, d time.Duration, amount float64) benchRun {
+	var mu sync.Mutex
+	var latencies []time.Duration
+	run := benchRun{}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(d)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var own []time.Duration
+			failed := 0
+			for time.Now().Before(deadline) {
+				began := time.Now()
+				_, err := balances.UpdateAccount(models.UserBalanceUpdate{
+					UserID:      uuid,
+					Who:         "bench-hot-account",
+					Description: "hot account benchmark",
+					Amount:      amount,
+					Currency:    models.RUB,
+				})
+				if err != nil {
+					failed++
+					continue
+				}
+				own = append(own, time.Since(began))
+			}
+
+			mu.Lock()
+			latencies = append(latencies, own...)
+			run.Errors += failed
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	run.Credits = len(latencies)
+	run.PerSecond = float64(run.Credits) / elapsed.Seconds()
+	run.Credited = float64(run.Credits) * amount
+	run.P50 = percentile(latencies, 0.50).String()
+	run.P99 = percentile(latencies, 0.99).String()
+
+	return run
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"users_balance/internal/models"
+	"users_balance/pkg/cashclient"
+)
+
+// apiBackend calls the API, /cash/v1 through the SDK and /admin/v1 directly.
+type apiBackend struct {
+	client  *cashclient.Client
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+func newAPIBackend(p profile) (*apiBackend, error) {
+	baseURL := strings.TrimSuffix(p.URL, "/")
+	client, err := cashclient.New(baseURL+"/cash/v1", cashclient.WithAPIKey(p.APIKey),
+		cashclient.WithUserAgent("cashctl"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiBackend{
+		client:  client,
+		baseURL: baseURL,
+		apiKey:  p.APIKey,
+		http:    &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+func (b *apiBackend) Balance(ctx context.Context, uuid string, currency string, at *time.Time) (models.User, error) {
+	var opts []cashclient.BalanceOption
+	if currency != "" {
+		opts = append(opts, cashclient.InCurrency(currency))
+	}
+	if at != nil {
+		opts = append(opts, cashclient.At(*at))
+	}
+
+	balance, err := b.client.GetBalance(ctx, uuid, opts...)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		ID:      balance.Uuid,
+		Balance: balance.Balance,
+		At:      balance.At,
+	}
+	if balance.Currency != nil {
+		user.Currency = *balance.Currency
+	}
+	if balance.Status != nil {
+		user.Status = string(*balance.Status)
+	}
+
+	return user, nil
+}
+
+func (b *apiBackend) Transactions(ctx context.Context, uuid string, sortBy string, cmp string, fn func(models.Transaction) bool) error {
+	it := b.client.ListTransactions(cashclient.TransactionsQuery{
+		UUID:       uuid,
+		PageSize:   historyPageSize,
+		SortBy:     sortBy,
+		Descending: cmp == "d",
+	})
+	for it.Next(ctx) {
+		trx := it.Transaction()
+		ok := fn(models.Transaction{
+			TrxID:       trx.Id,
+			CreatedAt:   trx.CreatedAt,
+			Who:         trx.Who,
+			Description: trx.Description,
+			Amount:      trx.Amount,
+			Currency:    trx.Currency,
+			Operation:   string(trx.Operation),
+		})
+		if !ok {
+			return nil
+		}
+	}
+
+	return it.Err()
+}
+
+func (b *apiBackend) ProposeAdjustment(ctx context.Context, req models.AdjustmentProposal) (models.ManualAdjustment, error) {
+	var adj models.ManualAdjustment
+	err := b.admin(ctx, http.MethodPost, "/adjustments", nil, req, &adj)
+
+	return adj, err
+}
+
+func (b *apiBackend) ReviewAdjustment(ctx context.Context, id string, approve bool, req models.AdjustmentReview) (models.ManualAdjustment, error) {
+	action := "/reject"
+	if approve {
+		action = "/approve"
+	}
+
+	var adj models.ManualAdjustment
+	err := b.admin(ctx, http.MethodPost, "/adjustments/"+url.PathEscape(id)+action, nil, req, &adj)
+
+	return adj, err
+}
+
+func (b *apiBackend) ListAdjustments(ctx context.Context, req models.AdjustmentsListRequest) ([]models.ManualAdjustment, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.FormatInt(req.Limit, 10))
+	query.Set("offset", strconv.FormatInt(req.Offset, 10))
+	if req.Status != "" {
+		query.Set("status", req.Status)
+	}
+
+	var resp models.AdjustmentsListResponse
+	err := b.admin(ctx, http.MethodGet, "/adjustments", query, nil, &resp)
+
+	return resp.Adjustments, err
+}
+
+func (b *apiBackend) Reconcile(ctx context.Context, fix bool) (models.ReconciliationReport, error) {
+	return models.ReconciliationReport{}, errNeedsDB
+}
+
+func (b *apiBackend) ReplayRun(ctx context.Context, id int64, force bool) (models.ScheduleRun, error) {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+
+	var run models.ScheduleRun
+	err := b.admin(ctx, http.MethodPost, "/schedule-runs/"+strconv.FormatInt(id, 10)+"/replay", query, nil, &run)
+
+	return run, err
+}
+
+// admin calls an /admin/v1 route. Admin calls are not retried, an operator
+// runs them again if needed.
+func (b *apiBackend) admin(ctx context.Context, method string, path string, query url.Values, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	target := b.baseURL + "/admin/v1" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Api-Key", b.apiKey)
+	req.Header.Set("User-Agent", "cashctl")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(raw, &failure) != nil || failure.Message == "" {
+			failure.Message = http.StatusText(resp.StatusCode)
+		}
+		return fmt.Errorf("cash api: %d: %s", resp.StatusCode, failure.Message)
+	}
+
+	return json.Unmarshal(raw, out)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+// historyPageSize is the page size history is read with, the largest the API
+// allows.
+const historyPageSize = 100
+
+var errNeedsDB = errors.New("this command needs a database profile")
+
+// errNeedsAPI refuses reviews over the database, where the operator is only
+// what the profile says. The API signs them with the client of the key, so the
+// four-eyes check compares two keys.
+var errNeedsAPI = errors.New("this command needs an API profile")
+
+// backend is what the commands run against, the API or the database.
+type backend interface {
+	Balance(ctx context.Context, uuid string, currency string, at *time.Time) (models.User, error)
+	// Transactions calls fn with the transactions of a wallet in the order
+	// they were made, sortBy and cmp order each page, until fn returns false.
+	Transactions(ctx context.Context, uuid string, sortBy string, cmp string, fn func(models.Transaction) bool) error
+	ProposeAdjustment(ctx context.Context, req models.AdjustmentProposal) (models.ManualAdjustment, error)
+	ReviewAdjustment(ctx context.Context, id string, approve bool, req models.AdjustmentReview) (models.ManualAdjustment, error)
+	ListAdjustments(ctx context.Context, req models.AdjustmentsListRequest) ([]models.ManualAdjustment, error)
+	Reconcile(ctx context.Context, fix bool) (models.ReconciliationReport, error)
+	ReplayRun(ctx context.Context, id int64, force bool) (models.ScheduleRun, error)
+}
+
+// dbBackend calls the services directly, as the server would.
+type dbBackend struct {
+	operator       string
+	balance        interfaces.IUserBalanceService
+	adjustments    interfaces.IAdjustmentService
+	reconciliation interfaces.IReconciliationService
+	schedules      interfaces.IScheduleService
+}
+
+func (b *dbBackend) Balance(ctx context.Context, uuid string, currency string, at *time.Time) (models.User, error) {
+	return b.balance.GetUserBalance(uuid, currency, at)
+}
+
+func (b *dbBackend) Transactions(ctx context.Context, uuid string, sortBy string, cmp string, fn func(models.Transaction) bool) error {
+	for offset := int64(0); ; offset += historyPageSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		resp, err := b.balance.GetTransactionsList(models.TransactionsListRequest{
+			UserID:   uuid,
+			Limit:    historyPageSize,
+			Offset:   offset,
+			SortBy:   sortBy,
+			Cmp:      cmp,
+			Location: time.UTC,
+		})
+		// a page past the last transaction is not found
+		if err == er.ErrNotFound && offset > 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, trx := range resp.TransactionsList {
+			if !fn(trx) {
+				return nil
+			}
+		}
+		if len(resp.TransactionsList) < historyPageSize {
+			return nil
+		}
+	}
+}
+
+func (b *dbBackend) ProposeAdjustment(ctx context.Context, req models.AdjustmentProposal) (models.ManualAdjustment, error) {
+	return b.adjustments.Propose(b.operator, req)
+}
+
+func (b *dbBackend) ReviewAdjustment(ctx context.Context, id string, approve bool, req models.AdjustmentReview) (models.ManualAdjustment, error) {
+	return models.ManualAdjustment{}, errNeedsAPI
+}
+
+func (b *dbBackend) ListAdjustments(ctx context.Context, req models.AdjustmentsListRequest) ([]models.ManualAdjustment, error) {
+	resp, err := b.adjustments.List(req)
+
+	return resp.Adjustments, err
+}
+
+func (b *dbBackend) Reconcile(ctx context.Context, fix bool) (models.ReconciliationReport, error) {
+	return b.reconciliation.Reconcile(ctx, fix)
+}
+
+func (b *dbBackend) ReplayRun(ctx context.Context, id int64, force bool) (models.ScheduleRun, error) {
+	return b.schedules.ReplayRun(id, force)
+}
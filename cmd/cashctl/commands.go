@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"os"
+	"strconv"
+	"time"
+	"users_balance/internal/models"
+	"users_balance/internal/reconciliation"
+)
+
+var validate = validator.New()
+
+// parseArgs parses flags given before, between or after the positional
+// arguments, which it returns.
+func parseArgs(flags *flag.FlagSet, args []string, positional int) ([]string, bool) {
+	var values []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, false
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		values = append(values, args[0])
+		args = args[1:]
+	}
+
+	if len(values) != positional {
+		fmt.Fprintf(os.Stderr, "%s: expected %d argument(s), got %d\n", flags.Name(), positional, len(values))
+		return nil, false
+	}
+
+	return values, true
+}
+
+func fail(name string, err error) int {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+	return 1
+}
+
+func balanceCmd(ctx context.Context, b backend, out *printer, args []string) int {
+	flags := flag.NewFlagSet("balance", flag.ContinueOnError)
+	currency := flags.String("currency", "", "convert the balance to this currency")
+	rawAt := flags.String("at", "", "the balance at this moment, RFC 3339")
+	values, ok := parseArgs(flags, args, 1)
+	if !ok {
+		return 1
+	}
+
+	var at *time.Time
+	if *rawAt != "" {
+		t, err := time.Parse(time.RFC3339, *rawAt)
+		if err != nil {
+			return fail("balance", err)
+		}
+		at = &t
+	}
+
+	user, err := b.Balance(ctx, values[0], *currency, at)
+	if err != nil {
+		return fail("balance", err)
+	}
+
+	currencyColumn := user.Currency
+	if currencyColumn == "" {
+		currencyColumn = models.RUB
+	}
+	atColumn := "now"
+	if user.At != nil {
+		atColumn = formatTime(*user.At)
+	}
+	err = out.print(user, []string{"UUID", "BALANCE", "CURRENCY", "STATUS", "AT"}, [][]string{
+		{user.ID, formatAmount(user.Balance), currencyColumn, orDash(&user.Status), atColumn},
+	})
+	if err != nil {
+		return fail("balance", err)
+	}
+
+	return 0
+}
+
+var transactionHeader = []string{"ID", "CREATED_AT", "AMOUNT", "CURRENCY", "OPERATION", "WHO", "DESCRIPTION"}
+
+func transactionRow(trx models.Transaction) []string {
+	return []string{trx.TrxID, formatTime(trx.CreatedAt), formatAmount(trx.Amount), trx.Currency, trx.Operation,
+		trx.Who, trx.Description}
+}
+
+func transactionsCmd(ctx context.Context, b backend, out *printer, args []string) int {
+	flags := flag.NewFlagSet("transactions", flag.ContinueOnError)
+	limit := flags.Int("limit", 20, "number of transactions, the oldest first")
+	sortBy := flags.String("sort", "", "order of each page, date or amount")
+	desc := flags.Bool("desc", false, "reverse the order of each page")
+	values, ok := parseArgs(flags, args, 1)
+	if !ok {
+		return 1
+	}
+
+	cmp := "i"
+	if *desc {
+		cmp = "d"
+	}
+
+	list := []models.Transaction{}
+	err := b.Transactions(ctx, values[0], *sortBy, cmp, func(trx models.Transaction) bool {
+		list = append(list, trx)
+		return len(list) < *limit
+	})
+	if err != nil {
+		return fail("transactions", err)
+	}
+
+	rows := make([][]string, len(list))
+	for i, trx := range list {
+		rows[i] = transactionRow(trx)
+	}
+	if err := out.print(list, transactionHeader, rows); err != nil {
+		return fail("transactions", err)
+	}
+
+	return 0
+}
+
+// exportCmd writes the whole history of a wallet, oldest first.
+func exportCmd(ctx context.Context, b backend, out *printer, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "csv", "csv or json")
+	path := flags.String("out", "", "file to write, stdout when empty")
+	values, ok := parseArgs(flags, args, 1)
+	if !ok {
+		return 1
+	}
+	if *format != "csv" && *format != "json" {
+		return fail("export", fmt.Errorf("unknown format %q", *format))
+	}
+
+	var w io.Writer = os.Stdout
+	if *path != "" {
+		f, err := os.Create(*path)
+		if err != nil {
+			return fail("export", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var list []models.Transaction
+	csvWriter := csv.NewWriter(w)
+	if *format == "csv" {
+		csvWriter.Write(transactionHeader)
+	}
+
+	n := 0
+	err := b.Transactions(ctx, values[0], "", "", func(trx models.Transaction) bool {
+		n++
+		if *format == "json" {
+			list = append(list, trx)
+			return true
+		}
+		return csvWriter.Write(transactionRow(trx)) == nil
+	})
+	if err != nil {
+		return fail("export", err)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(list)
+	} else {
+		csvWriter.Flush()
+		err = csvWriter.Error()
+	}
+	if err != nil {
+		return fail("export", err)
+	}
+
+	if *path != "" {
+		fmt.Fprintf(os.Stderr, "export: %d transactions written to %s\n", n, *path)
+	}
+	return 0
+}
+
+var adjustmentHeader = []string{"ID", "UUID", "AMOUNT", "CURRENCY", "STATUS", "PROPOSED_BY", "REVIEWED_BY", "REASON"}
+
+func adjustmentRow(adj models.ManualAdjustment) []string {
+	return []string{adj.ID, adj.UserID, formatAmount(adj.Amount), adj.Currency, adj.Status, adj.ProposedBy,
+		orDash(adj.ReviewedBy), adj.Reason}
+}
+
+// adjustCmd proposes a manual adjustment, another operator approves it.
+func adjustCmd(ctx context.Context, b backend, out *printer, args []string) int {
+	flags := flag.NewFlagSet("adjust", flag.ContinueOnError)
+	req := models.AdjustmentProposal{}
+	flags.StringVar(&req.UserID, "uuid", "", "the wallet")
+	flags.Float64Var(&req.Amount, "amount", 0, "positive to credit, negative to debit")
+	flags.StringVar(&req.Currency, "currency", models.RUB, "currency of the amount")
+	flags.StringVar(&req.Reason, "reason", "", "why, at least 10 characters")
+	if _, ok := parseArgs(flags, args, 0); !ok {
+		return 1
+	}
+	if err := validate.Struct(req); err != nil {
+		return fail("adjust", err)
+	}
+
+	adj, err := b.ProposeAdjustment(ctx, req)
+	if err != nil {
+		return fail("adjust", err)
+	}
+
+	if err := out.print(adj, adjustmentHeader, [][]string{adjustmentRow(adj)}); err != nil {
+		return fail("adjust", err)
+	}
+
+	return 0
+}
+
+func adjustmentsCmd(ctx context.Context, b backend, out *printer, args []string) int {
+	flags := flag.NewFlagSet("adjustments", flag.ContinueOnError)
+	req := models.AdjustmentsListRequest{}
+	flags.StringVar(&req.Status, "status", models.AdjustmentPending, "pending, approved, rejected, posted or failed, every state when empty")
+	flags.Int64Var(&req.Limit, "limit", 20, "number of adjustments, 1 to 100")
+	if _, ok := parseArgs(flags, args, 0); !ok {
+		return 1
+	}
+	if err := validate.Struct(req); err != nil {
+		return fail("adjustments", err)
+	}
+
+	list, err := b.ListAdjustments(ctx, req)
+	if err != nil {
+		return fail("adjustments", err)
+	}
+
+	rows := make([][]string, len(list))
+	for i, adj := range list {
+		rows[i] = adjustmentRow(adj)
+	}
+	if err := out.print(list, adjustmentHeader, rows); err != nil {
+		return fail("adjustments", err)
+	}
+
+	return 0
+}
+
+// reviewCmd approves or rejects an adjustment, only through the API.
+func reviewCmd(approve bool) func(ctx context.Context, b backend, out *printer, args []string) int {
+	name := "reject"
+	if approve {
+		name = "approve"
+	}
+
+	return func(ctx context.Context, b backend, out *printer, args []string) int {
+		flags := flag.NewFlagSet(name, flag.ContinueOnError)
+		req := models.AdjustmentReview{}
+		flags.StringVar(&req.Comment, "comment", "", "review comment")
+		values, ok := parseArgs(flags, args, 1)
+		if !ok {
+			return 1
+		}
+
+		adj, err := b.ReviewAdjustment(ctx, values[0], approve, req)
+		if err != nil {
+			return fail(name, err)
+		}
+
+		if err := out.print(adj, adjustmentHeader, [][]string{adjustmentRow(adj)}); err != nil {
+			return fail(name, err)
+		}
+
+		return 0
+	}
+}
+
+// reconcileCmd exits with 2 when discrepancies were found and left unfixed,
+// like the reconcile command of the server.
+func reconcileCmd(ctx context.Context, b backend, out *printer, args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "write correction transactions for the discrepancies")
+	if _, ok := parseArgs(flags, args, 0); !ok {
+		return 1
+	}
+
+	report, err := b.Reconcile(ctx, *fix)
+	if err != nil {
+		return fail("reconcile", err)
+	}
+
+	if out.format == outputJSON {
+		err = reconciliation.WriteReport(out.w, report, reconciliation.FormatJSON)
+	} else {
+		rows := make([][]string, len(report.Discrepancies))
+		for i, d := range report.Discrepancies {
+			rows[i] = []string{d.UserID, formatAmount(d.Expected), formatAmount(d.Actual), formatAmount(d.Difference),
+				orDash(d.FirstDivergentTransaction), orDash(d.CorrectionTransaction)}
+		}
+		err = out.print(report, []string{"UUID", "EXPECTED", "ACTUAL", "DIFFERENCE", "FIRST_DIVERGENT", "CORRECTION"}, rows)
+	}
+	if err != nil {
+		return fail("reconcile", err)
+	}
+	fmt.Fprintf(os.Stderr, "reconcile: %d discrepancies\n", len(report.Discrepancies))
+
+	if len(report.Discrepancies) > 0 && !*fix {
+		return 2
+	}
+	return 0
+}
+
+// replayCmd runs the occurrence of a failed scheduled transfer once more.
+func replayCmd(ctx context.Context, b backend, out *printer, args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	force := flags.Bool("force", false, "also replay a run in an unknown state, check first that no money moved")
+	values, ok := parseArgs(flags, args, 1)
+	if !ok {
+		return 1
+	}
+
+	id, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return fail("replay", err)
+	}
+
+	run, err := b.ReplayRun(ctx, id, *force)
+	if err != nil {
+		return fail("replay", err)
+	}
+
+	err = out.print(run, []string{"ID", "SCHEDULE", "REPLAY_OF", "STATUS", "TRANSACTION", "ERROR"}, [][]string{
+		{strconv.FormatInt(run.ID, 10), run.ScheduleID, values[0], run.Status, orDash(run.TrxID), orDash(run.Error)},
+	})
+	if err != nil {
+		return fail("replay", err)
+	}
+
+	if run.Status != models.RunSucceeded {
+		return 1
+	}
+	return 0
+}
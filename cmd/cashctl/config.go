@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// profile says where cashctl connects to. A profile with a URL talks to the
+// API, with an API key holding the admin scope, one without connects to the
+// database, using the same environment variables as the server for anything
+// not set.
+type profile struct {
+	URL    string `json:"url"`
+	APIKey string `json:"api_key"`
+
+	DBHost     string `json:"db_host"`
+	DBPort     string `json:"db_port"`
+	DBName     string `json:"db_name"`
+	DBUser     string `json:"db_user"`
+	DBPassword string `json:"db_password"`
+	// Operator signs manual adjustments proposed through the database, the
+	// API uses the client of the key. Reviews are only made through the API.
+	Operator string `json:"operator"`
+
+	// Output is the default of -o.
+	Output string `json:"output"`
+}
+
+// configFile is read from -config, $CASHCTL_CONFIG or
+// <user config dir>/cashctl/config.json, e.g.
+//
+//	{
+//	  "default_profile": "local",
+//	  "profiles": {
+//	    "local": {"db_host": "localhost", "db_port": "5432", "db_name": "balance", "db_user": "admin"},
+//	    "prod": {"url": "https://cash.example.com", "output": "json"}
+//	  }
+//	}
+//
+// Secrets may be left out of the file: $CASHCTL_API_KEY and $DB_ADMIN_PASSWORD
+// are used instead.
+type configFile struct {
+	DefaultProfile string             `json:"default_profile"`
+	Profiles       map[string]profile `json:"profiles"`
+}
+
+func defaultConfigPath() string {
+	if path := os.Getenv("CASHCTL_CONFIG"); path != "" {
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "cashctl", "config.json")
+}
+
+// loadProfile returns the named profile, the default one when name is empty.
+// Without a config file and a name the database of the environment is used.
+func loadProfile(path string, name string) (profile, error) {
+	var cfg configFile
+	raw, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err) && name == "":
+		return profile{}, nil
+	case err != nil:
+		return profile{}, err
+	}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return profile{}, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if name == "" {
+		name = cfg.DefaultProfile
+	}
+	if name == "" {
+		return profile{}, nil
+	}
+
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("%s: no profile %q", path, name)
+	}
+	if key := os.Getenv("CASHCTL_API_KEY"); key != "" {
+		p.APIKey = key
+	}
+
+	return p, nil
+}
@@ -0,0 +1,170 @@
+// Command cashctl is the operator tool of the balance service. It runs against
+// the API or directly against the database, as set by the profile.
+//
+//	cashctl [-profile name] [-config path] [-o table|json] <command> [flags] [args]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"os/signal"
+	"sort"
+	"users_balance/internal/config"
+	"users_balance/internal/infrastructure"
+)
+
+// command runs a subcommand and returns the exit code.
+type command struct {
+	usage string
+	run   func(ctx context.Context, b backend, out *printer, args []string) int
+}
+
+var commands = map[string]command{
+	"balance":      {"balance <uuid> [-currency code] [-at RFC3339 time]", balanceCmd},
+	"transactions": {"transactions <uuid> [-limit n] [-sort date|amount] [-desc]", transactionsCmd},
+	"export":       {"export <uuid> [-format csv|json] [-out file]", exportCmd},
+	"adjust":       {"adjust -uuid uuid -amount n -reason text [-currency code]", adjustCmd},
+	"adjustments":  {"adjustments [-status state] [-limit n]", adjustmentsCmd},
+	"approve":      {"approve <adjustment id> [-comment text]", reviewCmd(true)},
+	"reject":       {"reject <adjustment id> [-comment text]", reviewCmd(false)},
+	"reconcile":    {"reconcile [-fix]", reconcileCmd},
+	"replay":       {"replay <schedule run id> [-force]", replayCmd},
+}
+
+var log *zap.SugaredLogger
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("cashctl", flag.ContinueOnError)
+	configPath := flags.String("config", defaultConfigPath(), "config file")
+	profileName := flags.String("profile", os.Getenv("CASHCTL_PROFILE"), "profile, the default one of the config file when empty")
+	output := flags.String("o", "", "output, table or json")
+	flags.Usage = func() { usage(flags) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if flags.NArg() == 0 {
+		usage(flags)
+		return 1
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flags.Arg(0))
+		usage(flags)
+		return 1
+	}
+
+	p, err := loadProfile(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cashctl: %s\n", err)
+		return 1
+	}
+
+	out := &printer{w: os.Stdout, format: *output}
+	if out.format == "" {
+		out.format = p.Output
+	}
+	if out.format == "" {
+		out.format = outputTable
+	}
+	if out.format != outputTable && out.format != outputJSON {
+		fmt.Fprintf(os.Stderr, "cashctl: unknown output %q\n", out.format)
+		return 1
+	}
+
+	logger, err := newLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cashctl: %s\n", err)
+		return 1
+	}
+	log = logger
+
+	b, err := newBackend(p)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cashctl: %s\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return cmd.run(ctx, b, out, flags.Args()[1:])
+}
+
+func newBackend(p profile) (backend, error) {
+	if p.URL != "" {
+		return newAPIBackend(p)
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		return nil, err
+	}
+	setIfGiven(&cfg.DBHost, p.DBHost)
+	setIfGiven(&cfg.DBPort, p.DBPort)
+	setIfGiven(&cfg.DBName, p.DBName)
+	setIfGiven(&cfg.DBAdminUsername, p.DBUser)
+	if p.DBPassword != "" {
+		cfg.DBAdminPassword = config.Secret(p.DBPassword)
+	}
+
+	injector, err := infrastructure.Injector(log, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	operator := p.Operator
+	if operator == "" {
+		operator = os.Getenv("USER")
+	}
+
+	return &dbBackend{
+		operator:       operator,
+		balance:        injector.InjectUserBalanceService(),
+		adjustments:    injector.InjectAdjustmentService(),
+		reconciliation: injector.InjectReconciliationService(),
+		schedules:      injector.InjectScheduleService(),
+	}, nil
+}
+
+func setIfGiven(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+// newLogger only shows warnings, the services log every failure at info.
+func newLogger() (*zap.SugaredLogger, error) {
+	cfg := zap.NewDevelopmentConfig()
+	cfg.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
+	logger, err := cfg.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return logger.Sugar(), nil
+}
+
+func usage(flags *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "usage: cashctl [-profile name] [-config path] [-o table|json] <command>")
+	flags.PrintDefaults()
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
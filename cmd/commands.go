@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"users_balance/api/openapi"
+	"users_balance/internal/infrastructure"
+	"users_balance/internal/middleware"
+	"users_balance/internal/reconciliation"
+)
+
+// runCommand runs a maintenance subcommand instead of the API server and
+// returns the process exit code.
+func runCommand(injector infrastructure.IInjector, args []string) int {
+	switch args[0] {
+	case "verify":
+		audit := injector.InjectAuditService()
+		// the links of committed mutations are chained first so all of them
+		// are verified
+		if _, err := audit.Sequence(ctx); err != nil {
+			log.Errorf("verify :: %s", err)
+			return 1
+		}
+		report, err := audit.Verify(ctx)
+		if err != nil {
+			log.Errorf("verify :: %s", err)
+			return 1
+		}
+		printJSON(report)
+		if !report.Valid {
+			return 2
+		}
+		return 0
+	case "reconcile":
+		return reconcile(injector, args[1:])
+	case "archive-transactions":
+		report, err := injector.InjectArchiveService().Archive(ctx)
+		if err != nil {
+			log.Errorf("archive-transactions :: %s", err)
+			return 1
+		}
+		printJSON(report)
+		return 0
+	case "bench-hot-account":
+		return benchHotAccount(injector, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, available: verify, reconcile, archive-transactions, bench-hot-account\n", args[0])
+		return 1
+	}
+}
+
+// reconcile prints a reconciliation report. It exits with 2 when discrepancies
+// were found and left unfixed.
+func reconcile(injector infrastructure.IInjector, args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	format := flags.String("format", reconciliation.FormatJSON, "report format, json or csv")
+	fix := flags.Bool("fix", false, "write correction transactions for the discrepancies")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	report, err := injector.InjectReconciliationService().Reconcile(ctx, *fix)
+	if err != nil {
+		log.Errorf("reconcile :: %s", err)
+		return 1
+	}
+
+	if err := reconciliation.WriteReport(os.Stdout, report, *format); err != nil {
+		log.Errorf("reconcile :: %s", err)
+		return 1
+	}
+
+	if len(report.Discrepancies) > 0 && !*fix {
+		return 2
+	}
+	return 0
+}
+
+// checkOpenAPI compares the routes with the OpenAPI spec and exits with 2 when
+// they differ. Routes are only registered, so it runs without a database.
+func checkOpenAPI() int {
+	router := newRouter(handlers{
+		authenticator: &middleware.Authenticator{},
+		rateLimiter:   &middleware.RateLimiter{},
+	})
+
+	problems, err := openapi.CheckRoutes(router.Routes(), undocumentedRoutes...)
+	if err != nil {
+		log.Errorf("check-openapi :: %s", err)
+		return 1
+	}
+
+	for _, problem := range problems {
+		log.Warnf("check-openapi :: %s", problem)
+	}
+	if len(problems) > 0 {
+		log.Errorf("check-openapi :: the routes and the spec differ in %d places", len(problems))
+		return 2
+	}
+	return 0
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
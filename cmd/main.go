@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"fmt"
-	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"net"
 	"os"
+	// the alpine image has no zoneinfo, the tz parameter needs the embedded one
+	_ "time/tzdata"
+	"users_balance/api/openapi"
 	"users_balance/internal/config"
 	"users_balance/internal/infrastructure"
 )
@@ -34,22 +37,95 @@ func init() {
 }
 
 func main() {
+	// needs no database
+	if len(os.Args) > 1 && os.Args[1] == "check-openapi" {
+		os.Exit(checkOpenAPI())
+	}
+
 	injector, err := infrastructure.Injector(log, cfg)
 	if err != nil {
 		log.Fatal("main :: inject failing")
 	}
 
+	ctx = context.Background()
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(injector, os.Args[1:]))
+	}
+
 	balanceController := injector.InjectBalanceController()
+	limitsController := injector.InjectSpendingLimitsController()
+	webhookController := injector.InjectWebhookController()
+	accountController := injector.InjectAccountController()
+	adjustmentController := injector.InjectAdjustmentController()
+	auditController := injector.InjectAuditController()
+	payoutController := injector.InjectPayoutController()
+	scheduleController := injector.InjectScheduleController()
+	authenticator, err := injector.InjectAuthenticator()
+	if err != nil {
+		log.Fatalf("main :: auth init error :: %s", err)
+	}
+	rateLimiter := injector.InjectRateLimiter()
+	idempotency := injector.InjectIdempotency()
+	go idempotency.Run(ctx)
+
+	hub := injector.InjectBalanceHub()
+	go hub.Run(ctx)
+
+	if grpcServer := injector.InjectGRPCServer(authenticator, rateLimiter, hub); grpcServer != nil {
+		listener, err := net.Listen("tcp", ":"+cfg.GRPCData.Port)
+		if err != nil {
+			log.Fatalf("main :: grpc listen error :: %s", err)
+		}
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Fatalf("main :: grpc serve error :: %s", err)
+			}
+		}()
+	}
 
-	gin.SetMode(gin.ReleaseMode)
-	router := gin.Default()
+	relay, err := injector.InjectOutboxRelay()
+	if err != nil {
+		log.Fatalf("main :: outbox init error :: %s", err)
+	}
+	if relay != nil {
+		go relay.Run(ctx)
+	}
+	go injector.InjectWebhookDispatcher().Run(ctx)
+	go injector.InjectAuditSequencer().Run(ctx)
+	go injector.InjectSnapshotJob().Run(ctx)
+	go injector.InjectArchiveJob().Run(ctx)
+	go injector.InjectPayoutPool().Run(ctx)
+	go injector.InjectScheduler().Run(ctx)
 
-	v1 := router.Group("/cash/v1")
-	{
-		v1.GET("/balance", balanceController.GetUserBalance)
-		v1.POST("/balance/update", balanceController.UpdateAccount)
-		v1.POST("/balance/transfer", balanceController.Transfer)
-		v1.GET("/trx_list", balanceController.GetTransactionsList)
+	streamController := injector.InjectStreamController(hub)
+	docsController := injector.InjectDocsController()
+	if job := injector.InjectReconciliationJob(); job != nil {
+		go job.Run(ctx)
+	}
+
+	router := newRouter(handlers{
+		authenticator: authenticator,
+		rateLimiter:   rateLimiter,
+		idempotency:   idempotency,
+		balance:       balanceController,
+		limits:        limitsController,
+		webhooks:      webhookController,
+		accounts:      accountController,
+		adjustments:   adjustmentController,
+		audit:         auditController,
+		payouts:       payoutController,
+		schedules:     scheduleController,
+		streams:       streamController,
+		docs:          docsController,
+	})
+
+	problems, err := openapi.CheckRoutes(router.Routes(), undocumentedRoutes...)
+	if err != nil {
+		log.Fatalf("main :: openapi spec error :: %s", err)
+	}
+	for _, problem := range problems {
+		log.Warnf("main :: openapi :: %s", problem)
 	}
 
 	err = router.Run()
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"users_balance/internal/controllers"
+	"users_balance/internal/middleware"
+)
+
+// handlers are what the routes are served by.
+type handlers struct {
+	authenticator *middleware.Authenticator
+	rateLimiter   *middleware.RateLimiter
+	idempotency   *middleware.Idempotency
+	balance       balance_controllers.UserBalanceController
+	limits        balance_controllers.SpendingLimitsController
+	webhooks      balance_controllers.WebhookController
+	accounts      balance_controllers.AccountController
+	adjustments   balance_controllers.AdjustmentController
+	audit         balance_controllers.AuditController
+	payouts       balance_controllers.PayoutController
+	schedules     balance_controllers.ScheduleController
+	streams       balance_controllers.StreamController
+	docs          balance_controllers.DocsController
+}
+
+// undocumentedRoutes are the routes missing from the OpenAPI specs on purpose,
+// the spec and its viewer.
+var undocumentedRoutes = []string{"GET /cash/v1/openapi.json", "GET /cash/v1/docs"}
+
+func newRouter(h handlers) *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(middleware.Logger(), gin.Recovery())
+
+	v1 := router.Group("/cash/v1", h.authenticator.Authenticate, h.rateLimiter.Limit)
+	{
+		v1.GET("/balance", middleware.RequireScope(middleware.ScopeBalanceRead), middleware.RestrictToSubject, h.balance.GetUserBalance)
+		v1.POST("/balance/update", middleware.RequireScope(middleware.ScopeBalanceCredit, middleware.ScopeBalanceDebit), h.idempotency.Handle, h.balance.UpdateAccount)
+		v1.POST("/balance/batch", middleware.RequireScope(middleware.ScopeBalanceCredit, middleware.ScopeBalanceDebit), h.idempotency.Handle, h.balance.BatchUpdate)
+		v1.POST("/balance/transfer", middleware.RequireScope(middleware.ScopeTransfer), h.idempotency.Handle, h.balance.Transfer)
+		v1.GET("/trx_list", middleware.RequireScope(middleware.ScopeBalanceRead), middleware.RestrictToSubject, h.balance.GetTransactionsList)
+		v1.GET("/statement", middleware.RequireScope(middleware.ScopeBalanceRead), middleware.RestrictToSubject, h.balance.GetStatement)
+
+		jobs := v1.Group("/jobs", middleware.RequireScope(middleware.ScopeBalanceCredit))
+		jobs.POST("/payouts", h.payouts.CreateJob)
+		jobs.GET("/:id", h.payouts.GetJob)
+
+		schedules := v1.Group("/schedules", middleware.RequireScope(middleware.ScopeTransfer, middleware.ScopeBalanceCredit, middleware.ScopeBalanceDebit))
+		schedules.POST("", h.schedules.CreateSchedule)
+		schedules.GET("", h.schedules.ListSchedules)
+		schedules.GET("/:id", h.schedules.GetSchedule)
+		schedules.PUT("/:id", h.schedules.UpdateSchedule)
+		schedules.DELETE("/:id", h.schedules.CancelSchedule)
+		schedules.GET("/:id/runs", h.schedules.ListRuns)
+
+		users := v1.Group("/users", middleware.RequireScope(middleware.ScopeAccounts))
+		users.POST("", h.accounts.CreateAccount)
+		users.GET("/:uuid", h.accounts.GetAccount)
+		users.POST("/:uuid/freeze", h.accounts.FreezeAccount)
+		users.POST("/:uuid/unfreeze", h.accounts.UnfreezeAccount)
+		users.POST("/:uuid/close", h.accounts.CloseAccount)
+
+		hooks := v1.Group("/webhooks", middleware.RequireScope(middleware.ScopeWebhooks))
+		hooks.POST("", middleware.RequireScope(middleware.ScopeBalanceRead), h.webhooks.CreateSubscription)
+		hooks.GET("", h.webhooks.ListSubscriptions)
+		hooks.DELETE("/:id", h.webhooks.DeleteSubscription)
+		hooks.GET("/:id/deliveries", h.webhooks.ListDeliveries)
+		hooks.POST("/deliveries/:delivery_id/replay", h.webhooks.ReplayDelivery)
+	}
+
+	// browsers can not set headers on these, they may pass the token as a
+	// parameter, middleware.Logger keeps it out of the request log
+	stream := router.Group("/cash/v1/balance", middleware.TokenFromQuery, h.authenticator.Authenticate, h.rateLimiter.Limit,
+		middleware.RequireScope(middleware.ScopeBalanceRead), middleware.RestrictToSubject)
+	{
+		stream.GET("/stream", h.streams.StreamBalance)
+		stream.GET("/ws", h.streams.StreamBalanceWS)
+	}
+
+	admin := router.Group("/admin/v1", h.authenticator.Authenticate, middleware.RequireScope(middleware.ScopeAdmin))
+	{
+		admin.GET("/limits/:subject_type/:subject", h.limits.GetLimits)
+		admin.PUT("/limits/:subject_type/:subject", h.limits.SetLimits)
+		admin.DELETE("/limits/:subject_type/:subject", h.limits.DeleteLimits)
+		admin.PUT("/users/:uuid/tier", h.limits.SetUserTier)
+		admin.PUT("/users/:uuid/shards", h.accounts.SetShards)
+
+		admin.POST("/adjustments", h.adjustments.Propose)
+		admin.GET("/adjustments", h.adjustments.List)
+		admin.GET("/adjustments/:id", h.adjustments.Get)
+		admin.POST("/adjustments/:id/approve", h.adjustments.Approve)
+		admin.POST("/adjustments/:id/reject", h.adjustments.Reject)
+		admin.GET("/adjustments/:id/audit", h.adjustments.AuditLog)
+
+		admin.POST("/schedule-runs/:run_id/replay", h.schedules.ReplayRun)
+
+		admin.GET("/audit/checkpoint", h.audit.Checkpoint)
+		admin.GET("/audit/verify", h.audit.Verify)
+	}
+
+	router.GET("/cash/v1/openapi.json", h.docs.Spec)
+	router.GET("/cash/v1/docs", h.docs.SwaggerUI)
+
+	return router
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"testing"
+	"users_balance/api/openapi"
+	"users_balance/internal/middleware"
+)
+
+func testRouterHandlers() handlers {
+	return handlers{
+		authenticator: &middleware.Authenticator{},
+		rateLimiter:   &middleware.RateLimiter{},
+	}
+}
+
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	router := newRouter(testRouterHandlers())
+
+	problems, err := openapi.CheckRoutes(router.Routes(), undocumentedRoutes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range problems {
+		t.Error(problem)
+	}
+}
+
+func TestCheckRoutesReportsUndocumentedRoutes(t *testing.T) {
+	router := newRouter(testRouterHandlers())
+	router.GET("/cash/v1/undocumented", func(*gin.Context) {})
+	router.DELETE("/admin/v1/adjustments/:id", func(*gin.Context) {})
+
+	problems, err := openapi.CheckRoutes(router.Routes(), undocumentedRoutes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"DELETE /admin/v1/adjustments/{id} is served but not documented",
+		"GET /cash/v1/undocumented is served but not documented",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("got problems %q, want %q", problems, want)
+	}
+	for i := range want {
+		if problems[i] != want[i] {
+			t.Errorf("got problem %q, want %q", problems[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package archive
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+	"users_balance/internal/interfaces"
+)
+
+// Job creates the partitions of the coming months and moves the months past
+// retention to cold storage every Interval, starting at once so a new month
+// has its partition before it begins.
+type Job struct {
+	Log      *zap.SugaredLogger
+	Service  interfaces.IArchiveService
+	Interval time.Duration
+}
+
+// Run archives every Interval until ctx is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.runOnce(ctx); err != nil {
+			j.Log.Warnf("transactions archive :: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *Job) runOnce(ctx context.Context) error {
+	report, err := j.Service.Archive(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range report.CreatedPartitions {
+		j.Log.Infof("transactions archive :: partition %s created", name)
+	}
+	for _, archived := range report.Archived {
+		j.Log.Infof("transactions archive :: %s, %d transactions, moved to %s", archived.Partition,
+			archived.Transactions, archived.Location)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package archive
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+	"users_balance/internal/models"
+)
+
+// Format is the format of archive files: gzip compressed CSV, a header line
+// then one transaction per line in the order they were made.
+const Format = "csv.gz"
+
+var header = []string{"id", "uuid", "created_at", "operation", "amount", "currency", "who", "description"}
+
+// Writer writes an archive file, Transactions and Amount count what was
+// written.
+type Writer struct {
+	gz  *gzip.Writer
+	csv *csv.Writer
+
+	Transactions int64
+	Amount       float64
+}
+
+func NewWriter(w io.Writer) (*Writer, error) {
+	gz := gzip.NewWriter(w)
+	writer := &Writer{gz: gz, csv: csv.NewWriter(gz)}
+	if err := writer.csv.Write(header); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (w *Writer) Write(userUUID string, trx models.Transaction) error {
+	// amounts are stored as real, printed at that precision
+	err := w.csv.Write([]string{trx.TrxID, userUUID, trx.CreatedAt.UTC().Format(time.RFC3339Nano), trx.Operation,
+		strconv.FormatFloat(trx.Amount, 'f', -1, 32), trx.Currency, trx.Who, trx.Description})
+	if err != nil {
+		return err
+	}
+
+	w.Transactions++
+	w.Amount += trx.Amount
+	return nil
+}
+
+// Close flushes the file, it does not close the underlying writer.
+func (w *Writer) Close() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+
+	return w.gz.Close()
+}
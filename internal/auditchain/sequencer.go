@@ -0,0 +1,34 @@
+package auditchain
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+	"users_balance/internal/interfaces"
+)
+
+// Sequencer extends the audit chain with the balance mutations committed since
+// its last run. Replicas may all run it, they take turns on a database lock.
+type Sequencer struct {
+	Log          *zap.SugaredLogger
+	AuditService interfaces.IAuditService
+	Interval     time.Duration
+}
+
+// Run chains pending links every Interval until ctx is cancelled.
+func (s *Sequencer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.AuditService.Sequence(ctx); err != nil && ctx.Err() == nil {
+			s.Log.Warnf("audit chain :: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package balancecache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+	"users_balance/internal/models"
+)
+
+type entry struct {
+	uuid     string
+	user     models.User
+	cachedAt time.Time
+	// valid is false for a tombstone, kept to remember the invalidation
+	valid bool
+	// invalidated is the clock of the last invalidation of the wallet
+	invalidated uint64
+}
+
+// MemoryStore is a least recently used cache of balances in process memory.
+// Writes of other replicas reach it through the balance hub, those the hub
+// misses while reconnecting and status changes show once the entry expires.
+type MemoryStore struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	// clock counts the invalidations, tokens are its value at a miss
+	clock uint64
+	// evicted is the latest invalidation of an evicted entry, a Set for a
+	// wallet without an entry is refused when its token is older
+	evicted uint64
+}
+
+// NewMemoryStore keeps up to size balances, size must be at least 1.
+func NewMemoryStore(size int, ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, uuid string) (models.User, bool, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[uuid]; ok {
+		e := el.Value.(*entry)
+		if e.valid && time.Since(e.cachedAt) < s.ttl {
+			s.order.MoveToFront(el)
+			user := e.user
+			cachedAt := e.cachedAt
+			user.CachedAt = &cachedAt
+			return user, true, 0, nil
+		}
+	}
+
+	return models.User{}, false, s.clock, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, user models.User, token uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[user.ID]
+	switch {
+	case ok && el.Value.(*entry).invalidated > token:
+		return nil
+	case !ok && s.evicted > token:
+		return nil
+	}
+
+	user.CacheStatus = ""
+	user.CachedAt = nil
+	e := s.put(user.ID)
+	e.user = user
+	e.cachedAt = time.Now()
+	e.valid = true
+
+	return nil
+}
+
+func (s *MemoryStore) Invalidate(_ context.Context, uuids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, uuid := range uuids {
+		s.clock++
+		e := s.put(uuid)
+		e.user = models.User{}
+		e.valid = false
+		e.invalidated = s.clock
+	}
+
+	return nil
+}
+
+// put returns the entry of uuid, added when missing, as the most recently
+// used one.
+func (s *MemoryStore) put(uuid string) *entry {
+	if el, ok := s.entries[uuid]; ok {
+		s.order.MoveToFront(el)
+		return el.Value.(*entry)
+	}
+
+	for s.order.Len() >= s.size {
+		oldest := s.order.Back()
+		e := oldest.Value.(*entry)
+		if e.invalidated > s.evicted {
+			s.evicted = e.invalidated
+		}
+		s.order.Remove(oldest)
+		delete(s.entries, e.uuid)
+	}
+
+	// the wallet may have been invalidated as late as the last eviction
+	e := &entry{uuid: uuid, invalidated: s.evicted}
+	s.entries[uuid] = s.order.PushFront(e)
+	return e
+}
@@ -0,0 +1,120 @@
+package balancecache
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+	"users_balance/internal/models"
+	"users_balance/internal/redis"
+)
+
+// generationGrace keeps the generation of a wallet past the expiry of its
+// balance, longer than any read takes between Get and Set.
+const generationGrace = time.Minute
+
+// setScript stores a balance unless the generation of the wallet moved since
+// the token was read.
+const setScript = `
+local generation = tonumber(redis.call("GET", KEYS[2])) or 0
+if generation ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
+`
+
+// invalidateScript drops a balance and moves the generation of its wallet.
+const invalidateScript = `
+redis.call("DEL", KEYS[1])
+redis.call("INCR", KEYS[2])
+redis.call("PEXPIRE", KEYS[2], ARGV[1])
+return 1
+`
+
+type redisEntry struct {
+	ID       string    `json:"uuid"`
+	Balance  float64   `json:"balance"`
+	Status   string    `json:"status"`
+	CachedAt time.Time `json:"cached_at"`
+}
+
+// RedisStore keeps balances in any server speaking the Redis protocol with Lua
+// scripting, so the invalidations of every replica are seen by all of them.
+// The keys of a wallet share a hash tag and live in one cluster slot.
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewRedisStore(addr string, ttl time.Duration) *RedisStore {
+	return &RedisStore{
+		client: redis.NewClient(addr),
+		ttl:    ttl,
+	}
+}
+
+func (s *RedisStore) Get(ctx context.Context, uuid string) (models.User, bool, uint64, error) {
+	balanceKey, generationKey := keys(uuid)
+	reply, err := s.client.Do(ctx, "MGET", balanceKey, generationKey)
+	if err != nil {
+		return models.User{}, false, 0, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return models.User{}, false, 0, errors.Errorf("redis: unexpected reply %v", reply)
+	}
+
+	if raw, ok := values[0].(string); ok {
+		var e redisEntry
+		if err := json.Unmarshal([]byte(raw), &e); err != nil {
+			return models.User{}, false, 0, errors.Wrap(err, "balance cache entry")
+		}
+		return models.User{ID: e.ID, Balance: e.Balance, Status: e.Status, CachedAt: &e.CachedAt}, true, 0, nil
+	}
+
+	var token uint64
+	if raw, ok := values[1].(string); ok {
+		if token, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			return models.User{}, false, 0, errors.Wrap(err, "balance cache generation")
+		}
+	}
+
+	return models.User{}, false, token, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, user models.User, token uint64) error {
+	data, err := json.Marshal(redisEntry{
+		ID:       user.ID,
+		Balance:  user.Balance,
+		Status:   user.Status,
+		CachedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	balanceKey, generationKey := keys(user.ID)
+	_, err = s.client.Do(ctx, "EVAL", setScript, "2", balanceKey, generationKey,
+		strconv.FormatUint(token, 10), string(data), strconv.FormatInt(s.ttl.Milliseconds(), 10))
+
+	return err
+}
+
+func (s *RedisStore) Invalidate(ctx context.Context, uuids ...string) error {
+	keep := strconv.FormatInt((s.ttl + generationGrace).Milliseconds(), 10)
+	for _, uuid := range uuids {
+		balanceKey, generationKey := keys(uuid)
+		if _, err := s.client.Do(ctx, "EVAL", invalidateScript, "2", balanceKey, generationKey, keep); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func keys(uuid string) (string, string) {
+	return "balance:{" + uuid + "}", "balance:generation:{" + uuid + "}"
+}
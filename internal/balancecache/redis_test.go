@@ -0,0 +1,132 @@
+package balancecache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis speaks enough of the Redis protocol for RedisStore: MGET and EVAL
+// of its two scripts, which it runs atomically like Redis does.
+type fakeRedis struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{listener: listener, values: map[string]string{}}
+	go f.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return f
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.run(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) run(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case len(args) == 3 && args[0] == "MGET":
+		reply := "*2\r\n"
+		for _, key := range args[1:] {
+			if value, ok := f.values[key]; ok {
+				reply += fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply += "$-1\r\n"
+			}
+		}
+		return reply
+
+	case len(args) >= 5 && args[0] == "EVAL" && args[2] == "2":
+		keys, argv := args[3:5], args[5:]
+		switch {
+		case args[1] == setScript && len(argv) == 3:
+			generation, _ := strconv.ParseUint(f.values[keys[1]], 10, 64)
+			if strconv.FormatUint(generation, 10) != argv[0] {
+				return ":0\r\n"
+			}
+			f.values[keys[0]] = argv[1]
+			return ":1\r\n"
+		case args[1] == invalidateScript && len(argv) == 1:
+			delete(f.values, keys[0])
+			generation, _ := strconv.ParseUint(f.values[keys[1]], 10, 64)
+			f.values[keys[1]] = strconv.FormatUint(generation+1, 10)
+			return ":1\r\n"
+		}
+	}
+
+	return "-ERR unsupported command\r\n"
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
+
+func TestRedisStore(t *testing.T) {
+	server := newFakeRedis(t)
+	testStore(t, NewRedisStore(server.listener.Addr().String(), time.Minute))
+}
@@ -0,0 +1,213 @@
+package balancecache
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"sync"
+	"testing"
+	"time"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+// testStore runs the token checks every store has to pass.
+func testStore(t *testing.T, store interfaces.IBalanceCache) {
+	t.Run("SetAfterMiss", func(t *testing.T) {
+		wallet := uuid.NewString()
+		_, hit, token := get(t, store, wallet)
+		if hit {
+			t.Fatal("hit before any Set")
+		}
+
+		set(t, store, models.User{ID: wallet, Balance: 100}, token)
+
+		user, hit, _ := get(t, store, wallet)
+		if !hit || user.Balance != 100 {
+			t.Fatalf("got %+v hit %v, want the balance 100", user, hit)
+		}
+	})
+
+	t.Run("InvalidateDropsBalance", func(t *testing.T) {
+		wallet := uuid.NewString()
+		_, _, token := get(t, store, wallet)
+		set(t, store, models.User{ID: wallet, Balance: 100}, token)
+
+		invalidate(t, store, wallet)
+
+		if _, hit, _ := get(t, store, wallet); hit {
+			t.Fatal("hit after Invalidate")
+		}
+	})
+
+	t.Run("SetRefusedAfterConcurrentInvalidate", func(t *testing.T) {
+		wallet := uuid.NewString()
+		// the read misses and loads the balance from before the write
+		_, _, token := get(t, store, wallet)
+
+		// the write commits and invalidates while the read is loading
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := store.Invalidate(context.Background(), wallet); err != nil {
+				t.Error(err)
+			}
+		}()
+		<-done
+
+		set(t, store, models.User{ID: wallet, Balance: 100}, token)
+
+		if user, hit, _ := get(t, store, wallet); hit {
+			t.Fatalf("cached the balance from before the write: %+v", user)
+		}
+	})
+
+	t.Run("SetAcceptedAfterLaterMiss", func(t *testing.T) {
+		wallet := uuid.NewString()
+		_, _, stale := get(t, store, wallet)
+		invalidate(t, store, wallet)
+
+		_, _, token := get(t, store, wallet)
+		set(t, store, models.User{ID: wallet, Balance: 100}, stale)
+		set(t, store, models.User{ID: wallet, Balance: 150}, token)
+
+		user, hit, _ := get(t, store, wallet)
+		if !hit || user.Balance != 150 {
+			t.Fatalf("got %+v hit %v, want the balance 150", user, hit)
+		}
+	})
+
+	t.Run("InvalidateOtherWalletKeepsToken", func(t *testing.T) {
+		wallet, other := uuid.NewString(), uuid.NewString()
+		_, _, token := get(t, store, wallet)
+		invalidate(t, store, other)
+
+		set(t, store, models.User{ID: wallet, Balance: 100}, token)
+
+		if _, hit, _ := get(t, store, wallet); !hit {
+			t.Fatal("Set refused for the invalidation of another wallet")
+		}
+	})
+
+	t.Run("NoStaleBalanceUnderConcurrentWrites", func(t *testing.T) {
+		wallet := uuid.NewString()
+		// balance stands for the database, writes invalidate after they commit
+		var mu sync.Mutex
+		balance := 0.0
+		load := func() float64 {
+			mu.Lock()
+			defer mu.Unlock()
+			return balance
+		}
+
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					mu.Lock()
+					balance++
+					mu.Unlock()
+					if err := store.Invalidate(context.Background(), wallet); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					_, hit, token, err := store.Get(context.Background(), wallet)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if hit {
+						continue
+					}
+					if err := store.Set(context.Background(), models.User{ID: wallet, Balance: load()}, token); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if user, hit, _ := get(t, store, wallet); hit && user.Balance != load() {
+			t.Fatalf("cached %v after the writes, the balance is %v", user.Balance, load())
+		}
+	})
+}
+
+func get(t *testing.T, store interfaces.IBalanceCache, wallet string) (models.User, bool, uint64) {
+	t.Helper()
+	user, hit, token, err := store.Get(context.Background(), wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user, hit, token
+}
+
+func set(t *testing.T, store interfaces.IBalanceCache, user models.User, token uint64) {
+	t.Helper()
+	if err := store.Set(context.Background(), user, token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func invalidate(t *testing.T, store interfaces.IBalanceCache, wallets ...string) {
+	t.Helper()
+	if err := store.Invalidate(context.Background(), wallets...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(100, time.Minute))
+}
+
+func TestMemoryStoreRefusesSetAfterEvictedInvalidation(t *testing.T) {
+	store := NewMemoryStore(2, time.Minute)
+	wallet := uuid.NewString()
+
+	_, _, token := get(t, store, wallet)
+	invalidate(t, store, wallet)
+	// the tombstone of the invalidation is evicted by two other wallets
+	invalidate(t, store, uuid.NewString(), uuid.NewString())
+
+	set(t, store, models.User{ID: wallet, Balance: 100}, token)
+
+	if user, hit, _ := get(t, store, wallet); hit {
+		t.Fatalf("cached the balance from before the evicted invalidation: %+v", user)
+	}
+}
+
+func TestMemoryStoreAcceptsSetAfterEvictionOfOlderInvalidation(t *testing.T) {
+	store := NewMemoryStore(2, time.Minute)
+	wallet := uuid.NewString()
+
+	invalidate(t, store, wallet)
+	invalidate(t, store, uuid.NewString(), uuid.NewString())
+
+	_, _, token := get(t, store, wallet)
+	set(t, store, models.User{ID: wallet, Balance: 100}, token)
+
+	if _, hit, _ := get(t, store, wallet); !hit {
+		t.Fatal("Set refused for an invalidation older than the token")
+	}
+}
+
+func TestMemoryStoreExpires(t *testing.T) {
+	store := NewMemoryStore(100, 10*time.Millisecond)
+	wallet := uuid.NewString()
+
+	_, _, token := get(t, store, wallet)
+	set(t, store, models.User{ID: wallet, Balance: 100}, token)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, hit, _ := get(t, store, wallet); hit {
+		t.Fatal("hit after the ttl")
+	}
+}
@@ -1,45 +1,646 @@
 package config
 
 import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	ApplicationPort string
 	DBAuthenticationData
 	APIData
+	AuthData
+	RateLimitData
+	FeeData
+	OutboxData
+	WebhookData
+	AccountsData
+	AuditData
+	ReconciliationData
+	SnapshotData
+	BatchData
+	PayoutData
+	ScheduleData
+	GRPCData
+	StreamData
+	IdempotencyData
+	BalanceCacheData
+	ArchiveData
+}
+
+// Secret is a configuration value kept out of logs, it prints masked.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return "[redacted]"
+}
+
+func (s Secret) GoString() string {
+	return s.String()
 }
 
 type APIData struct {
-	Key  string
+	Key  Secret
 	URL  string
 	Path string
 }
 
 type DBAuthenticationData struct {
 	DBAdminUsername string
-	DBAdminPassword string
+	DBAdminPassword Secret
 	DBName          string
 	DBHost          string
 	DBPort          string
-	URI             string
+	URI             Secret
+}
+
+// AuthData holds the API clients allowed to call the cash API and the keys
+// used to verify end-user JWTs.
+type AuthData struct {
+	Clients []APIClient
+	JWTData
+}
+
+// JWTData configures end-user token verification. Tokens are accepted when
+// signed by a key from the JWKS endpoint, the static RSA public key (PEM) or
+// the HS256 secret.
+type JWTData struct {
+	JWKSURL      string
+	RSAPublicKey string
+	HMACSecret   Secret
+	Issuer       string
+	Audience     string
+}
+
+// APIClient is a service allowed to call the API. KeyHash is the hex encoded
+// sha256 of the client's API key, the key itself is never stored. Accounts,
+// when set, are the only wallets the client may read and receive events of.
+type APIClient struct {
+	ID       string   `json:"id"`
+	KeyHash  string   `json:"key_hash"`
+	Scopes   []string `json:"scopes"`
+	Accounts []string `json:"accounts"`
+}
+
+// RateLimitData configures the token bucket limits. Buckets live in process
+// memory unless RedisAddr is set, in which case they are shared by all replicas.
+type RateLimitData struct {
+	Rules     []RateLimitRule
+	RedisAddr string
+}
+
+// RateLimitRule limits requests to Route (a gin route path, "*" for any) made
+// by Client ("*" for any). Key selects what a bucket is kept for: "client" or
+// "user" (the uuid the request targets). Rate is in requests per second. gRPC
+// calls count against the route of their HTTP counterpart.
+type RateLimitRule struct {
+	Route  string  `json:"route"`
+	Client string  `json:"client"`
+	Key    string  `json:"key"`
+	Rate   float64 `json:"rate"`
+	Burst  int     `json:"burst"`
+}
+
+// FeeData configures commissions. Fees are credited to RevenueAccount, no fees
+// are charged while it is empty.
+type FeeData struct {
+	RevenueAccount string
+}
+
+// OutboxData configures the relay of balance events. Publisher is "stdout",
+// "file" or "nats", the relay is off when it is empty. NATSURL may carry
+// credentials. Otherwise NATSUser with NATSPassword, or NATSToken, authenticate
+// to NATS. The NATSTLS fields secure the connection.
+type OutboxData struct {
+	Publisher         string
+	FilePath          string
+	NATSURL           Secret
+	NATSSubjectPrefix string
+	NATSUser          string
+	NATSPassword      Secret
+	NATSToken         Secret
+	NATSTLS           bool
+	NATSCAFile        string
+	NATSCertFile      string
+	NATSKeyFile       string
+	PollInterval      time.Duration
+}
+
+// WebhookData configures delivery of webhooks to partner endpoints. Endpoints
+// must be public addresses unless AllowPrivateTargets, meant for local
+// development, is set.
+type WebhookData struct {
+	MaxAttempts         int
+	BaseBackoff         time.Duration
+	MaxBackoff          time.Duration
+	Timeout             time.Duration
+	PollInterval        time.Duration
+	AllowPrivateTargets bool
+}
+
+// AccountsData controls account lifecycle. With AutoCreate a credit to an
+// unknown uuid opens the account instead of failing.
+type AccountsData struct {
+	AutoCreate bool
+}
+
+// AuditData holds the base64 Ed25519 seed used to sign audit checkpoints.
+// Pending links are chained every SequenceInterval.
+type AuditData struct {
+	SigningKey       Secret
+	SequenceInterval time.Duration
+}
+
+// ReconciliationData schedules the balance reconciliation job, it is off while
+// Interval is zero. With Fix the job writes correction transactions, reports
+// are written to ReportDir as json or csv when it is set.
+type ReconciliationData struct {
+	Interval     time.Duration
+	Fix          bool
+	ReportDir    string
+	ReportFormat string
+}
+
+// SnapshotData schedules the balance snapshots used by point-in-time queries.
+// Snapshots are taken Lag in the past so in-flight transactions are included,
+// the ones taken in the last Verify are checked for transactions committed
+// later still.
+type SnapshotData struct {
+	Interval time.Duration
+	Lag      time.Duration
+	Verify   time.Duration
+}
+
+// BatchData caps the number of items of a batch balance update. Items cost
+// their round trips inside one transaction that keeps every account it touched
+// locked, so batches are kept short.
+type BatchData struct {
+	MaxItems int
+}
+
+// PayoutData configures payout jobs: the size of the worker pool, how often
+// idle workers look for rows and the largest file accepted.
+type PayoutData struct {
+	Workers      int
+	PollInterval time.Duration
+	MaxRows      int
+}
+
+// ScheduleData sets how often the scheduler looks for due schedules, and how
+// often replicas that are not leading try to take over.
+type ScheduleData struct {
+	PollInterval time.Duration
+}
+
+// GRPCData configures the gRPC API, it is served on Port next to the HTTP API
+// and off while Port is empty.
+type GRPCData struct {
+	Port string
+}
+
+// StreamData configures the balance streams. Heartbeat keeps idle streams
+// open through proxies, AllowedOrigins lists the web origins allowed to open a
+// WebSocket, only same origin requests are accepted when it is empty.
+type StreamData struct {
+	Heartbeat      time.Duration
+	AllowedOrigins []string
+}
+
+// IdempotencyData sets how long the response to a request sent with an
+// Idempotency-Key is replayed for, the key can be used again afterwards.
+type IdempotencyData struct {
+	TTL time.Duration
+}
+
+// BalanceCacheData configures the cache of current balances, off while TTL is
+// zero. Balances are kept for TTL in a least recently used cache of Size
+// wallets per replica unless RedisAddr is set, in which case the cache and its
+// invalidations are shared by all replicas.
+type BalanceCacheData struct {
+	TTL       time.Duration
+	Size      int
+	RedisAddr string
+}
+
+// ArchiveData configures the transactions archive. Every Interval the months
+// more than Retention months before the current one are moved to URL, a
+// file:///dir or s3://bucket/prefix. Archival is off while URL is nil, the
+// partitions of the coming months are created all the same. S3Endpoint is the
+// S3 compatible server, AWS in S3Region when it is not set.
+type ArchiveData struct {
+	URL               *url.URL
+	Retention         int
+	Interval          time.Duration
+	S3Endpoint        *url.URL
+	S3Region          string
+	S3AccessKeyID     string
+	S3SecretAccessKey Secret
 }
 
 func New() (*Config, error) {
+	clients, err := parseAPIClients(os.Getenv("API_CLIENTS"))
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimits, err := parseRateLimitRules(os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		return nil, err
+	}
+
+	outboxPollInterval, err := parseDuration("OUTBOX_POLL_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	natsTLS, err := parseBool("OUTBOX_NATS_TLS")
+	if err != nil {
+		return nil, err
+	}
+
+	auditSequenceInterval, err := parseDuration("AUDIT_SEQUENCE_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := parseWebhookData()
+	if err != nil {
+		return nil, err
+	}
+
+	autoCreate, err := parseBool("ACCOUNTS_AUTO_CREATE")
+	if err != nil {
+		return nil, err
+	}
+
+	reconciliation, err := parseReconciliationData()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotInterval, err := parseDuration("BALANCE_SNAPSHOT_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotLag, err := parseDuration("BALANCE_SNAPSHOT_LAG", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotVerify, err := parseDuration("BALANCE_SNAPSHOT_VERIFY", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	batchMaxItems, err := parseInt("BATCH_MAX_ITEMS", 100)
+	if err != nil {
+		return nil, err
+	}
+
+	payouts, err := parsePayoutData()
+	if err != nil {
+		return nil, err
+	}
+
+	schedulePollInterval, err := parseDuration("SCHEDULER_POLL_INTERVAL", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	streamHeartbeat, err := parseDuration("STREAM_HEARTBEAT", 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	idempotencyTTL, err := parseDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	balanceCache, err := parseBalanceCacheData()
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := parseArchiveData()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
 		ApplicationPort: os.Getenv("PORT"),
 		DBAuthenticationData: DBAuthenticationData{
 			DBAdminUsername: os.Getenv("DB_ADMIN_USERNAME"),
-			DBAdminPassword: os.Getenv("DB_ADMIN_PASSWORD"),
+			DBAdminPassword: Secret(os.Getenv("DB_ADMIN_PASSWORD")),
 			DBHost:          os.Getenv("DB_HOST"),
 			DBPort:          os.Getenv("DB_PORT"),
 			DBName:          os.Getenv("DB_NAME"),
-			URI:             os.Getenv("POSTGRES_URI"),
+			URI:             Secret(os.Getenv("POSTGRES_URI")),
 		},
 		APIData: APIData{
-			Key:  os.Getenv("EXCHANGE_API_KEY"),
+			Key:  Secret(os.Getenv("EXCHANGE_API_KEY")),
 			URL:  os.Getenv("EXCHANGE_API_URL"),
 			Path: os.Getenv("EXCHANGE_API_PATH"),
 		},
+		AuthData: AuthData{
+			Clients: clients,
+			JWTData: JWTData{
+				JWKSURL:      os.Getenv("JWT_JWKS_URL"),
+				RSAPublicKey: os.Getenv("JWT_RSA_PUBLIC_KEY"),
+				HMACSecret:   Secret(os.Getenv("JWT_HMAC_SECRET")),
+				Issuer:       os.Getenv("JWT_ISSUER"),
+				Audience:     os.Getenv("JWT_AUDIENCE"),
+			},
+		},
+		RateLimitData: RateLimitData{
+			Rules:     rateLimits,
+			RedisAddr: os.Getenv("RATE_LIMIT_REDIS_ADDR"),
+		},
+		FeeData: FeeData{
+			RevenueAccount: os.Getenv("REVENUE_ACCOUNT_UUID"),
+		},
+		OutboxData: OutboxData{
+			Publisher:         os.Getenv("OUTBOX_PUBLISHER"),
+			FilePath:          os.Getenv("OUTBOX_FILE"),
+			NATSURL:           Secret(os.Getenv("OUTBOX_NATS_URL")),
+			NATSSubjectPrefix: os.Getenv("OUTBOX_NATS_SUBJECT_PREFIX"),
+			NATSUser:          os.Getenv("OUTBOX_NATS_USER"),
+			NATSPassword:      Secret(os.Getenv("OUTBOX_NATS_PASSWORD")),
+			NATSToken:         Secret(os.Getenv("OUTBOX_NATS_TOKEN")),
+			NATSTLS:           natsTLS,
+			NATSCAFile:        os.Getenv("OUTBOX_NATS_CA_FILE"),
+			NATSCertFile:      os.Getenv("OUTBOX_NATS_CERT_FILE"),
+			NATSKeyFile:       os.Getenv("OUTBOX_NATS_KEY_FILE"),
+			PollInterval:      outboxPollInterval,
+		},
+		WebhookData: webhooks,
+		AccountsData: AccountsData{
+			AutoCreate: autoCreate,
+		},
+		AuditData: AuditData{
+			SigningKey:       Secret(os.Getenv("AUDIT_SIGNING_KEY")),
+			SequenceInterval: auditSequenceInterval,
+		},
+		ReconciliationData: reconciliation,
+		SnapshotData: SnapshotData{
+			Interval: snapshotInterval,
+			Lag:      snapshotLag,
+			Verify:   snapshotVerify,
+		},
+		BatchData: BatchData{
+			MaxItems: batchMaxItems,
+		},
+		PayoutData: payouts,
+		ScheduleData: ScheduleData{
+			PollInterval: schedulePollInterval,
+		},
+		GRPCData: GRPCData{
+			Port: os.Getenv("GRPC_PORT"),
+		},
+		StreamData: StreamData{
+			Heartbeat:      streamHeartbeat,
+			AllowedOrigins: parseList(os.Getenv("STREAM_ALLOWED_ORIGINS")),
+		},
+		IdempotencyData: IdempotencyData{
+			TTL: idempotencyTTL,
+		},
+		BalanceCacheData: balanceCache,
+		ArchiveData:      archive,
 	}, nil
 }
+
+// parseAPIClients reads a JSON list of clients, e.g.
+// [{"id":"payroll","key_hash":"<sha256 hex>","scopes":["balance:credit"]}]
+func parseAPIClients(raw string) ([]APIClient, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var clients []APIClient
+	if err := json.Unmarshal([]byte(raw), &clients); err != nil {
+		return nil, errors.Wrap(err, "API_CLIENTS")
+	}
+
+	return clients, nil
+}
+
+// parseRateLimitRules reads a JSON list of rules, e.g.
+// [{"route":"/cash/v1/balance/transfer","client":"*","key":"user","rate":1,"burst":5}]
+func parseRateLimitRules(raw string) ([]RateLimitRule, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var rules []RateLimitRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, errors.Wrap(err, "RATE_LIMITS")
+	}
+
+	for _, rule := range rules {
+		if rule.Rate <= 0 || rule.Burst <= 0 {
+			return nil, errors.Errorf("RATE_LIMITS: rule for %s needs positive rate and burst", rule.Route)
+		}
+		if rule.Key != "client" && rule.Key != "user" {
+			return nil, errors.Errorf("RATE_LIMITS: unknown key %q", rule.Key)
+		}
+	}
+
+	return rules, nil
+}
+
+func parseWebhookData() (WebhookData, error) {
+	var data WebhookData
+	var err error
+
+	if data.MaxAttempts, err = parseInt("WEBHOOK_MAX_ATTEMPTS", 8); err != nil {
+		return WebhookData{}, err
+	}
+	if data.BaseBackoff, err = parseDuration("WEBHOOK_BASE_BACKOFF", 10*time.Second); err != nil {
+		return WebhookData{}, err
+	}
+	if data.MaxBackoff, err = parseDuration("WEBHOOK_MAX_BACKOFF", time.Hour); err != nil {
+		return WebhookData{}, err
+	}
+	if data.Timeout, err = parseDuration("WEBHOOK_TIMEOUT", 10*time.Second); err != nil {
+		return WebhookData{}, err
+	}
+	if data.PollInterval, err = parseDuration("WEBHOOK_POLL_INTERVAL", 2*time.Second); err != nil {
+		return WebhookData{}, err
+	}
+	if data.AllowPrivateTargets, err = parseBool("WEBHOOK_ALLOW_PRIVATE_TARGETS"); err != nil {
+		return WebhookData{}, err
+	}
+
+	return data, nil
+}
+
+func parseReconciliationData() (ReconciliationData, error) {
+	data := ReconciliationData{
+		ReportDir:    os.Getenv("RECONCILE_REPORT_DIR"),
+		ReportFormat: os.Getenv("RECONCILE_REPORT_FORMAT"),
+	}
+	var err error
+
+	if data.Interval, err = parseDuration("RECONCILE_INTERVAL", 0); err != nil {
+		return ReconciliationData{}, err
+	}
+	if data.Fix, err = parseBool("RECONCILE_FIX"); err != nil {
+		return ReconciliationData{}, err
+	}
+	if data.ReportFormat != "" && data.ReportFormat != "json" && data.ReportFormat != "csv" {
+		return ReconciliationData{}, errors.Errorf("RECONCILE_REPORT_FORMAT: unknown format %q", data.ReportFormat)
+	}
+
+	return data, nil
+}
+
+func parsePayoutData() (PayoutData, error) {
+	var data PayoutData
+	var err error
+
+	if data.Workers, err = parseInt("PAYOUT_WORKERS", 4); err != nil {
+		return PayoutData{}, err
+	}
+	if data.PollInterval, err = parseDuration("PAYOUT_POLL_INTERVAL", time.Second); err != nil {
+		return PayoutData{}, err
+	}
+	if data.MaxRows, err = parseInt("PAYOUT_MAX_ROWS", 100000); err != nil {
+		return PayoutData{}, err
+	}
+
+	return data, nil
+}
+
+func parseBalanceCacheData() (BalanceCacheData, error) {
+	data := BalanceCacheData{
+		RedisAddr: os.Getenv("BALANCE_CACHE_REDIS_ADDR"),
+	}
+	var err error
+
+	if data.TTL, err = parseDuration("BALANCE_CACHE_TTL", 0); err != nil {
+		return BalanceCacheData{}, err
+	}
+	if data.Size, err = parseInt("BALANCE_CACHE_SIZE", 100000); err != nil {
+		return BalanceCacheData{}, err
+	}
+	// the memory store needs room for at least the entry it adds
+	if data.Size < 1 {
+		return BalanceCacheData{}, errors.Errorf("BALANCE_CACHE_SIZE must be at least 1")
+	}
+
+	return data, nil
+}
+
+func parseArchiveData() (ArchiveData, error) {
+	data := ArchiveData{
+		S3Region:          os.Getenv("ARCHIVE_S3_REGION"),
+		S3AccessKeyID:     os.Getenv("ARCHIVE_S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey: Secret(os.Getenv("ARCHIVE_S3_SECRET_ACCESS_KEY")),
+	}
+	var err error
+
+	if data.Retention, err = parseInt("TRANSACTIONS_RETENTION_MONTHS", 24); err != nil {
+		return ArchiveData{}, err
+	}
+	if data.Interval, err = parseDuration("TRANSACTIONS_ARCHIVE_INTERVAL", 24*time.Hour); err != nil {
+		return ArchiveData{}, err
+	}
+	if data.S3Region == "" {
+		data.S3Region = "us-east-1"
+	}
+
+	if raw := os.Getenv("TRANSACTIONS_ARCHIVE_URL"); raw != "" {
+		if data.URL, err = url.Parse(raw); err != nil {
+			return ArchiveData{}, errors.Wrap(err, "TRANSACTIONS_ARCHIVE_URL")
+		}
+		switch {
+		case data.URL.Scheme == "file" && data.URL.Path != "":
+		case data.URL.Scheme == "s3" && data.URL.Host != "":
+		default:
+			return ArchiveData{}, errors.Errorf("TRANSACTIONS_ARCHIVE_URL: expected file:///dir or s3://bucket/prefix, got %q", raw)
+		}
+	}
+
+	endpoint := os.Getenv("ARCHIVE_S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://s3." + data.S3Region + ".amazonaws.com"
+	}
+	if data.S3Endpoint, err = url.Parse(endpoint); err != nil {
+		return ArchiveData{}, errors.Wrap(err, "ARCHIVE_S3_ENDPOINT")
+	}
+
+	return data, nil
+}
+
+// parseList reads a comma separated list.
+func parseList(raw string) []string {
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// parseBool reads a boolean from the env, false when unset.
+func parseBool(name string) (bool, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, errors.Wrap(err, name)
+	}
+
+	return b, nil
+}
+
+// parseInt reads a positive integer from the env, def when unset.
+func parseInt(name string, def int) (int, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.Wrap(err, name)
+	}
+	if n <= 0 {
+		return 0, errors.Errorf("%s must be positive", name)
+	}
+
+	return n, nil
+}
+
+// parseDuration reads a duration like "500ms" from the env, def when unset.
+func parseDuration(name string, def time.Duration) (time.Duration, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, errors.Wrap(err, name)
+	}
+	if d <= 0 {
+		return 0, errors.Errorf("%s must be positive", name)
+	}
+
+	return d, nil
+}
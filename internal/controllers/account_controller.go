@@ -0,0 +1,110 @@
+package balance_controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"net/http"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+type AccountController struct {
+	Log            *zap.SugaredLogger
+	AccountService interfaces.IAccountService
+	Validator      *validator.Validate
+}
+
+func (c *AccountController) CreateAccount(ctx *gin.Context) {
+	var request models.NewAccount
+
+	err := ctx.BindJSON(&request)
+	if err != nil {
+		c.Log.Warn(err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "bad json :/"})
+		return
+	}
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.AccountService.CreateAccount(request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, resp)
+}
+
+func (c *AccountController) GetAccount(ctx *gin.Context) {
+	c.handleAccount(ctx, c.AccountService.GetAccount)
+}
+
+func (c *AccountController) FreezeAccount(ctx *gin.Context) {
+	c.handleAccount(ctx, c.AccountService.FreezeAccount)
+}
+
+func (c *AccountController) UnfreezeAccount(ctx *gin.Context) {
+	c.handleAccount(ctx, c.AccountService.UnfreezeAccount)
+}
+
+func (c *AccountController) CloseAccount(ctx *gin.Context) {
+	c.handleAccount(ctx, c.AccountService.CloseAccount)
+}
+
+func (c *AccountController) SetShards(ctx *gin.Context) {
+	var request models.AccountShards
+
+	err := ctx.BindJSON(&request)
+	if err != nil {
+		c.Log.Warn(err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "bad json :/"})
+		return
+	}
+	request.UserID = ctx.Param("uuid")
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.AccountService.SetShards(request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// handleAccount runs an action on the account addressed by the :uuid param.
+func (c *AccountController) handleAccount(ctx *gin.Context, action func(string) (models.Account, error)) {
+	uuid := ctx.Param("uuid")
+	if err := c.Validator.Var(uuid, "required,uuid"); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := action(uuid)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,156 @@
+package balance_controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/middleware"
+	"users_balance/internal/models"
+)
+
+type AdjustmentController struct {
+	Log               *zap.SugaredLogger
+	AdjustmentService interfaces.IAdjustmentService
+	Validator         *validator.Validate
+}
+
+func (c *AdjustmentController) Propose(ctx *gin.Context) {
+	var request models.AdjustmentProposal
+
+	err := ctx.BindJSON(&request)
+	if err != nil {
+		c.Log.Warn(err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "bad json :/"})
+		return
+	}
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.AdjustmentService.Propose(middleware.ClientID(ctx), request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, resp)
+}
+
+func (c *AdjustmentController) List(ctx *gin.Context) {
+	values := ctx.Request.URL.Query()
+
+	limit, _ := strconv.ParseInt(values.Get("limit"), 10, 64)
+	offset, _ := strconv.ParseInt(values.Get("offset"), 10, 64)
+	request := models.AdjustmentsListRequest{
+		Status: values.Get("status"),
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.AdjustmentService.List(request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *AdjustmentController) Get(ctx *gin.Context) {
+	id, ok := c.adjustmentID(ctx)
+	if !ok {
+		return
+	}
+
+	resp, err := c.AdjustmentService.Get(id)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *AdjustmentController) Approve(ctx *gin.Context) {
+	c.review(ctx, c.AdjustmentService.Approve)
+}
+
+func (c *AdjustmentController) Reject(ctx *gin.Context) {
+	c.review(ctx, c.AdjustmentService.Reject)
+}
+
+func (c *AdjustmentController) AuditLog(ctx *gin.Context) {
+	id, ok := c.adjustmentID(ctx)
+	if !ok {
+		return
+	}
+
+	resp, err := c.AdjustmentService.AuditLog(id)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *AdjustmentController) review(ctx *gin.Context, action func(string, string, models.AdjustmentReview) (models.ManualAdjustment, error)) {
+	id, ok := c.adjustmentID(ctx)
+	if !ok {
+		return
+	}
+
+	// the review comment is optional, so is the body
+	var request models.AdjustmentReview
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.BindJSON(&request); err != nil {
+			c.Log.Warn(err.Error())
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": "bad json :/"})
+			return
+		}
+	}
+
+	resp, err := action(middleware.ClientID(ctx), id, request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *AdjustmentController) adjustmentID(ctx *gin.Context) (string, bool) {
+	id := ctx.Param("id")
+	if err := c.Validator.Var(id, "required,uuid"); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return "", false
+	}
+
+	return id, true
+}
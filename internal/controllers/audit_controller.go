@@ -0,0 +1,37 @@
+package balance_controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"users_balance/internal/interfaces"
+)
+
+type AuditController struct {
+	Log          *zap.SugaredLogger
+	AuditService interfaces.IAuditService
+}
+
+func (c *AuditController) Checkpoint(ctx *gin.Context) {
+	resp, err := c.AuditService.Checkpoint()
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *AuditController) Verify(ctx *gin.Context) {
+	resp, err := c.AuditService.Verify(ctx.Request.Context())
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
@@ -1,16 +1,27 @@
 package balance_controllers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
+	"time"
 	er "users_balance/internal/errors"
 	"users_balance/internal/interfaces"
+	"users_balance/internal/middleware"
 	"users_balance/internal/models"
+	"users_balance/internal/statement"
 )
 
+const statementDateLayout = "2006-01-02"
+
+// CacheHeader tells whether a balance was served from the balance cache.
+const CacheHeader = "X-Cache"
+
 type UserBalanceController struct {
 	Log                *zap.SugaredLogger
 	UserBalanceService interfaces.IUserBalanceService
@@ -31,32 +42,54 @@ func (c *UserBalanceController) GetUserBalance(ctx *gin.Context) {
 		return
 	}
 
-	resp, err := c.UserBalanceService.GetUserBalance(request.ID, request.Currency)
+	if raw := values.Get("at"); raw != "" {
+		at, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.Log.Infof("validation : %s", err.Error())
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+			return
+		}
+		request.At = &at
+	}
+
+	resp, err := c.UserBalanceService.GetUserBalance(request.ID, request.Currency, request.At)
 	if err != nil {
 		statusCode := ResolveErrorCode(err)
 		c.Log.Infof(err.Error())
-		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		ctx.JSON(statusCode, errorResponse(err))
 		return
 	}
 
+	if resp.CacheStatus != "" {
+		ctx.Header(CacheHeader, resp.CacheStatus)
+	}
+	if resp.CachedAt != nil {
+		ctx.Header("Age", strconv.Itoa(int(time.Since(*resp.CachedAt).Seconds())))
+	}
 	ctx.JSON(http.StatusOK, resp)
 }
 
 func (c *UserBalanceController) GetTransactionsList(ctx *gin.Context) {
 	values := ctx.Request.URL.Query()
 
-	limit, err := strconv.ParseInt(values.Get("limit"), 10, 64)
-	offset, err := strconv.ParseInt(values.Get("offset"), 10, 54)
+	limit, _ := strconv.ParseInt(values.Get("limit"), 10, 64)
+	var offset int64
+	var offsetErr error
+	if raw := values.Get("offset"); raw != "" {
+		offset, offsetErr = strconv.ParseInt(raw, 10, 64)
+	}
+	loc, locErr := parseLocation(values.Get("tz"))
 	request := models.TransactionsListRequest{
-		UserID: values.Get("uuid"),
-		Limit:  limit,
-		Offset: offset,
-		SortBy: values.Get("sort_by"),
-		Cmp:    values.Get("cmp"),
+		UserID:   values.Get("uuid"),
+		Limit:    limit,
+		Offset:   offset,
+		SortBy:   values.Get("sort_by"),
+		Cmp:      values.Get("cmp"),
+		Location: loc,
 	}
 
-	if err := c.Validator.Struct(request); err != nil {
-		c.Log.Info("validation : %s", err.Error())
+	if err := c.Validator.Struct(request); err != nil || offsetErr != nil || locErr != nil {
+		c.Log.Infof("validation : transactions list %v", values)
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
 		return
 	}
@@ -72,6 +105,74 @@ func (c *UserBalanceController) GetTransactionsList(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, resp)
 }
 
+// parseLocation resolves the "tz" parameter, an IANA zone name, transaction
+// times are given in UTC without it.
+func parseLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	return time.LoadLocation(name)
+}
+
+// GetStatement renders the statement of the days from to to as PDF (the
+// default) or CSV.
+func (c *UserBalanceController) GetStatement(ctx *gin.Context) {
+	values := ctx.Request.URL.Query()
+
+	loc, locErr := parseLocation(values.Get("tz"))
+	if locErr != nil {
+		loc = time.UTC
+	}
+	from, fromErr := time.ParseInLocation(statementDateLayout, values.Get("from"), loc)
+	to, toErr := time.ParseInLocation(statementDateLayout, values.Get("to"), loc)
+	request := models.StatementRequest{
+		UserID:   values.Get("uuid"),
+		From:     from,
+		To:       to,
+		Format:   values.Get("format"),
+		Location: loc,
+	}
+
+	err := c.Validator.Struct(request)
+	if err != nil || locErr != nil || fromErr != nil || toErr != nil || to.Before(from) {
+		c.Log.Infof("validation : statement %v", values)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.UserBalanceService.GetStatement(request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, errorResponse(err))
+		return
+	}
+
+	if request.Format == "" {
+		request.Format = models.StatementPDF
+	}
+
+	var buf bytes.Buffer
+	contentType := "application/pdf"
+	if request.Format == models.StatementCSV {
+		contentType = "text/csv"
+		err = statement.WriteCSV(&buf, resp)
+	} else {
+		err = statement.WritePDF(&buf, resp)
+	}
+	if err != nil {
+		c.Log.Infof(err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s-%s.%s", request.UserID, from.Format(statementDateLayout),
+		to.Format(statementDateLayout), request.Format)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	ctx.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
 func (c *UserBalanceController) UpdateAccount(ctx *gin.Context) {
 	var request models.UserBalanceUpdate
 
@@ -82,6 +183,7 @@ func (c *UserBalanceController) UpdateAccount(ctx *gin.Context) {
 			"message": "bad json :/"})
 		return
 	}
+	request.Who = middleware.ClientID(ctx)
 
 	if err := c.Validator.Struct(request); err != nil {
 		c.Log.Infof("validation : %s", err.Error())
@@ -89,17 +191,83 @@ func (c *UserBalanceController) UpdateAccount(ctx *gin.Context) {
 		return
 	}
 
+	scope := middleware.ScopeBalanceCredit
+	if request.Amount < 0 {
+		scope = middleware.ScopeBalanceDebit
+	}
+	if !middleware.HasScope(ctx, scope) {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": er.ErrForbidden.Error()})
+		return
+	}
+
 	resp, err := c.UserBalanceService.UpdateAccount(request)
 	if err != nil {
 		statusCode := ResolveErrorCode(err)
 		c.Log.Infof(err.Error())
-		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		ctx.JSON(statusCode, errorResponse(err))
 		return
 	}
 
 	ctx.JSON(http.StatusOK, resp)
 }
 
+// BatchUpdate applies several balance updates. The response holds a result per
+// item, an all or nothing batch that failed is answered with the status of the
+// failing item.
+func (c *UserBalanceController) BatchUpdate(ctx *gin.Context) {
+	var request models.BatchUpdateRequest
+
+	err := ctx.BindJSON(&request)
+	if err != nil {
+		c.Log.Warn(err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "bad json :/"})
+		return
+	}
+
+	who := middleware.ClientID(ctx)
+	for i := range request.Items {
+		request.Items[i].Who = who
+
+		scope := middleware.ScopeBalanceCredit
+		if request.Items[i].Amount < 0 {
+			scope = middleware.ScopeBalanceDebit
+		}
+		if !middleware.HasScope(ctx, scope) {
+			ctx.JSON(http.StatusForbidden, gin.H{"message": er.ErrForbidden.Error()})
+			return
+		}
+	}
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.UserBalanceService.BatchUpdate(request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	statusCode := http.StatusOK
+	for i, result := range resp.Results {
+		if result.Err == nil {
+			continue
+		}
+		resp.Results[i].Message = result.Err.Error()
+		resp.Results[i].Code = ResolveErrorCode(result.Err)
+		if !resp.Committed {
+			statusCode = resp.Results[i].Code
+		}
+	}
+
+	ctx.JSON(statusCode, resp)
+}
+
 func (c *UserBalanceController) Transfer(ctx *gin.Context) {
 	var request models.Transfer
 
@@ -110,6 +278,7 @@ func (c *UserBalanceController) Transfer(ctx *gin.Context) {
 			"message": "bad json :/"})
 		return
 	}
+	request.Who = middleware.ClientID(ctx)
 
 	if err := c.Validator.Struct(request); err != nil {
 		c.Log.Infof("validation : %s", err.Error())
@@ -121,7 +290,7 @@ func (c *UserBalanceController) Transfer(ctx *gin.Context) {
 	if err != nil {
 		statusCode := ResolveErrorCode(err)
 		c.Log.Infof(err.Error())
-		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		ctx.JSON(statusCode, errorResponse(err))
 		return
 	}
 
@@ -129,14 +298,75 @@ func (c *UserBalanceController) Transfer(ctx *gin.Context) {
 }
 
 func ResolveErrorCode(err error) int {
+	if errors.Is(err, er.ErrLimitExceeded) {
+		return http.StatusUnprocessableEntity
+	}
+	if errors.Is(err, er.ErrBadPayoutFile) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, er.ErrArchived) {
+		return http.StatusGone
+	}
+
 	switch err {
 	case er.ErrNotFound:
 		return http.StatusNotFound
-	case er.ErrInsufficientFunds:
-		return http.StatusOK
-	case er.ErrNegativeCreate:
+	case er.ErrInsufficientFunds, er.ErrNegativeBalance:
+		return http.StatusUnprocessableEntity
+	case er.ErrNegativeCreate, er.ErrBadRequest, er.ErrWebhookURL, er.ErrWebhookTarget:
 		return http.StatusBadRequest
+	case er.ErrUnauthorized:
+		return http.StatusUnauthorized
+	case er.ErrForbidden:
+		return http.StatusForbidden
+	case er.ErrLimitsNotFound, er.ErrSubscriptionNotFound, er.ErrDeliveryNotFound:
+		return http.StatusNotFound
+	case er.ErrAccountExists, er.ErrAccountFrozen, er.ErrAccountClosed, er.ErrAccountNotEmpty, er.ErrAccountState:
+		return http.StatusConflict
+	case er.ErrAdjustmentNotFound:
+		return http.StatusNotFound
+	case er.ErrAdjustmentReviewed, er.ErrSameOperator:
+		return http.StatusConflict
+	case er.ErrNoSigningKey:
+		return http.StatusServiceUnavailable
+	case er.ErrBatchTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case er.ErrPayoutJobNotFound, er.ErrScheduleNotFound:
+		return http.StatusNotFound
+	case er.ErrScheduleState, er.ErrRunNotReplayable, er.ErrRunReplayed:
+		return http.StatusConflict
+	case er.ErrRunNotFound:
+		return http.StatusNotFound
 	default:
 		return http.StatusInternalServerError
 	}
 }
+
+// errorResponse adds the broken rule and the remaining allowance to spending
+// limit errors, and the end of the archived history to archived errors.
+func errorResponse(err error) gin.H {
+	var limitErr *er.LimitExceededError
+	if errors.As(err, &limitErr) {
+		return gin.H{
+			"message":   err.Error(),
+			"code":      "limit_exceeded",
+			"rule":      limitErr.Rule,
+			"remaining": limitErr.Remaining,
+		}
+	}
+
+	var archivedErr *er.ArchivedError
+	if errors.As(err, &archivedErr) {
+		return gin.H{
+			"message":         err.Error(),
+			"code":            "archived",
+			"archived_before": archivedErr.Before.UTC(),
+		}
+	}
+
+	if err == er.ErrInsufficientFunds || err == er.ErrNegativeBalance {
+		return gin.H{"message": err.Error(), "code": "insufficient_funds"}
+	}
+
+	return gin.H{"message": err.Error()}
+}
@@ -0,0 +1,36 @@
+package balance_controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"users_balance/api/openapi"
+)
+
+// swaggerUIPage renders the spec with Swagger UI, loaded from a CDN.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Cash API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@4.5.0/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@4.5.0/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "` + openapi.BasePath + `/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// DocsController serves the OpenAPI spec, it needs no authentication.
+type DocsController struct{}
+
+func (c *DocsController) Spec(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/json", openapi.Spec)
+}
+
+func (c *DocsController) SwaggerUI(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
@@ -0,0 +1,138 @@
+package balance_controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"net/http"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+type SpendingLimitsController struct {
+	Log           *zap.SugaredLogger
+	LimitsService interfaces.ISpendingLimitsService
+	Validator     *validator.Validate
+}
+
+func (c *SpendingLimitsController) GetLimits(ctx *gin.Context) {
+	subjectType, subject, ok := c.limitsSubject(ctx)
+	if !ok {
+		return
+	}
+
+	resp, err := c.LimitsService.GetLimits(subjectType, subject)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *SpendingLimitsController) SetLimits(ctx *gin.Context) {
+	subjectType, subject, ok := c.limitsSubject(ctx)
+	if !ok {
+		return
+	}
+
+	var request models.SpendingLimits
+	err := ctx.BindJSON(&request)
+	if err != nil {
+		c.Log.Warn(err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "bad json :/"})
+		return
+	}
+	request.SubjectType = subjectType
+	request.Subject = subject
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.LimitsService.SetLimits(request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *SpendingLimitsController) DeleteLimits(ctx *gin.Context) {
+	subjectType, subject, ok := c.limitsSubject(ctx)
+	if !ok {
+		return
+	}
+
+	err := c.LimitsService.DeleteLimits(subjectType, subject)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *SpendingLimitsController) SetUserTier(ctx *gin.Context) {
+	var request models.UserTier
+
+	err := ctx.BindJSON(&request)
+	if err != nil {
+		c.Log.Warn(err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "bad json :/"})
+		return
+	}
+	request.UserID = ctx.Param("uuid")
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	err = c.LimitsService.SetUserTier(request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, request)
+}
+
+// limitsSubject reads /limits/:subject_type/:subject, user subjects must be uuids.
+func (c *SpendingLimitsController) limitsSubject(ctx *gin.Context) (string, string, bool) {
+	subjectType := ctx.Param("subject_type")
+	subject := ctx.Param("subject")
+
+	var err error
+	switch subjectType {
+	case models.LimitSubjectUser:
+		err = c.Validator.Var(subject, "required,uuid")
+	case models.LimitSubjectTier:
+		err = c.Validator.Var(subject, "required")
+	default:
+		err = er.ErrBadRequest
+	}
+
+	if err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return "", "", false
+	}
+
+	return subjectType, subject, true
+}
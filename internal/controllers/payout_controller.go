@@ -0,0 +1,69 @@
+package balance_controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/middleware"
+)
+
+type PayoutController struct {
+	Log           *zap.SugaredLogger
+	PayoutService interfaces.IPayoutService
+}
+
+// CreateJob accepts the payout file either as the "file" field of a multipart
+// form or as the raw request body.
+func (c *PayoutController) CreateJob(ctx *gin.Context) {
+	var file io.Reader = ctx.Request.Body
+	if header, err := ctx.FormFile("file"); err == nil {
+		f, err := header.Open()
+		if err != nil {
+			c.Log.Warn(err.Error())
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadPayoutFile.Error()})
+			return
+		}
+		defer f.Close()
+		file = f
+	}
+
+	resp, err := c.PayoutService.CreateJob(middleware.ClientID(ctx), file)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+
+		var fileErr *er.PayoutFileError
+		if errors.As(err, &fileErr) {
+			ctx.JSON(statusCode, gin.H{"message": err.Error(), "errors": fileErr.Lines})
+			return
+		}
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, resp)
+}
+
+func (c *PayoutController) GetJob(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.PayoutService.GetJob(id, middleware.ClientID(ctx))
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,203 @@
+package balance_controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/middleware"
+	"users_balance/internal/models"
+)
+
+const defaultRunsLimit = 20
+
+type ScheduleController struct {
+	Log             *zap.SugaredLogger
+	ScheduleService interfaces.IScheduleService
+	Validator       *validator.Validate
+}
+
+// CreateSchedule needs the scope the schedule will use when it runs: transfer
+// for transfers, credit or debit for updates depending on the amount sign.
+func (c *ScheduleController) CreateSchedule(ctx *gin.Context) {
+	var request models.ScheduleRequest
+
+	err := ctx.BindJSON(&request)
+	if err != nil {
+		c.Log.Warn(err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "bad json :/"})
+		return
+	}
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	scope := middleware.ScopeTransfer
+	if request.Kind == models.ScheduleKindUpdate {
+		scope = middleware.ScopeBalanceCredit
+		if request.Amount < 0 {
+			scope = middleware.ScopeBalanceDebit
+		}
+	}
+	if !middleware.HasScope(ctx, scope) {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": er.ErrForbidden.Error()})
+		return
+	}
+
+	resp, err := c.ScheduleService.CreateSchedule(middleware.ClientID(ctx), request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, resp)
+}
+
+func (c *ScheduleController) ListSchedules(ctx *gin.Context) {
+	resp, err := c.ScheduleService.ListSchedules(middleware.ClientID(ctx))
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *ScheduleController) GetSchedule(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if err := c.Validator.Var(id, "required,uuid"); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.ScheduleService.GetSchedule(id, middleware.ClientID(ctx))
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// UpdateSchedule changes the amount, description or retry policy of a
+// schedule, or pauses and resumes it.
+func (c *ScheduleController) UpdateSchedule(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if err := c.Validator.Var(id, "required,uuid"); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	var request models.ScheduleUpdate
+
+	err := ctx.BindJSON(&request)
+	if err != nil {
+		c.Log.Warn(err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "bad json :/"})
+		return
+	}
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.ScheduleService.UpdateSchedule(id, middleware.ClientID(ctx), request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *ScheduleController) CancelSchedule(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if err := c.Validator.Var(id, "required,uuid"); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.ScheduleService.CancelSchedule(id, middleware.ClientID(ctx))
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *ScheduleController) ListRuns(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if err := c.Validator.Var(id, "required,uuid"); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	values := ctx.Request.URL.Query()
+
+	limit := int64(defaultRunsLimit)
+	if raw := values.Get("limit"); raw != "" {
+		limit, _ = strconv.ParseInt(raw, 10, 64)
+	}
+	offset, _ := strconv.ParseInt(values.Get("offset"), 10, 64)
+	if limit < 1 || limit > 100 || offset < 0 {
+		c.Log.Infof("validation : limit %d offset %d", limit, offset)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.ScheduleService.ListRuns(id, middleware.ClientID(ctx), limit, offset)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// ReplayRun executes the occurrence of a failed run of any client once more,
+// runs in an unknown state need force=true.
+func (c *ScheduleController) ReplayRun(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("run_id"), 10, 64)
+	if err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.ScheduleService.ReplayRun(id, ctx.Query("force") == "true")
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
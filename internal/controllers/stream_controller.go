@@ -0,0 +1,140 @@
+package balance_controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"time"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+	"users_balance/internal/streaming"
+)
+
+// stream message types
+const (
+	streamBalance        = "balance"
+	streamBalanceChanged = "balance.changed"
+)
+
+// StreamController pushes balance changes to clients. Both streams start with
+// a "balance" message holding the current balance, then send a
+// "balance.changed" message with the new balance and its transaction every
+// time it changes.
+type StreamController struct {
+	Log                *zap.SugaredLogger
+	UserBalanceService interfaces.IUserBalanceService
+	Hub                *streaming.Hub
+	Validator          *validator.Validate
+	Heartbeat          time.Duration
+	Upgrader           websocket.Upgrader
+}
+
+// StreamMessage is a message of the WebSocket stream.
+type StreamMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// subscribe starts following the user before reading the current balance, so
+// a change made in between is not missed.
+func (c *StreamController) subscribe(ctx *gin.Context) (models.User, <-chan models.BalanceChangedEvent, func(), bool) {
+	uuid := ctx.Query("uuid")
+	if err := c.Validator.Var(uuid, "required,uuid"); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return models.User{}, nil, nil, false
+	}
+
+	changes, cancel := c.Hub.Subscribe(uuid)
+
+	user, err := c.UserBalanceService.GetUserBalance(uuid, "", nil)
+	if err != nil {
+		cancel()
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return models.User{}, nil, nil, false
+	}
+
+	return user, changes, cancel, true
+}
+
+// StreamBalance is the Server-Sent Events stream, idle streams get a ping
+// event every Heartbeat.
+func (c *StreamController) StreamBalance(ctx *gin.Context) {
+	user, changes, cancel, ok := c.subscribe(ctx)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	ticker := time.NewTicker(c.Heartbeat)
+	defer ticker.Stop()
+
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.SSEvent(streamBalance, user)
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case change := <-changes:
+			ctx.SSEvent(streamBalanceChanged, change)
+		case <-ticker.C:
+			ctx.SSEvent("ping", time.Now().UTC())
+		}
+		return true
+	})
+}
+
+// StreamBalanceWS is the WebSocket stream. Messages are StreamMessage JSON
+// objects, the connection is kept alive with ping frames every Heartbeat.
+func (c *StreamController) StreamBalanceWS(ctx *gin.Context) {
+	user, changes, cancel, ok := c.subscribe(ctx)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	ws, err := c.Upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// the upgrader has answered already
+		c.Log.Infof("stream :: upgrade: %s", err)
+		return
+	}
+	defer ws.Close()
+
+	// the client sends nothing, reading only handles pongs and detects that it
+	// is gone
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(c.Heartbeat)
+	defer ticker.Stop()
+
+	err = ws.WriteJSON(StreamMessage{Type: streamBalance, Data: user})
+	for err == nil {
+		select {
+		case <-closed:
+			return
+		case change := <-changes:
+			err = ws.WriteJSON(StreamMessage{Type: streamBalanceChanged, Data: change})
+		case <-ticker.C:
+			err = ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.Heartbeat))
+		}
+	}
+
+	c.Log.Infof("stream :: %s", err)
+}
@@ -0,0 +1,125 @@
+package balance_controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/middleware"
+	"users_balance/internal/models"
+)
+
+type WebhookController struct {
+	Log            *zap.SugaredLogger
+	WebhookService interfaces.IWebhookService
+	Validator      *validator.Validate
+}
+
+func (c *WebhookController) CreateSubscription(ctx *gin.Context) {
+	var request models.WebhookSubscriptionRequest
+
+	err := ctx.BindJSON(&request)
+	if err != nil {
+		c.Log.Warn(err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "bad json :/"})
+		return
+	}
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.WebhookService.CreateSubscription(middleware.ClientID(ctx), middleware.ClientAccounts(ctx), request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, resp)
+}
+
+func (c *WebhookController) ListSubscriptions(ctx *gin.Context) {
+	resp, err := c.WebhookService.ListSubscriptions(middleware.ClientID(ctx))
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *WebhookController) DeleteSubscription(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if err := c.Validator.Var(id, "required,uuid"); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	err := c.WebhookService.DeleteSubscription(middleware.ClientID(ctx), id)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *WebhookController) ListDeliveries(ctx *gin.Context) {
+	values := ctx.Request.URL.Query()
+
+	limit, _ := strconv.ParseInt(values.Get("limit"), 10, 64)
+	offset, _ := strconv.ParseInt(values.Get("offset"), 10, 64)
+	request := models.WebhookDeliveriesRequest{
+		SubscriptionID: ctx.Param("id"),
+		Limit:          limit,
+		Offset:         offset,
+	}
+
+	if err := c.Validator.Struct(request); err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	resp, err := c.WebhookService.ListDeliveries(middleware.ClientID(ctx), request)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *WebhookController) ReplayDelivery(ctx *gin.Context) {
+	deliveryID, err := strconv.ParseInt(ctx.Param("delivery_id"), 10, 64)
+	if err != nil {
+		c.Log.Infof("validation : %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	err = c.WebhookService.ReplayDelivery(middleware.ClientID(ctx), deliveryID)
+	if err != nil {
+		statusCode := ResolveErrorCode(err)
+		c.Log.Infof(err.Error())
+		ctx.JSON(statusCode, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusAccepted)
+}
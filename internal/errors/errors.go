@@ -1,9 +1,98 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var ErrNotFound = errors.New("user not found")
 var ErrInsufficientFunds = errors.New("insufficient funds")
 var ErrBadRequest = errors.New("bad request :/")
 var ErrNegativeCreate = errors.New("the user does not exist, it is impossible to create a user with a negative balance")
-var ErrNegativeBalance = errors.New("transfer is prohibited, insufficient funds")
\ No newline at end of file
+var ErrNegativeBalance = errors.New("transfer is prohibited, insufficient funds")
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrForbidden = errors.New("forbidden, missing scope")
+var ErrLimitsNotFound = errors.New("limits not found")
+var ErrLimitExceeded = errors.New("spending limit exceeded")
+
+// LimitExceededError is returned when a debit would break a spending rule.
+// Remaining is what is still allowed under the rule: money for amount rules,
+// a number of transfers for hourly_count.
+type LimitExceededError struct {
+	Rule      string
+	Remaining float64
+}
+
+func (e *LimitExceededError) Error() string {
+	return ErrLimitExceeded.Error() + ": " + e.Rule
+}
+
+func (e *LimitExceededError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+var ErrWebhookURL = errors.New("webhook url must be an http or https url of a resolvable host")
+var ErrWebhookTarget = errors.New("webhook url must point to a public address")
+
+var ErrAccountExists = errors.New("account already exists")
+var ErrAccountFrozen = errors.New("account is frozen")
+var ErrAccountClosed = errors.New("account is closed")
+var ErrAccountNotEmpty = errors.New("account balance must be zero to close it")
+var ErrAccountState = errors.New("account is already in the requested state")
+
+var ErrAdjustmentNotFound = errors.New("adjustment not found")
+var ErrAdjustmentReviewed = errors.New("adjustment has already been reviewed")
+var ErrSameOperator = errors.New("an adjustment must be reviewed by a different operator")
+
+var ErrNoSigningKey = errors.New("audit signing key is not configured")
+
+var ErrBatchTooLarge = errors.New("too many items in the batch")
+
+var ErrBadPayoutFile = errors.New("bad payout file")
+var ErrPayoutJobNotFound = errors.New("payout job not found")
+
+// PayoutFileError lists the lines of a payout file that failed validation.
+type PayoutFileError struct {
+	Lines []PayoutLineError
+}
+
+type PayoutLineError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+func (e *PayoutFileError) Error() string {
+	return ErrBadPayoutFile.Error()
+}
+
+func (e *PayoutFileError) Unwrap() error {
+	return ErrBadPayoutFile
+}
+
+var ErrScheduleNotFound = errors.New("schedule not found")
+var ErrScheduleState = errors.New("schedule can not be changed in its current state")
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+var ErrIdempotencyInProgress = errors.New("a request with this idempotency key is in progress")
+
+var ErrRunNotFound = errors.New("schedule run not found")
+var ErrRunNotReplayable = errors.New("only failed runs can be replayed, runs in an unknown state need force")
+var ErrRunReplayed = errors.New("schedule run has already been replayed")
+
+var ErrArchived = errors.New("transactions of the period have been archived")
+
+// ArchivedError is returned for history reaching before Before, the
+// transactions of the user made before it were moved to cold storage.
+type ArchivedError struct {
+	Before time.Time
+}
+
+func (e *ArchivedError) Error() string {
+	return ErrArchived.Error() + ": history before " + e.Before.UTC().Format(time.RFC3339) + " is archived"
+}
+
+func (e *ArchivedError) Unwrap() error {
+	return ErrArchived
+}
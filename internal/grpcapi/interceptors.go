@@ -0,0 +1,229 @@
+package grpcapi
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"users_balance/internal/controllers"
+	er "users_balance/internal/errors"
+	"users_balance/internal/middleware"
+)
+
+const servicePrefix = "/cash.v1.CashService/"
+
+// methodScopes are the scopes a caller needs one of for each method, like the
+// RequireScope of the HTTP routes. UpdateAccount checks the scope matching the
+// sign of the amount itself.
+var methodScopes = map[string][]string{
+	servicePrefix + "GetBalance":       {middleware.ScopeBalanceRead},
+	servicePrefix + "UpdateAccount":    {middleware.ScopeBalanceCredit, middleware.ScopeBalanceDebit},
+	servicePrefix + "Transfer":         {middleware.ScopeTransfer},
+	servicePrefix + "ListTransactions": {middleware.ScopeBalanceRead},
+	servicePrefix + "WatchBalance":     {middleware.ScopeBalanceRead},
+}
+
+// methodRoutes are the HTTP routes whose rate limit rules apply to each
+// method, a call counts against the same buckets as its HTTP counterpart.
+var methodRoutes = map[string]string{
+	servicePrefix + "GetBalance":       "/cash/v1/balance",
+	servicePrefix + "UpdateAccount":    "/cash/v1/balance/update",
+	servicePrefix + "Transfer":         "/cash/v1/balance/transfer",
+	servicePrefix + "ListTransactions": "/cash/v1/trx_list",
+	servicePrefix + "WatchBalance":     "/cash/v1/balance/stream",
+}
+
+type identityKey struct{}
+
+// Interceptors log calls, authenticate them, apply the rate limits of the HTTP
+// API and turn service errors into status codes.
+type Interceptors struct {
+	Log           *zap.SugaredLogger
+	Authenticator *middleware.Authenticator
+	RateLimiter   *middleware.RateLimiter
+}
+
+func (i *Interceptors) Unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+
+	ctx, err := i.authenticate(ctx, info.FullMethod)
+	if err == nil {
+		err = i.limit(ctx, info.FullMethod, req)
+	}
+	var resp interface{}
+	if err == nil {
+		resp, err = handler(ctx, req)
+		err = toStatus(err)
+	}
+
+	i.log(info.FullMethod, start, err)
+	return resp, err
+}
+
+// Stream limits a call when its request is received, the only message a
+// client sends on the streams of the service.
+func (i *Interceptors) Stream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	start := time.Now()
+
+	ctx, err := i.authenticate(stream.Context(), info.FullMethod)
+	if err == nil {
+		err = toStatus(handler(srv, &identifiedStream{
+			ServerStream: stream,
+			ctx:          ctx,
+			limit: func(msg interface{}) error {
+				return i.limit(ctx, info.FullMethod, msg)
+			},
+		}))
+	}
+
+	i.log(info.FullMethod, start, err)
+	return err
+}
+
+// authenticate reads the x-api-key or authorization metadata, the same
+// credentials as the HTTP headers.
+func (i *Interceptors) authenticate(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	identity, err := i.Authenticator.Identify(first(md, strings.ToLower(middleware.APIKeyHeader)), first(md, "authorization"))
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	ctx = context.WithValue(ctx, identityKey{}, identity)
+	if err := requireScope(ctx, methodScopes[method]...); err != nil {
+		return ctx, err
+	}
+
+	return ctx, nil
+}
+
+// limit applies the rules of the method's HTTP route, rules keyed by user
+// count the call against the uuid, or the payer, of the request.
+func (i *Interceptors) limit(ctx context.Context, method string, req interface{}) error {
+	allowed, wait := i.RateLimiter.Allow(ctx, methodRoutes[method], identityFrom(ctx).ClientID, func() (string, bool) {
+		return targetUser(req), false
+	})
+	if allowed {
+		return nil
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+	return status.Error(codes.ResourceExhausted, "too many requests")
+}
+
+// targetUser is the uuid of a request, or the payer of a transfer.
+func targetUser(req interface{}) string {
+	switch r := req.(type) {
+	case interface{ GetUuid() string }:
+		return r.GetUuid()
+	case interface{ GetFrom() string }:
+		return r.GetFrom()
+	}
+
+	return ""
+}
+
+func (i *Interceptors) log(method string, start time.Time, err error) {
+	i.Log.Infof("grpc :: %s %s %s", method, status.Code(err), time.Since(start))
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func identityFrom(ctx context.Context) middleware.Identity {
+	identity, _ := ctx.Value(identityKey{}).(middleware.Identity)
+	return identity
+}
+
+// requireScope fails unless the caller holds one of the scopes.
+func requireScope(ctx context.Context, scopes ...string) error {
+	for _, scope := range scopes {
+		for _, s := range identityFrom(ctx).Scopes {
+			if s == scope {
+				return nil
+			}
+		}
+	}
+
+	return status.Error(codes.PermissionDenied, er.ErrForbidden.Error())
+}
+
+// restrictToSubject keeps end users to their own wallet and service clients to
+// the accounts they are limited to.
+func restrictToSubject(ctx context.Context, uuid string) error {
+	if !identityFrom(ctx).MaySee(uuid) {
+		return status.Error(codes.PermissionDenied, er.ErrForbidden.Error())
+	}
+
+	return nil
+}
+
+// toStatus maps service errors to the code matching the HTTP status
+// ResolveErrorCode gives them.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := codes.Internal
+	switch balance_controllers.ResolveErrorCode(err) {
+	case http.StatusConflict, http.StatusUnprocessableEntity:
+		code = codes.FailedPrecondition
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case http.StatusGone:
+		code = codes.OutOfRange
+	}
+
+	return status.Error(code, err.Error())
+}
+
+// identifiedStream carries the caller identity to stream handlers and limits
+// the call on its first message.
+type identifiedStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	limit   func(msg interface{}) error
+	limited bool
+}
+
+func (s *identifiedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *identifiedStream) RecvMsg(msg interface{}) error {
+	if err := s.ServerStream.RecvMsg(msg); err != nil {
+		return err
+	}
+	if s.limited {
+		return nil
+	}
+	s.limited = true
+
+	return s.limit(msg)
+}
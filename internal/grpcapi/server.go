@@ -0,0 +1,265 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/middleware"
+	"users_balance/internal/models"
+	"users_balance/internal/streaming"
+	"users_balance/pkg/cashpb"
+)
+
+// Server implements the gRPC API on top of the same service as the HTTP
+// controllers.
+type Server struct {
+	cashpb.UnimplementedCashServiceServer
+
+	Log                *zap.SugaredLogger
+	UserBalanceService interfaces.IUserBalanceService
+	Validator          *validator.Validate
+	// Hub feeds WatchBalance, it must be running.
+	Hub *streaming.Hub
+}
+
+// NewGRPCServer returns a gRPC server with the cash service registered behind
+// the logging, auth and error interceptors.
+func NewGRPCServer(server *Server, interceptors *Interceptors) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(interceptors.Unary),
+		grpc.StreamInterceptor(interceptors.Stream),
+	)
+	cashpb.RegisterCashServiceServer(s, server)
+
+	return s
+}
+
+func (s *Server) GetBalance(ctx context.Context, req *cashpb.GetBalanceRequest) (*cashpb.Balance, error) {
+	request := models.User{
+		ID:       req.Uuid,
+		Currency: req.Currency,
+	}
+	if req.At != nil {
+		at := req.At.AsTime()
+		request.At = &at
+	}
+
+	if err := s.Validator.Struct(request); err != nil {
+		s.Log.Infof("validation : %s", err.Error())
+		return nil, er.ErrBadRequest
+	}
+	if err := restrictToSubject(ctx, request.ID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.UserBalanceService.GetUserBalance(request.ID, request.Currency, request.At)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.CacheStatus != "" {
+		grpc.SetHeader(ctx, metadata.Pairs("x-cache", user.CacheStatus))
+	}
+
+	return toBalance(user), nil
+}
+
+func (s *Server) UpdateAccount(ctx context.Context, req *cashpb.UpdateAccountRequest) (*cashpb.UpdateAccountResponse, error) {
+	request := models.UserBalanceUpdate{
+		UserID:      req.Uuid,
+		Who:         identityFrom(ctx).ClientID,
+		Description: req.Description,
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		DryRun:      req.DryRun,
+	}
+
+	if err := s.Validator.Struct(request); err != nil {
+		s.Log.Infof("validation : %s", err.Error())
+		return nil, er.ErrBadRequest
+	}
+
+	scope := middleware.ScopeBalanceCredit
+	if request.Amount < 0 {
+		scope = middleware.ScopeBalanceDebit
+	}
+	if err := requireScope(ctx, scope); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.UserBalanceService.UpdateAccount(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cashpb.UpdateAccountResponse{
+		User:           toBalance(resp.User),
+		Transaction:    toTransaction(resp.Transaction),
+		FeeTransaction: toOptionalTransaction(resp.FeeTransaction),
+		Quote:          toQuote(resp.Quote),
+	}, nil
+}
+
+func (s *Server) Transfer(ctx context.Context, req *cashpb.TransferRequest) (*cashpb.TransferResponse, error) {
+	request := models.Transfer{
+		From:   req.From,
+		To:     req.To,
+		Amount: req.Amount,
+		DryRun: req.DryRun,
+		Who:    identityFrom(ctx).ClientID,
+	}
+
+	if err := s.Validator.Struct(request); err != nil {
+		s.Log.Infof("validation : %s", err.Error())
+		return nil, er.ErrBadRequest
+	}
+
+	resp, err := s.UserBalanceService.Transfer(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cashpb.TransferResponse{
+		Success: resp.Success,
+		Quote:   toQuote(resp.Quote),
+	}, nil
+}
+
+func (s *Server) ListTransactions(ctx context.Context, req *cashpb.ListTransactionsRequest) (*cashpb.ListTransactionsResponse, error) {
+	request := models.TransactionsListRequest{
+		UserID: req.Uuid,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+		SortBy: req.SortBy,
+		Cmp:    req.Cmp,
+		// timestamps carry no zone
+		Location: time.UTC,
+	}
+
+	if err := s.Validator.Struct(request); err != nil {
+		s.Log.Infof("validation : %s", err.Error())
+		return nil, er.ErrBadRequest
+	}
+	if err := restrictToSubject(ctx, request.UserID); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.UserBalanceService.GetTransactionsList(request)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*cashpb.Transaction, len(resp.TransactionsList))
+	for i, trx := range resp.TransactionsList {
+		list[i] = toTransaction(trx)
+	}
+
+	result := &cashpb.ListTransactionsResponse{Transactions: list}
+	if resp.ArchivedBefore != nil {
+		result.ArchivedBefore = timestamppb.New(*resp.ArchivedBefore)
+	}
+
+	return result, nil
+}
+
+// WatchBalance sends the current balance, then the new balance every time the
+// hub announces a change. A balance asked in another currency is read again to
+// convert it.
+func (s *Server) WatchBalance(req *cashpb.WatchBalanceRequest, stream cashpb.CashService_WatchBalanceServer) error {
+	ctx := stream.Context()
+
+	request := models.User{
+		ID:       req.Uuid,
+		Currency: req.Currency,
+	}
+	if err := s.Validator.Struct(request); err != nil {
+		s.Log.Infof("validation : %s", err.Error())
+		return er.ErrBadRequest
+	}
+	if err := restrictToSubject(ctx, request.ID); err != nil {
+		return err
+	}
+
+	// subscribing first, a change made while the balance is read is not missed
+	changes, cancel := s.Hub.Subscribe(request.ID)
+	defer cancel()
+
+	user, err := s.UserBalanceService.GetUserBalance(request.ID, request.Currency, nil)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(toBalance(user)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change := <-changes:
+			user = change.User
+			if request.Currency != "" {
+				user, err = s.UserBalanceService.GetUserBalance(request.ID, request.Currency, nil)
+				if err != nil {
+					return err
+				}
+			}
+			if err := stream.Send(toBalance(user)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toBalance(user models.User) *cashpb.Balance {
+	balance := &cashpb.Balance{
+		Uuid:     user.ID,
+		Balance:  user.Balance,
+		Currency: user.Currency,
+		Status:   user.Status,
+	}
+	if user.At != nil {
+		balance.At = timestamppb.New(*user.At)
+	}
+
+	return balance
+}
+
+func toTransaction(trx models.Transaction) *cashpb.Transaction {
+	return &cashpb.Transaction{
+		Id:          trx.TrxID,
+		CreatedAt:   timestamppb.New(trx.CreatedAt),
+		Who:         trx.Who,
+		Description: trx.Description,
+		Amount:      trx.Amount,
+		Currency:    trx.Currency,
+		Operation:   trx.Operation,
+	}
+}
+
+func toOptionalTransaction(trx *models.Transaction) *cashpb.Transaction {
+	if trx == nil {
+		return nil
+	}
+
+	return toTransaction(*trx)
+}
+
+func toQuote(quote *models.FeeQuote) *cashpb.FeeQuote {
+	if quote == nil {
+		return nil
+	}
+
+	return &cashpb.FeeQuote{
+		Amount: quote.Amount,
+		Fee:    quote.Fee,
+		Total:  quote.Total,
+		DryRun: quote.DryRun,
+	}
+}
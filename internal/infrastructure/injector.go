@@ -2,17 +2,63 @@ package infrastructure
 
 import (
 	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"net/http"
+	"strings"
+	"users_balance/internal/archive"
+	"users_balance/internal/auditchain"
+	"users_balance/internal/balancecache"
 	"users_balance/internal/config"
 	"users_balance/internal/controllers"
+	"users_balance/internal/grpcapi"
 	"users_balance/internal/interfaces"
+	"users_balance/internal/middleware"
+	"users_balance/internal/outbox"
+	"users_balance/internal/payouts"
+	"users_balance/internal/ratelimit"
+	"users_balance/internal/reconciliation"
 	"users_balance/internal/repos"
+	"users_balance/internal/scheduler"
 	"users_balance/internal/services"
+	"users_balance/internal/snapshots"
+	"users_balance/internal/streaming"
+	"users_balance/internal/webhooks"
 )
 
 type IInjector interface {
 	InjectBalanceController() balance_controllers.UserBalanceController
+	InjectSpendingLimitsController() balance_controllers.SpendingLimitsController
+	InjectAuthenticator() (*middleware.Authenticator, error)
+	InjectRateLimiter() *middleware.RateLimiter
+	InjectIdempotency() *middleware.Idempotency
+	InjectOutboxRelay() (*outbox.Relay, error)
+	InjectWebhookController() balance_controllers.WebhookController
+	InjectWebhookDispatcher() *webhooks.Dispatcher
+	InjectAccountController() balance_controllers.AccountController
+	InjectAccountService() interfaces.IAccountService
+	InjectAdjustmentController() balance_controllers.AdjustmentController
+	InjectAdjustmentService() interfaces.IAdjustmentService
+	InjectAuditService() interfaces.IAuditService
+	InjectAuditController() balance_controllers.AuditController
+	InjectAuditSequencer() *auditchain.Sequencer
+	InjectReconciliationService() interfaces.IReconciliationService
+	InjectReconciliationJob() *reconciliation.Job
+	InjectSnapshotJob() *snapshots.Job
+	InjectArchiveService() interfaces.IArchiveService
+	InjectArchiveJob() *archive.Job
+	InjectPayoutController() balance_controllers.PayoutController
+	InjectPayoutPool() *payouts.Pool
+	InjectScheduleController() balance_controllers.ScheduleController
+	InjectScheduler() *scheduler.Scheduler
+	InjectScheduleService() interfaces.IScheduleService
+	InjectUserBalanceService() interfaces.IUserBalanceService
+	InjectGRPCServer(authenticator *middleware.Authenticator, rateLimiter *middleware.RateLimiter, hub *streaming.Hub) *grpc.Server
+	InjectBalanceHub() *streaming.Hub
+	InjectStreamController(hub *streaming.Hub) balance_controllers.StreamController
+	InjectDocsController() balance_controllers.DocsController
 }
 
 var env *environment
@@ -22,25 +68,425 @@ type environment struct {
 	cfg      *config.Config
 	client   *http.Client
 	dbClient interfaces.IDBHandler
+	// balanceCache is shared by every service of the process, nil when off
+	balanceCache interfaces.IBalanceCache
 }
 
 func (e *environment) InjectBalanceController() balance_controllers.UserBalanceController {
 	return balance_controllers.UserBalanceController{
+		Log:                e.logger,
+		UserBalanceService: e.injectBalanceService(),
+		Validator:          validator.New(),
+	}
+}
+
+func (e *environment) injectBalanceService() *balance_services.UserBalanceService {
+	return &balance_services.UserBalanceService{
+		Log: e.logger,
+		BalanceRepo: &balance_repos.UserBalanceRepo{
+			Log:    e.logger,
+			Client: http.DefaultClient,
+			Config: e.cfg,
+		},
+		LimitsRepo: &balance_repos.SpendingLimitsRepo{
+			Log: e.logger,
+		},
+		FeeRepo: &balance_repos.FeeRepo{
+			Log: e.logger,
+		},
+		OutboxRepo: &balance_repos.OutboxRepo{
+			Log: e.logger,
+		},
+		WebhookRepo: &balance_repos.WebhookRepo{
+			Log: e.logger,
+		},
+		SnapshotRepo: &balance_repos.SnapshotRepo{
+			Log: e.logger,
+		},
+		ArchiveRepo: &balance_repos.ArchiveRepo{
+			Log: e.logger,
+		},
+		Config:       e.cfg,
+		DBHandler:    e.dbClient,
+		BalanceCache: e.balanceCache,
+	}
+}
+
+func (e *environment) InjectUserBalanceService() interfaces.IUserBalanceService {
+	return e.injectBalanceService()
+}
+
+func (e *environment) InjectSpendingLimitsController() balance_controllers.SpendingLimitsController {
+	return balance_controllers.SpendingLimitsController{
 		Log: e.logger,
-		UserBalanceService: &balance_services.UserBalanceService{
+		LimitsService: &balance_services.SpendingLimitsService{
 			Log: e.logger,
-			BalanceRepo: &balance_repos.UserBalanceRepo{
-				Log:    e.logger,
-				Client: http.DefaultClient,
-				Config: e.cfg,
+			LimitsRepo: &balance_repos.SpendingLimitsRepo{
+				Log: e.logger,
 			},
-			Config:    e.cfg,
 			DBHandler: e.dbClient,
 		},
 		Validator: validator.New(),
 	}
 }
 
+func (e *environment) InjectAuthenticator() (*middleware.Authenticator, error) {
+	return middleware.NewAuthenticator(e.logger, e.cfg, e.client)
+}
+
+func (e *environment) InjectRateLimiter() *middleware.RateLimiter {
+	var store interfaces.IRateLimitStore = ratelimit.NewMemoryStore()
+	if e.cfg.RateLimitData.RedisAddr != "" {
+		store = ratelimit.NewRedisStore(e.cfg.RateLimitData.RedisAddr)
+	}
+
+	return &middleware.RateLimiter{
+		Log:   e.logger,
+		Store: store,
+		Rules: e.cfg.RateLimitData.Rules,
+	}
+}
+
+func (e *environment) InjectIdempotency() *middleware.Idempotency {
+	return &middleware.Idempotency{
+		Log:       e.logger,
+		DBHandler: e.dbClient,
+		IdempotencyRepo: &balance_repos.IdempotencyRepo{
+			Log: e.logger,
+		},
+		TTL: e.cfg.IdempotencyData.TTL,
+	}
+}
+
+// InjectOutboxRelay returns nil when no publisher is configured.
+func (e *environment) InjectOutboxRelay() (*outbox.Relay, error) {
+	var publisher interfaces.IEventPublisher
+	switch e.cfg.OutboxData.Publisher {
+	case "":
+		return nil, nil
+	case "stdout":
+		publisher, _ = outbox.NewFilePublisher("")
+	case "file":
+		filePublisher, err := outbox.NewFilePublisher(e.cfg.OutboxData.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		publisher = filePublisher
+	case "nats":
+		data := e.cfg.OutboxData
+		natsPublisher, err := outbox.NewNATSPublisher(outbox.NATSOptions{
+			URL:           string(data.NATSURL),
+			SubjectPrefix: data.NATSSubjectPrefix,
+			User:          data.NATSUser,
+			Password:      string(data.NATSPassword),
+			Token:         string(data.NATSToken),
+			TLS:           data.NATSTLS,
+			CAFile:        data.NATSCAFile,
+			CertFile:      data.NATSCertFile,
+			KeyFile:       data.NATSKeyFile,
+		})
+		if err != nil {
+			return nil, err
+		}
+		publisher = natsPublisher
+	default:
+		return nil, errors.Errorf("unknown outbox publisher %q", e.cfg.OutboxData.Publisher)
+	}
+
+	return &outbox.Relay{
+		Log:       e.logger,
+		DBHandler: e.dbClient,
+		OutboxRepo: &balance_repos.OutboxRepo{
+			Log: e.logger,
+		},
+		Publisher:    publisher,
+		PollInterval: e.cfg.OutboxData.PollInterval,
+	}, nil
+}
+
+func (e *environment) InjectWebhookController() balance_controllers.WebhookController {
+	return balance_controllers.WebhookController{
+		Log: e.logger,
+		WebhookService: &balance_services.WebhookService{
+			Log: e.logger,
+			WebhookRepo: &balance_repos.WebhookRepo{
+				Log: e.logger,
+			},
+			DBHandler:           e.dbClient,
+			AllowPrivateTargets: e.cfg.WebhookData.AllowPrivateTargets,
+		},
+		Validator: validator.New(),
+	}
+}
+
+func (e *environment) InjectWebhookDispatcher() *webhooks.Dispatcher {
+	return &webhooks.Dispatcher{
+		Log:       e.logger,
+		DBHandler: e.dbClient,
+		WebhookRepo: &balance_repos.WebhookRepo{
+			Log: e.logger,
+		},
+		Client: webhooks.NewClient(e.cfg.WebhookData.AllowPrivateTargets),
+		Config: e.cfg.WebhookData,
+	}
+}
+
+func (e *environment) InjectAccountController() balance_controllers.AccountController {
+	return balance_controllers.AccountController{
+		Log:            e.logger,
+		AccountService: e.InjectAccountService(),
+		Validator:      validator.New(),
+	}
+}
+
+func (e *environment) InjectAccountService() interfaces.IAccountService {
+	return &balance_services.AccountService{
+		Log: e.logger,
+		BalanceRepo: &balance_repos.UserBalanceRepo{
+			Log:    e.logger,
+			Client: http.DefaultClient,
+			Config: e.cfg,
+		},
+		DBHandler:    e.dbClient,
+		BalanceCache: e.balanceCache,
+	}
+}
+
+func (e *environment) InjectAdjustmentController() balance_controllers.AdjustmentController {
+	return balance_controllers.AdjustmentController{
+		Log:               e.logger,
+		AdjustmentService: e.InjectAdjustmentService(),
+		Validator:         validator.New(),
+	}
+}
+
+func (e *environment) InjectAdjustmentService() interfaces.IAdjustmentService {
+	return &balance_services.AdjustmentService{
+		Log: e.logger,
+		AdjustmentRepo: &balance_repos.AdjustmentRepo{
+			Log: e.logger,
+		},
+		UserBalanceService: e.injectBalanceService(),
+		DBHandler:          e.dbClient,
+	}
+}
+
+func (e *environment) InjectAuditService() interfaces.IAuditService {
+	return &balance_services.AuditService{
+		Log:    e.logger,
+		Config: e.cfg,
+		AuditRepo: &balance_repos.AuditRepo{
+			Log: e.logger,
+		},
+		DBHandler: e.dbClient,
+	}
+}
+
+func (e *environment) InjectAuditSequencer() *auditchain.Sequencer {
+	return &auditchain.Sequencer{
+		Log:          e.logger,
+		AuditService: e.InjectAuditService(),
+		Interval:     e.cfg.AuditData.SequenceInterval,
+	}
+}
+
+func (e *environment) InjectAuditController() balance_controllers.AuditController {
+	return balance_controllers.AuditController{
+		Log:          e.logger,
+		AuditService: e.InjectAuditService(),
+	}
+}
+
+func (e *environment) InjectReconciliationService() interfaces.IReconciliationService {
+	return &balance_services.ReconciliationService{
+		Log: e.logger,
+		ReconciliationRepo: &balance_repos.ReconciliationRepo{
+			Log: e.logger,
+		},
+		BalanceRepo: &balance_repos.UserBalanceRepo{
+			Log:    e.logger,
+			Client: http.DefaultClient,
+			Config: e.cfg,
+		},
+		DBHandler: e.dbClient,
+	}
+}
+
+// InjectReconciliationJob returns nil when no interval is configured.
+func (e *environment) InjectReconciliationJob() *reconciliation.Job {
+	if e.cfg.ReconciliationData.Interval == 0 {
+		return nil
+	}
+
+	return &reconciliation.Job{
+		Log:       e.logger,
+		Service:   e.InjectReconciliationService(),
+		Interval:  e.cfg.ReconciliationData.Interval,
+		Fix:       e.cfg.ReconciliationData.Fix,
+		ReportDir: e.cfg.ReconciliationData.ReportDir,
+		Format:    e.cfg.ReconciliationData.ReportFormat,
+	}
+}
+
+func (e *environment) InjectSnapshotJob() *snapshots.Job {
+	return &snapshots.Job{
+		Log:       e.logger,
+		DBHandler: e.dbClient,
+		SnapshotRepo: &balance_repos.SnapshotRepo{
+			Log: e.logger,
+		},
+		Interval: e.cfg.SnapshotData.Interval,
+		Lag:      e.cfg.SnapshotData.Lag,
+		Verify:   e.cfg.SnapshotData.Verify,
+	}
+}
+
+func (e *environment) InjectArchiveService() interfaces.IArchiveService {
+	return &balance_services.ArchiveService{
+		Log: e.logger,
+		ArchiveRepo: &balance_repos.ArchiveRepo{
+			Log: e.logger,
+		},
+		DBHandler: e.dbClient,
+		Store:     newArchiveStore(e.cfg.ArchiveData),
+		Retention: e.cfg.ArchiveData.Retention,
+	}
+}
+
+func (e *environment) InjectArchiveJob() *archive.Job {
+	return &archive.Job{
+		Log:      e.logger,
+		Service:  e.InjectArchiveService(),
+		Interval: e.cfg.ArchiveData.Interval,
+	}
+}
+
+func (e *environment) injectPayoutService() *balance_services.PayoutService {
+	return &balance_services.PayoutService{
+		Log:    e.logger,
+		Config: e.cfg,
+		PayoutRepo: &balance_repos.PayoutRepo{
+			Log: e.logger,
+		},
+		UserBalanceService: e.injectBalanceService(),
+		DBHandler:          e.dbClient,
+	}
+}
+
+func (e *environment) InjectPayoutController() balance_controllers.PayoutController {
+	return balance_controllers.PayoutController{
+		Log:           e.logger,
+		PayoutService: e.injectPayoutService(),
+	}
+}
+
+func (e *environment) InjectPayoutPool() *payouts.Pool {
+	return &payouts.Pool{
+		Log:          e.logger,
+		Service:      e.injectPayoutService(),
+		Workers:      e.cfg.PayoutData.Workers,
+		PollInterval: e.cfg.PayoutData.PollInterval,
+	}
+}
+
+func (e *environment) injectScheduleService() *balance_services.ScheduleService {
+	return &balance_services.ScheduleService{
+		Log: e.logger,
+		ScheduleRepo: &balance_repos.ScheduleRepo{
+			Log: e.logger,
+		},
+		UserBalanceService: e.injectBalanceService(),
+		DBHandler:          e.dbClient,
+	}
+}
+
+func (e *environment) InjectScheduleService() interfaces.IScheduleService {
+	return e.injectScheduleService()
+}
+
+func (e *environment) InjectScheduleController() balance_controllers.ScheduleController {
+	return balance_controllers.ScheduleController{
+		Log:             e.logger,
+		ScheduleService: e.injectScheduleService(),
+		Validator:       validator.New(),
+	}
+}
+
+func (e *environment) InjectScheduler() *scheduler.Scheduler {
+	return &scheduler.Scheduler{
+		Log:       e.logger,
+		DBHandler: e.dbClient,
+		ScheduleRepo: &balance_repos.ScheduleRepo{
+			Log: e.logger,
+		},
+		Service:      e.injectScheduleService(),
+		PollInterval: e.cfg.ScheduleData.PollInterval,
+	}
+}
+
+// InjectGRPCServer returns nil when no gRPC port is configured. It shares the
+// authenticator and rate limiter of the HTTP API, hub must be running.
+func (e *environment) InjectGRPCServer(authenticator *middleware.Authenticator, rateLimiter *middleware.RateLimiter,
+	hub *streaming.Hub) *grpc.Server {
+	if e.cfg.GRPCData.Port == "" {
+		return nil
+	}
+
+	return grpcapi.NewGRPCServer(
+		&grpcapi.Server{
+			Log:                e.logger,
+			UserBalanceService: e.injectBalanceService(),
+			Validator:          validator.New(),
+			Hub:                hub,
+		},
+		&grpcapi.Interceptors{
+			Log:           e.logger,
+			Authenticator: authenticator,
+			RateLimiter:   rateLimiter,
+		},
+	)
+}
+
+func (e *environment) InjectBalanceHub() *streaming.Hub {
+	hub := streaming.NewHub(e.logger, e.dbClient, &balance_repos.OutboxRepo{
+		Log: e.logger,
+	})
+	// a cache kept per replica learns the writes of the others from the hub
+	if _, ok := e.balanceCache.(*balancecache.MemoryStore); ok {
+		hub.BalanceCache = e.balanceCache
+	}
+
+	return hub
+}
+
+// InjectStreamController serves the streams of hub, which must be running.
+func (e *environment) InjectStreamController(hub *streaming.Hub) balance_controllers.StreamController {
+	upgrader := websocket.Upgrader{}
+	if origins := e.cfg.StreamData.AllowedOrigins; len(origins) > 0 {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			for _, origin := range origins {
+				if r.Header.Get("Origin") == origin {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	return balance_controllers.StreamController{
+		Log:                e.logger,
+		UserBalanceService: e.injectBalanceService(),
+		Hub:                hub,
+		Validator:          validator.New(),
+		Heartbeat:          e.cfg.StreamData.Heartbeat,
+		Upgrader:           upgrader,
+	}
+}
+
+func (e *environment) InjectDocsController() balance_controllers.DocsController {
+	return balance_controllers.DocsController{}
+}
+
 func Injector(log *zap.SugaredLogger, cfg *config.Config) (IInjector, error) {
 	client, err := InitPostgresClient(cfg)
 	if err != nil {
@@ -49,11 +495,42 @@ func Injector(log *zap.SugaredLogger, cfg *config.Config) (IInjector, error) {
 	}
 
 	env = &environment{
-		logger:   log,
-		cfg:      cfg,
-		client:   http.DefaultClient,
-		dbClient: client,
+		logger:       log,
+		cfg:          cfg,
+		client:       http.DefaultClient,
+		dbClient:     client,
+		balanceCache: newBalanceCache(cfg.BalanceCacheData),
 	}
 
 	return env, nil
 }
+
+func newBalanceCache(data config.BalanceCacheData) interfaces.IBalanceCache {
+	switch {
+	case data.TTL == 0:
+		return nil
+	case data.RedisAddr != "":
+		return balancecache.NewRedisStore(data.RedisAddr, data.TTL)
+	default:
+		return balancecache.NewMemoryStore(data.Size, data.TTL)
+	}
+}
+
+func newArchiveStore(data config.ArchiveData) interfaces.IArchiveStore {
+	switch {
+	case data.URL == nil:
+		return nil
+	case data.URL.Scheme == "file":
+		return &archive.LocalStore{Dir: data.URL.Path}
+	default:
+		return &archive.S3Store{
+			Endpoint:        data.S3Endpoint,
+			Region:          data.S3Region,
+			Bucket:          data.URL.Host,
+			Prefix:          strings.TrimPrefix(data.URL.Path, "/"),
+			AccessKeyID:     data.S3AccessKeyID,
+			SecretAccessKey: string(data.S3SecretAccessKey),
+			Client:          http.DefaultClient,
+		}
+	}
+}
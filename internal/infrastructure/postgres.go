@@ -17,7 +17,7 @@ type PostgresClient struct {
 
 func InitPostgresClient(cfg *config.Config) (interfaces.IDBHandler, error) {
 	pool, err := pgxpool.Connect(context.Background(), fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=disable",
-		cfg.DBAdminUsername, cfg.DBAdminPassword, cfg.DBHost, cfg.DBPort, cfg.DBName))
+		cfg.DBAdminUsername, string(cfg.DBAdminPassword), cfg.DBHost, cfg.DBPort, cfg.DBName))
 	if err != nil {
 		log.Print(err)
 		return nil, errors.Wrap(err, "postgres init")
@@ -52,7 +52,7 @@ func (p *PostgresClient) FinishTransaction(ctx context.Context, tx pgx.Tx, err e
 		return err
 	} else {
 		if commitErr := tx.Commit(ctx); commitErr != nil {
-			return errors.Wrap(err, "failed to commit tx")
+			return errors.Wrap(commitErr, "failed to commit tx")
 		}
 
 		return nil
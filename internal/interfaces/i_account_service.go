@@ -0,0 +1,14 @@
+package interfaces
+
+import (
+	"users_balance/internal/models"
+)
+
+type IAccountService interface {
+	CreateAccount(req models.NewAccount) (models.Account, error)
+	GetAccount(uuid string) (models.Account, error)
+	FreezeAccount(uuid string) (models.Account, error)
+	UnfreezeAccount(uuid string) (models.Account, error)
+	CloseAccount(uuid string) (models.Account, error)
+	SetShards(req models.AccountShards) (models.Account, error)
+}
@@ -0,0 +1,26 @@
+package interfaces
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"users_balance/internal/models"
+)
+
+type IAdjustmentRepo interface {
+	CreateAdjustment(conn *pgxpool.Conn, req models.AdjustmentProposal, operator string) (models.ManualAdjustment, error)
+	GetAdjustment(conn *pgxpool.Conn, id string) (models.ManualAdjustment, error)
+	LockAdjustment(conn *pgxpool.Conn, id string) (models.ManualAdjustment, error)
+	ListAdjustments(conn *pgxpool.Conn, req models.AdjustmentsListRequest) ([]models.ManualAdjustment, error)
+	ReviewAdjustment(conn *pgxpool.Conn, id string, operator string, status string) (models.ManualAdjustment, error)
+	FinishAdjustment(conn *pgxpool.Conn, id string, status string, trxID *string, reason *string) (models.ManualAdjustment, error)
+	InsertAuditEntry(conn *pgxpool.Conn, entry models.AuditEntry) error
+	ListAuditEntries(conn *pgxpool.Conn, adjustmentID string) ([]models.AuditEntry, error)
+}
+
+type IAdjustmentService interface {
+	Propose(operator string, req models.AdjustmentProposal) (models.ManualAdjustment, error)
+	Get(id string) (models.ManualAdjustment, error)
+	List(req models.AdjustmentsListRequest) (models.AdjustmentsListResponse, error)
+	Approve(operator string, id string, req models.AdjustmentReview) (models.ManualAdjustment, error)
+	Reject(operator string, id string, req models.AdjustmentReview) (models.ManualAdjustment, error)
+	AuditLog(id string) (models.AuditLogResponse, error)
+}
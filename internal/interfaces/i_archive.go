@@ -0,0 +1,29 @@
+package interfaces
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"io"
+	"time"
+	"users_balance/internal/models"
+)
+
+type IArchiveRepo interface {
+	CreatePartition(conn *pgxpool.Conn, month time.Time) (bool, error)
+	ListPartitions(conn *pgxpool.Conn) ([]models.TransactionPartition, error)
+	ExportPartition(conn *pgxpool.Conn, partition string, fn func(userUUID string, trx models.Transaction) error) error
+	ArchivePartition(conn *pgxpool.Conn, archive models.TransactionArchive) error
+	ArchivedBefore(conn *pgxpool.Conn, userUUID string) (*time.Time, error)
+	TryArchiveLock(conn *pgxpool.Conn) (bool, error)
+	ReleaseArchiveLock(conn *pgxpool.Conn) error
+}
+
+// IArchiveStore keeps archive files in cold storage. Put stores the size
+// bytes of r under key, replacing an earlier file, and returns where it went.
+type IArchiveStore interface {
+	Put(ctx context.Context, key string, r io.ReadSeeker, size int64) (string, error)
+}
+
+type IArchiveService interface {
+	Archive(ctx context.Context) (models.ArchiveReport, error)
+}
@@ -0,0 +1,19 @@
+package interfaces
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"users_balance/internal/models"
+)
+
+type IAuditRepo interface {
+	ListChain(conn *pgxpool.Conn, afterSeq int64, limit int) ([]models.AuditChainEntry, error)
+	ChainHead(conn *pgxpool.Conn) (int64, models.AuditChainEntry, error)
+	SequencePending(conn *pgxpool.Conn, limit int) (int, error)
+}
+
+type IAuditService interface {
+	Sequence(ctx context.Context) (int, error)
+	Verify(ctx context.Context) (models.ChainReport, error)
+	Checkpoint() (models.AuditCheckpoint, error)
+}
@@ -0,0 +1,16 @@
+package interfaces
+
+import (
+	"context"
+	"users_balance/internal/models"
+)
+
+// IBalanceCache keeps current balances in front of the database. Get returns a
+// token on a miss and Set stores a balance loaded after that Get only when the
+// wallet was not invalidated in between, so a read racing a write never caches
+// the balance from before the write. Writers invalidate after they commit.
+type IBalanceCache interface {
+	Get(ctx context.Context, uuid string) (models.User, bool, uint64, error)
+	Set(ctx context.Context, user models.User, token uint64) error
+	Invalidate(ctx context.Context, uuids ...string) error
+}
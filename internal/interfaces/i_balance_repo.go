@@ -3,15 +3,23 @@ package interfaces
 import (
 	"github.com/jackc/pgx/v4/pgxpool"
 	"net/http"
+	"time"
 	"users_balance/internal/models"
 )
 
 type ICompanyDetailsRepo interface {
 	GetUserBalance(conn *pgxpool.Conn, uuid string) (models.User, error)
+	LockUserBalance(conn *pgxpool.Conn, uuid string, exclusive bool) (models.User, error)
 	UpdateAccount(conn *pgxpool.Conn, req models.UserBalanceUpdate) (models.User, error)
 	CreateUser(conn *pgxpool.Conn, req models.UserBalanceUpdate) (models.User, error)
+	CreateAccount(conn *pgxpool.Conn, req models.NewAccount) (models.Account, error)
+	GetAccount(conn *pgxpool.Conn, uuid string) (models.Account, error)
+	SetAccountStatus(conn *pgxpool.Conn, uuid string, from []string, status string) (models.Account, error)
+	SetAccountShards(conn *pgxpool.Conn, uuid string, shards int) (models.Account, error)
 	InsertTransaction(conn *pgxpool.Conn, req models.UserBalanceUpdate) (models.Transaction, error)
 	GetTransaction(conn *pgxpool.Conn, userUUID string, trxUUID string) (models.Transaction, error)
 	GetTransactionsList(conn *pgxpool.Conn, userID string, limit int64, offset int64) ([]models.Transaction, error)
+	GetBalanceBefore(conn *pgxpool.Conn, userID string, at time.Time) (float64, error)
+	GetTransactionsBetween(conn *pgxpool.Conn, userID string, from time.Time, to time.Time) ([]models.Transaction, error)
 	GetExchangeRate(request *http.Request) (float64, error)
 }
@@ -1,12 +1,15 @@
 package interfaces
 
 import (
+	"time"
 	"users_balance/internal/models"
 )
 
 type IUserBalanceService interface {
-	GetUserBalance(string, string) (models.User, error)
+	GetUserBalance(string, string, *time.Time) (models.User, error)
 	UpdateAccount(models.UserBalanceUpdate) (models.UserBalanceUpdateResponse, error)
+	BatchUpdate(req models.BatchUpdateRequest) (models.BatchUpdateResponse, error)
 	Transfer(req models.Transfer) (models.TransferResponse, error)
 	GetTransactionsList(req models.TransactionsListRequest) (models.TransactionsListResponse, error)
+	GetStatement(req models.StatementRequest) (models.Statement, error)
 }
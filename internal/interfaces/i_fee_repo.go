@@ -0,0 +1,10 @@
+package interfaces
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"users_balance/internal/models"
+)
+
+type IFeeRepo interface {
+	GetFeeRule(conn *pgxpool.Conn, operation string, currency string, userUUID string) (models.FeeRule, error)
+}
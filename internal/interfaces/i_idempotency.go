@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+	"users_balance/internal/models"
+)
+
+// IIdempotencyRepo stores the requests sent with an Idempotency-Key. Claim
+// returns true when the key is unused or older than ttl and now belongs to
+// the request, and the stored request otherwise.
+type IIdempotencyRepo interface {
+	Claim(conn *pgxpool.Conn, key models.IdempotencyKey, ttl time.Duration) (models.IdempotencyKey, bool, error)
+	Complete(conn *pgxpool.Conn, key models.IdempotencyKey) error
+	Release(conn *pgxpool.Conn, clientID string, key string) error
+	DeleteExpired(conn *pgxpool.Conn, ttl time.Duration) (int64, error)
+}
@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"users_balance/internal/models"
+)
+
+type ISpendingLimitsRepo interface {
+	GetEffectiveLimits(conn *pgxpool.Conn, userUUID string) (models.SpendingLimits, error)
+	GetUsage(conn *pgxpool.Conn, userUUID string) (models.SpendingUsage, error)
+	GetLimits(conn *pgxpool.Conn, subjectType string, subject string) (models.SpendingLimits, error)
+	SetLimits(conn *pgxpool.Conn, limits models.SpendingLimits) (models.SpendingLimits, error)
+	DeleteLimits(conn *pgxpool.Conn, subjectType string, subject string) (bool, error)
+	SetUserTier(conn *pgxpool.Conn, req models.UserTier) (bool, error)
+}
@@ -0,0 +1,12 @@
+package interfaces
+
+import (
+	"users_balance/internal/models"
+)
+
+type ISpendingLimitsService interface {
+	GetLimits(subjectType string, subject string) (models.SpendingLimits, error)
+	SetLimits(limits models.SpendingLimits) (models.SpendingLimits, error)
+	DeleteLimits(subjectType string, subject string) error
+	SetUserTier(req models.UserTier) error
+}
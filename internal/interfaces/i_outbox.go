@@ -0,0 +1,22 @@
+package interfaces
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"users_balance/internal/models"
+)
+
+type IOutboxRepo interface {
+	InsertEvent(conn *pgxpool.Conn, event models.Event) (models.Event, error)
+	GetEvent(conn *pgxpool.Conn, id int64) (models.Event, error)
+	LockUnpublished(tx pgx.Tx, limit int) ([]models.Event, error)
+	MarkPublished(tx pgx.Tx, ids []int64) error
+}
+
+// IEventPublisher delivers outbox events downstream. Publish must only return
+// nil once the event has been accepted by the destination.
+type IEventPublisher interface {
+	Publish(ctx context.Context, event models.Event) error
+	Close() error
+}
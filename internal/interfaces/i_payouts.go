@@ -0,0 +1,24 @@
+package interfaces
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"io"
+	"users_balance/internal/models"
+)
+
+type IPayoutRepo interface {
+	CreateJob(conn *pgxpool.Conn, client string) (models.PayoutJob, error)
+	InsertRows(conn *pgxpool.Conn, jobID int64, rows []models.PayoutRow) error
+	MissingUsers(conn *pgxpool.Conn, uuids []string) ([]string, error)
+	GetJob(conn *pgxpool.Conn, id int64, client string) (models.PayoutJob, error)
+	ListFailures(conn *pgxpool.Conn, jobID int64) ([]models.PayoutRow, error)
+	LockNextRow(conn *pgxpool.Conn) (models.PayoutRow, error)
+	FinishRow(conn *pgxpool.Conn, row models.PayoutRow) error
+}
+
+type IPayoutService interface {
+	CreateJob(client string, file io.Reader) (models.PayoutJob, error)
+	GetJob(id int64, client string) (models.PayoutJob, error)
+	ProcessNext(ctx context.Context) (bool, error)
+}
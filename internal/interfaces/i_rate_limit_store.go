@@ -0,0 +1,13 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+// IRateLimitStore keeps token buckets. Take consumes one token from the bucket
+// stored under key, refilled at rate tokens per second up to burst. When the
+// bucket is empty it reports how long until the next token is available.
+type IRateLimitStore interface {
+	Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error)
+}
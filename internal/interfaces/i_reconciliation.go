@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"users_balance/internal/models"
+)
+
+type IReconciliationRepo interface {
+	FindDiscrepancies(conn *pgxpool.Conn) ([]models.Discrepancy, error)
+	LockUser(conn *pgxpool.Conn, userUUID string) (models.Discrepancy, error)
+	UserChain(conn *pgxpool.Conn, userUUID string) ([]models.AuditChainEntry, error)
+}
+
+type IReconciliationService interface {
+	Reconcile(ctx context.Context, fix bool) (models.ReconciliationReport, error)
+}
@@ -0,0 +1,37 @@
+package interfaces
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"users_balance/internal/models"
+)
+
+type IScheduleRepo interface {
+	CreateSchedule(conn *pgxpool.Conn, s models.Schedule) (models.Schedule, error)
+	GetSchedule(conn *pgxpool.Conn, id string, client string) (models.Schedule, error)
+	ListSchedules(conn *pgxpool.Conn, client string) ([]models.Schedule, error)
+	UpdateSchedule(conn *pgxpool.Conn, id string, client string, upd models.ScheduleUpdate) (models.Schedule, error)
+	CancelSchedule(conn *pgxpool.Conn, id string, client string) (models.Schedule, error)
+	ClaimNextDue(conn *pgxpool.Conn) (models.Schedule, error)
+	ListInterrupted(conn *pgxpool.Conn) ([]models.Schedule, error)
+	StartRun(conn *pgxpool.Conn, s models.Schedule) (models.ScheduleRun, error)
+	FinishRun(conn *pgxpool.Conn, run models.ScheduleRun, s models.Schedule) error
+	ListRuns(conn *pgxpool.Conn, scheduleID string, limit int64, offset int64) ([]models.ScheduleRun, error)
+	GetRun(conn *pgxpool.Conn, id int64) (models.ScheduleRun, error)
+	GetRunSchedule(conn *pgxpool.Conn, run models.ScheduleRun) (models.Schedule, error)
+	StartReplay(conn *pgxpool.Conn, run models.ScheduleRun) (models.ScheduleRun, error)
+	FinishReplay(conn *pgxpool.Conn, run models.ScheduleRun) (models.ScheduleRun, error)
+	TryLeadership(conn *pgxpool.Conn) (bool, error)
+	ReleaseLeadership(conn *pgxpool.Conn) error
+}
+
+type IScheduleService interface {
+	CreateSchedule(client string, req models.ScheduleRequest) (models.Schedule, error)
+	GetSchedule(id string, client string) (models.Schedule, error)
+	ListSchedules(client string) ([]models.Schedule, error)
+	UpdateSchedule(id string, client string, upd models.ScheduleUpdate) (models.Schedule, error)
+	CancelSchedule(id string, client string) (models.Schedule, error)
+	ListRuns(id string, client string, limit int64, offset int64) ([]models.ScheduleRun, error)
+	RunDue(ctx context.Context) (int, error)
+	ReplayRun(id int64, force bool) (models.ScheduleRun, error)
+}
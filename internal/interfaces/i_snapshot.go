@@ -0,0 +1,12 @@
+package interfaces
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+type ISnapshotRepo interface {
+	TakeSnapshots(conn *pgxpool.Conn, at time.Time) (int64, error)
+	DropStaleSnapshots(conn *pgxpool.Conn, since time.Time) (int64, error)
+	GetBalanceAt(conn *pgxpool.Conn, userUUID string, at time.Time) (float64, error)
+}
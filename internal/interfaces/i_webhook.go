@@ -0,0 +1,28 @@
+package interfaces
+
+import (
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+	"users_balance/internal/models"
+)
+
+type IWebhookRepo interface {
+	CreateSubscription(conn *pgxpool.Conn, sub models.WebhookSubscription) (models.WebhookSubscription, error)
+	ListSubscriptions(conn *pgxpool.Conn, clientID string) ([]models.WebhookSubscription, error)
+	DeleteSubscription(conn *pgxpool.Conn, clientID string, id string) (bool, error)
+	EnqueueDeliveries(conn *pgxpool.Conn, event models.Event) error
+	ListDeliveries(conn *pgxpool.Conn, clientID string, req models.WebhookDeliveriesRequest) ([]models.WebhookDelivery, error)
+	ReplayDelivery(conn *pgxpool.Conn, clientID string, deliveryID int64) (bool, error)
+	ClaimDue(conn *pgxpool.Conn, limit int, lease time.Duration) ([]models.DueWebhookDelivery, error)
+	MarkDelivered(tx pgx.Tx, id int64, statusCode int) error
+	MarkFailed(tx pgx.Tx, id int64, statusCode *int, reason string, next time.Time, dead bool) error
+}
+
+type IWebhookService interface {
+	CreateSubscription(clientID string, accounts []string, req models.WebhookSubscriptionRequest) (models.WebhookSubscription, error)
+	ListSubscriptions(clientID string) (models.WebhookSubscriptionsResponse, error)
+	DeleteSubscription(clientID string, id string) error
+	ListDeliveries(clientID string, req models.WebhookDeliveriesRequest) (models.WebhookDeliveriesResponse, error)
+	ReplayDelivery(clientID string, deliveryID int64) error
+}
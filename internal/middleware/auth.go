@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"users_balance/internal/config"
+	er "users_balance/internal/errors"
+)
+
+const (
+	ScopeBalanceRead   = "balance:read"
+	ScopeBalanceCredit = "balance:credit"
+	ScopeBalanceDebit  = "balance:debit"
+	ScopeTransfer      = "transfer"
+	ScopeAdmin         = "admin"
+	ScopeWebhooks      = "webhooks"
+	ScopeAccounts      = "accounts"
+)
+
+const (
+	APIKeyHeader = "X-Api-Key"
+
+	clientIDKey       = "auth_client_id"
+	clientScopesKey   = "auth_client_scopes"
+	clientAccountsKey = "auth_client_accounts"
+	subjectKey        = "auth_subject"
+)
+
+// endUserScopes are granted to holders of a valid end-user JWT, they may only
+// read their own wallet.
+var endUserScopes = []string{ScopeBalanceRead}
+
+type Authenticator struct {
+	Log     *zap.SugaredLogger
+	clients []config.APIClient
+	jwt     *JWTVerifier
+}
+
+func NewAuthenticator(log *zap.SugaredLogger, cfg *config.Config, client *http.Client) (*Authenticator, error) {
+	verifier, err := NewJWTVerifier(cfg.AuthData.JWTData, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{
+		Log:     log,
+		clients: cfg.AuthData.Clients,
+		jwt:     verifier,
+	}, nil
+}
+
+// Identity is an authenticated caller. Subject is only set for end users, it
+// is the uuid of their wallet. Accounts limit a service client to some
+// wallets, it sees all of them when there are none.
+type Identity struct {
+	ClientID string
+	Scopes   []string
+	Subject  string
+	Accounts []string
+}
+
+// MaySee tells whether the caller may read the wallet uuid.
+func (i Identity) MaySee(uuid string) bool {
+	if i.Subject != "" {
+		return strings.EqualFold(uuid, i.Subject)
+	}
+	if len(i.Accounts) == 0 {
+		return true
+	}
+	for _, account := range i.Accounts {
+		if strings.EqualFold(uuid, account) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticate resolves the caller either from the X-Api-Key header (service
+// clients) or from a bearer JWT (end users) and stores its identity and scopes
+// in the gin context.
+func (a *Authenticator) Authenticate(ctx *gin.Context) {
+	identity, err := a.Identify(ctx.GetHeader(APIKeyHeader), ctx.GetHeader("Authorization"))
+	if err != nil {
+		a.Log.Infof("auth :: request from %s rejected", ctx.ClientIP())
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.Set(clientIDKey, identity.ClientID)
+	ctx.Set(clientScopesKey, identity.Scopes)
+	if len(identity.Accounts) > 0 {
+		ctx.Set(clientAccountsKey, identity.Accounts)
+	}
+	if identity.Subject != "" {
+		ctx.Set(subjectKey, identity.Subject)
+	}
+	ctx.Next()
+}
+
+// Identify resolves a caller from an API key or, when there is none, from the
+// value of an Authorization header. It is shared by the HTTP and gRPC APIs.
+func (a *Authenticator) Identify(apiKey string, authorization string) (Identity, error) {
+	if apiKey == "" {
+		return a.identifyEndUser(authorization)
+	}
+
+	client, ok := a.lookup(apiKey)
+	if !ok {
+		a.Log.Info("auth :: unknown api key")
+		return Identity{}, er.ErrUnauthorized
+	}
+
+	return Identity{ClientID: client.ID, Scopes: client.Scopes, Accounts: client.Accounts}, nil
+}
+
+func (a *Authenticator) identifyEndUser(authorization string) (Identity, error) {
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	if a.jwt == nil || token == "" || token == authorization {
+		return Identity{}, er.ErrUnauthorized
+	}
+
+	claims, err := a.jwt.Verify(token)
+	if err != nil {
+		a.Log.Infof("auth :: jwt rejected: %s", err)
+		return Identity{}, er.ErrUnauthorized
+	}
+
+	return Identity{ClientID: claims.Subject, Scopes: endUserScopes, Subject: claims.Subject}, nil
+}
+
+func (a *Authenticator) lookup(key string) (config.APIClient, bool) {
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+
+	for _, client := range a.clients {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(client.KeyHash)) == 1 {
+			return client, true
+		}
+	}
+
+	return config.APIClient{}, false
+}
+
+// TokenFromQuery lets browsers, which can not set headers on EventSource and
+// WebSocket requests, send the end-user JWT as the access_token parameter.
+func TokenFromQuery(ctx *gin.Context) {
+	if token := ctx.Query("access_token"); token != "" && ctx.GetHeader("Authorization") == "" {
+		ctx.Request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	ctx.Next()
+}
+
+// RequireScope rejects requests of clients that hold none of the given scopes.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		for _, scope := range scopes {
+			if HasScope(ctx, scope) {
+				ctx.Next()
+				return
+			}
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": er.ErrForbidden.Error()})
+	}
+}
+
+// RestrictToSubject rejects requests whose "uuid" query parameter is a wallet
+// the caller may not see: end users only see the token subject, service
+// clients the accounts they are limited to.
+func RestrictToSubject(ctx *gin.Context) {
+	identity := Identity{Subject: ctx.GetString(subjectKey), Accounts: ClientAccounts(ctx)}
+	if !identity.MaySee(ctx.Query("uuid")) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": er.ErrForbidden.Error()})
+		return
+	}
+
+	ctx.Next()
+}
+
+func HasScope(ctx *gin.Context, scope string) bool {
+	for _, s := range ctx.GetStringSlice(clientScopesKey) {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientID returns the id of the authenticated API client.
+func ClientID(ctx *gin.Context) string {
+	return ctx.GetString(clientIDKey)
+}
+
+// ClientAccounts returns the accounts the client is limited to, nil when it
+// sees all of them.
+func ClientAccounts(ctx *gin.Context) []string {
+	return ctx.GetStringSlice(clientAccountsKey)
+}
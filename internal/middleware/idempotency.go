@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"time"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from a previous
+	// request with the same key.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency answers a request repeated with the same Idempotency-Key by
+// replaying the response of the first one, so clients can retry writes they
+// got no answer to. Keys belong to the API client and are kept for TTL.
+// Requests without the header are handled as usual.
+type Idempotency struct {
+	Log             *zap.SugaredLogger
+	DBHandler       interfaces.IDBHandler
+	IdempotencyRepo interfaces.IIdempotencyRepo
+	TTL             time.Duration
+}
+
+// responseRecorder keeps a copy of the response body.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Handle must run after Authenticate. A key reused for a different request
+// is refused with 422, a key whose first request is still being handled with
+// 409.
+func (i *Idempotency) Handle(ctx *gin.Context) {
+	key := ctx.GetHeader(IdempotencyKeyHeader)
+	if key == "" {
+		ctx.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": er.ErrBadRequest.Error()})
+		return
+	}
+	ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	hash.Write([]byte(ctx.Request.Method + " " + ctx.FullPath() + "\n"))
+	hash.Write(body)
+	request := models.IdempotencyKey{
+		ClientID:    ClientID(ctx),
+		Key:         key,
+		RequestHash: hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	stored, claimed, err := i.claim(ctx.Request.Context(), request)
+	if err != nil {
+		i.Log.Warnf("idempotency :: claim %s :: %s", key, err)
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "idempotency keys are unavailable"})
+		return
+	}
+
+	if !claimed {
+		switch {
+		case stored.RequestHash != request.RequestHash:
+			ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"message": er.ErrIdempotencyKeyReused.Error(),
+				"code":    "idempotency_key_reused",
+			})
+		case stored.StatusCode == 0:
+			ctx.Header("Retry-After", "1")
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"message": er.ErrIdempotencyInProgress.Error(),
+				"code":    "idempotency_in_progress",
+			})
+		default:
+			ctx.Header(IdempotentReplayedHeader, "true")
+			ctx.Data(stored.StatusCode, "application/json; charset=utf-8", stored.Response)
+			ctx.Abort()
+		}
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+	ctx.Writer = recorder
+
+	// a handler that panicked leaves the key free for a retry
+	answered := false
+	defer func() {
+		if !answered {
+			i.release(request)
+		}
+	}()
+
+	ctx.Next()
+	answered = true
+
+	// a key that could not be completed stays in progress until it expires,
+	// the request may have been applied
+	request.StatusCode = recorder.Status()
+	request.Response = recorder.body.Bytes()
+	if err := i.complete(request); err != nil {
+		i.Log.Warnf("idempotency :: complete %s :: %s", key, err)
+	}
+}
+
+func (i *Idempotency) claim(ctx context.Context, request models.IdempotencyKey) (models.IdempotencyKey, bool, error) {
+	conn, err := i.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return models.IdempotencyKey{}, false, err
+	}
+	defer conn.Release()
+
+	return i.IdempotencyRepo.Claim(conn, request, i.TTL)
+}
+
+// complete and release do not use the request context, the client may be
+// gone by then.
+func (i *Idempotency) complete(request models.IdempotencyKey) error {
+	conn, err := i.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	return i.IdempotencyRepo.Complete(conn, request)
+}
+
+func (i *Idempotency) release(request models.IdempotencyKey) {
+	conn, err := i.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		i.Log.Warnf("idempotency :: release %s :: %s", request.Key, err)
+		return
+	}
+	defer conn.Release()
+
+	if err := i.IdempotencyRepo.Release(conn, request.ClientID, request.Key); err != nil {
+		i.Log.Warnf("idempotency :: release %s :: %s", request.Key, err)
+	}
+}
+
+// Run deletes expired keys every hour until ctx is cancelled.
+func (i *Idempotency) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if err := i.deleteExpired(ctx); err != nil {
+			i.Log.Warnf("idempotency :: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (i *Idempotency) deleteExpired(ctx context.Context) error {
+	conn, err := i.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	n, err := i.IdempotencyRepo.DeleteExpired(conn, i.TTL)
+	if err != nil {
+		return err
+	}
+
+	i.Log.Infof("idempotency :: %d expired keys deleted", n)
+	return nil
+}
@@ -0,0 +1,350 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/pkg/errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"users_balance/internal/config"
+)
+
+const jwksRefreshInterval = 10 * time.Minute
+
+// an unknown kid refetches the key set at most every jwksMinInterval, a failed
+// fetch is retried after jwksRetryMin, doubled on every failure up to
+// jwksRefreshInterval
+const (
+	jwksMinInterval  = 30 * time.Second
+	jwksRetryMin     = 5 * time.Second
+	jwksFetchTimeout = 10 * time.Second
+)
+
+var (
+	errMalformedToken = errors.New("malformed token")
+	errUnknownKey     = errors.New("unknown signing key")
+	errBadSignature   = errors.New("bad token signature")
+	errTokenExpired   = errors.New("token expired")
+	errBadClaims      = errors.New("bad token claims")
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Claims are the registered claims the API relies on.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+}
+
+// audience accepts both the string and the array form of "aud".
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWTVerifier checks RS256 tokens against a JWKS endpoint or a static public
+// key, and HS256 tokens against a shared secret.
+type JWTVerifier struct {
+	cfg    config.JWTData
+	client *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	static    *rsa.PublicKey
+	refreshed time.Time
+	// fetching is set while a request fetches the key set
+	fetching bool
+	// failures counts the fetches failed in a row, none is tried before retryAt
+	failures int
+	retryAt  time.Time
+	lastErr  error
+}
+
+// NewJWTVerifier returns nil when no verification key is configured.
+func NewJWTVerifier(cfg config.JWTData, client *http.Client) (*JWTVerifier, error) {
+	if cfg.JWKSURL == "" && cfg.RSAPublicKey == "" && cfg.HMACSecret == "" {
+		return nil, nil
+	}
+
+	v := &JWTVerifier{
+		cfg:    cfg,
+		client: client,
+		keys:   map[string]*rsa.PublicKey{},
+	}
+
+	if cfg.RSAPublicKey != "" {
+		key, err := parseRSAPublicKey(cfg.RSAPublicKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "JWT_RSA_PUBLIC_KEY")
+		}
+		v.static = key
+	}
+
+	return v, nil
+}
+
+func (v *JWTVerifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errMalformedToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, errMalformedToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, errMalformedToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch header.Alg {
+	case "RS256":
+		key, err := v.rsaKey(header.Kid)
+		if err != nil {
+			return Claims{}, err
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return Claims{}, errBadSignature
+		}
+	case "HS256":
+		if v.cfg.HMACSecret == "" {
+			return Claims{}, errUnknownKey
+		}
+		mac := hmac.New(sha256.New, []byte(v.cfg.HMACSecret))
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return Claims{}, errBadSignature
+		}
+	default:
+		return Claims{}, errUnknownKey
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, errMalformedToken
+	}
+
+	if err := v.validateClaims(claims); err != nil {
+		return Claims{}, err
+	}
+
+	return claims, nil
+}
+
+func (v *JWTVerifier) validateClaims(claims Claims) error {
+	now := time.Now().Unix()
+	switch {
+	case claims.Subject == "":
+		return errBadClaims
+	case claims.ExpiresAt == 0 || now >= claims.ExpiresAt:
+		return errTokenExpired
+	case claims.NotBefore != 0 && now < claims.NotBefore:
+		return errBadClaims
+	case v.cfg.Issuer != "" && claims.Issuer != v.cfg.Issuer:
+		return errBadClaims
+	}
+
+	if v.cfg.Audience == "" {
+		return nil
+	}
+	for _, aud := range claims.Audience {
+		if aud == v.cfg.Audience {
+			return nil
+		}
+	}
+
+	return errBadClaims
+}
+
+func (v *JWTVerifier) rsaKey(kid string) (*rsa.PublicKey, error) {
+	if v.cfg.JWKSURL != "" {
+		v.mu.RLock()
+		key, ok := v.keys[kid]
+		stale := time.Since(v.refreshed) > jwksRefreshInterval
+		v.mu.RUnlock()
+
+		if !ok || stale {
+			if err := v.refreshJWKS(); err != nil && !ok {
+				return nil, err
+			}
+			v.mu.RLock()
+			key, ok = v.keys[kid]
+			v.mu.RUnlock()
+		}
+		if ok {
+			return key, nil
+		}
+	}
+
+	if v.static != nil {
+		return v.static, nil
+	}
+
+	return nil, errUnknownKey
+}
+
+// refreshJWKS fetches the key set unless another request is fetching it, it
+// was fetched less than jwksMinInterval ago or a failed fetch is backing off.
+// The fetch runs unlocked, readers keep using the old keys meanwhile.
+func (v *JWTVerifier) refreshJWKS() error {
+	v.mu.Lock()
+	if v.fetching || time.Since(v.refreshed) < jwksMinInterval {
+		v.mu.Unlock()
+		return nil
+	}
+	if time.Now().Before(v.retryAt) {
+		err := v.lastErr
+		v.mu.Unlock()
+		return err
+	}
+	v.fetching = true
+	v.mu.Unlock()
+
+	keys, err := v.fetchJWKS()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.fetching = false
+	if err != nil {
+		backoff := jwksRetryMin << uint(v.failures)
+		if backoff > jwksRefreshInterval || backoff <= 0 {
+			backoff = jwksRefreshInterval
+		}
+		v.failures++
+		v.retryAt = time.Now().Add(backoff)
+		v.lastErr = err
+		return err
+	}
+
+	v.keys = keys
+	v.refreshed = time.Now()
+	v.failures = 0
+	v.retryAt = time.Time{}
+	v.lastErr = nil
+
+	return nil
+}
+
+func (v *JWTVerifier) fetchJWKS() (map[string]*rsa.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "jwks fetch")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "jwks fetch")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("jwks fetch: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, errors.Wrap(err, "jwks decode")
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		key, err := k.rsaPublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+func parseRSAPublicKey(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+
+	return key, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"users_balance/internal/config"
+	"users_balance/internal/interfaces"
+)
+
+// maxTargetBody is how much of a body is read to find the uuid a request
+// targets, a request with a larger one counts against its client instead.
+const maxTargetBody = 16 << 10
+
+type RateLimiter struct {
+	Log   *zap.SugaredLogger
+	Store interfaces.IRateLimitStore
+	Rules []config.RateLimitRule
+}
+
+// Limit applies every rule matching the route and client. Rules keyed by user
+// count requests against the uuid the request targets, taken from the "uuid"
+// query parameter or the "uuid"/"from" field of the JSON body. A body too large
+// to be searched counts against the client bucket of the rule.
+func (l *RateLimiter) Limit(ctx *gin.Context) {
+	allowed, wait := l.Allow(ctx.Request.Context(), ctx.FullPath(), ClientID(ctx), func() (string, bool) {
+		return targetUser(ctx)
+	})
+	if !allowed {
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "too many requests"})
+		return
+	}
+
+	ctx.Next()
+}
+
+// Allow takes a token from the bucket of every rule matching the route and
+// client, and returns how long to wait when one is empty. target is only
+// called for rules keyed by user, it returns the uuid the request targets and
+// whether it could not be looked for, which counts the request against the
+// client instead. Requests without a target skip those rules.
+func (l *RateLimiter) Allow(ctx context.Context, route string, client string, target func() (string, bool)) (bool, time.Duration) {
+	var user string
+	var targetResolved, tooLarge bool
+
+	for i, rule := range l.Rules {
+		if (rule.Route != "*" && rule.Route != route) || (rule.Client != "*" && rule.Client != client) {
+			continue
+		}
+
+		key := fmt.Sprintf("%d:client:%s", i, client)
+		if rule.Key == "user" {
+			if !targetResolved {
+				user, tooLarge = target()
+				targetResolved = true
+			}
+			switch {
+			case user != "":
+				key = fmt.Sprintf("%d:user:%s", i, user)
+			case !tooLarge:
+				continue
+			}
+		}
+
+		allowed, wait, err := l.Store.Take(ctx, key, rule.Rate, rule.Burst)
+		if err != nil {
+			// failing open keeps the API available when a shared store is down
+			l.Log.Warnf("rate limit :: store error :: %s", err)
+			continue
+		}
+
+		if !allowed {
+			return false, wait
+		}
+	}
+
+	return true, 0
+}
+
+// targetUser returns the uuid a request targets, and true when the body was
+// too large to look for it. The body is left for the handler as it was sent.
+func targetUser(ctx *gin.Context) (string, bool) {
+	if uuid := ctx.Query("uuid"); uuid != "" {
+		return uuid, false
+	}
+
+	if ctx.Request.Body == nil || ctx.Request.Method == http.MethodGet {
+		return "", false
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(ctx.Request.Body, maxTargetBody+1))
+	ctx.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), ctx.Request.Body), ctx.Request.Body}
+	if err != nil {
+		return "", false
+	}
+	if len(body) > maxTargetBody {
+		return "", true
+	}
+
+	var fields struct {
+		UUID string `json:"uuid"`
+		From string `json:"from"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", false
+	}
+
+	if fields.UUID != "" {
+		return fields.UUID, false
+	}
+
+	return fields.From, false
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// account states
+const (
+	AccountActive = "active"
+	AccountFrozen = "frozen"
+	AccountClosed = "closed"
+)
+
+// NewAccount opens a wallet with a zero balance. The uuid is generated when
+// not given.
+type NewAccount struct {
+	UserID string `json:"uuid" validate:"omitempty,uuid"`
+	Tier   string `json:"tier" validate:"omitempty"`
+}
+
+type Account struct {
+	ID        string    `json:"uuid"`
+	Balance   float64   `json:"balance"`
+	Tier      string    `json:"tier"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	// Shards is the number of shard rows the credits of a hot account are
+	// spread over, 0 for an account kept in its users row.
+	Shards int `json:"shards"`
+}
+
+// AccountShards sets the shards of an account, 0 folds them back into the
+// users row. A debit locks every shard, hence the bound.
+type AccountShards struct {
+	UserID string `json:"uuid" validate:"required,uuid"`
+	Shards int    `json:"shards" validate:"min=0,max=64"`
+}
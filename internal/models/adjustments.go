@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// manual adjustment states
+const (
+	AdjustmentPending  = "pending"
+	AdjustmentApproved = "approved"
+	AdjustmentRejected = "rejected"
+	AdjustmentPosted   = "posted"
+	AdjustmentFailed   = "failed"
+)
+
+// audit log actions
+const (
+	AuditProposed = "proposed"
+	AuditApproved = "approved"
+	AuditRejected = "rejected"
+	AuditPosted   = "posted"
+	AuditFailed   = "failed"
+)
+
+type AdjustmentProposal struct {
+	UserID   string  `json:"uuid" validate:"required,uuid"`
+	Amount   float64 `json:"amount" validate:"required"`
+	Currency string  `json:"currency" validate:"required"`
+	Reason   string  `json:"reason" validate:"required,min=10"`
+}
+
+type AdjustmentReview struct {
+	Comment string `json:"comment" validate:"omitempty"`
+}
+
+type ManualAdjustment struct {
+	ID            string     `json:"id"`
+	UserID        string     `json:"uuid"`
+	Amount        float64    `json:"amount"`
+	Currency      string     `json:"currency"`
+	Reason        string     `json:"reason"`
+	Status        string     `json:"status"`
+	ProposedBy    string     `json:"proposed_by"`
+	ReviewedBy    *string    `json:"reviewed_by"`
+	TransactionID *string    `json:"transaction_id"`
+	Error         *string    `json:"error"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+}
+
+type AdjustmentsListRequest struct {
+	Status string `json:"status" validate:"omitempty,oneof=pending approved rejected posted failed"`
+	Limit  int64  `json:"limit" validate:"required,gte=1,lte=100"`
+	Offset int64  `json:"offset" validate:"omitempty,gte=0"`
+}
+
+type AdjustmentsListResponse struct {
+	Adjustments []ManualAdjustment `json:"adjustments"`
+}
+
+type AuditEntry struct {
+	ID           int64     `json:"id"`
+	AdjustmentID string    `json:"adjustment_id"`
+	Action       string    `json:"action"`
+	Actor        string    `json:"actor"`
+	Details      *string   `json:"details"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type AuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// TransactionPartition is the month of transactions made from From until To,
+// excluded.
+type TransactionPartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// TransactionArchive is a month of transactions moved to cold storage, SHA256
+// is the hex digest of the archive file.
+type TransactionArchive struct {
+	Partition    string    `json:"partition"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Location     string    `json:"location"`
+	Format       string    `json:"format"`
+	Transactions int64     `json:"transactions"`
+	Amount       float64   `json:"amount"`
+	SHA256       string    `json:"sha256"`
+}
+
+type ArchiveReport struct {
+	StartedAt         time.Time            `json:"started_at"`
+	FinishedAt        time.Time            `json:"finished_at"`
+	CreatedPartitions []string             `json:"created_partitions"`
+	Archived          []TransactionArchive `json:"archived"`
+}
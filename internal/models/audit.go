@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// AuditChainEntry is a link of the tamper-evident chain of balance mutations.
+type AuditChainEntry struct {
+	Seq       int64     `json:"seq"`
+	Entity    string    `json:"entity"`
+	EntityID  string    `json:"entity_id"`
+	Payload   string    `json:"payload"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChainReport is the result of walking the chain. BrokenAt is the first link
+// that does not verify, nil when the whole chain is intact.
+type ChainReport struct {
+	Checked  int64   `json:"checked"`
+	LastHash string  `json:"last_hash"`
+	BrokenAt *int64  `json:"broken_at,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+	Valid    bool    `json:"valid"`
+	Expected *string `json:"expected_hash,omitempty"`
+}
+
+// AuditCheckpoint pins the chain state so it can be archived outside the
+// database. Signature is an Ed25519 signature of SignedPayload.
+type AuditCheckpoint struct {
+	Count         int64     `json:"count"`
+	LastSeq       int64     `json:"last_seq"`
+	LastHash      string    `json:"last_hash"`
+	CreatedAt     time.Time `json:"created_at"`
+	SignedPayload string    `json:"signed_payload"`
+	Signature     string    `json:"signature"`
+	PublicKey     string    `json:"public_key"`
+}
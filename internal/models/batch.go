@@ -0,0 +1,33 @@
+package models
+
+// batch item statuses
+const (
+	BatchItemApplied    = "applied"
+	BatchItemFailed     = "failed"
+	BatchItemRolledBack = "rolled_back"
+	BatchItemSkipped    = "skipped"
+)
+
+// BatchUpdateRequest applies several balance updates at once. With
+// AllOrNothing the first failing item rolls every item back, otherwise items
+// succeed or fail on their own.
+type BatchUpdateRequest struct {
+	Items        []UserBalanceUpdate `json:"items" validate:"required,min=1,dive"`
+	AllOrNothing bool                `json:"all_or_nothing"`
+}
+
+type BatchItemResult struct {
+	Index   int                        `json:"index"`
+	Status  string                     `json:"status"`
+	Result  *UserBalanceUpdateResponse `json:"result,omitempty"`
+	Message string                     `json:"message,omitempty"`
+	Code    int                        `json:"code,omitempty"`
+	Err     error                      `json:"-"`
+}
+
+type BatchUpdateResponse struct {
+	Committed bool              `json:"committed"`
+	Applied   int               `json:"applied"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// outbox event types
+const (
+	EventBalanceChanged    = "balance.changed"
+	EventTransferCompleted = "transfer.completed"
+)
+
+// Event is a row of the outbox. Key is the aggregate the event belongs to, a
+// user uuid for balance changes and the sender uuid for transfers.
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Key       string          `json:"key"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type BalanceChangedEvent struct {
+	User        User        `json:"user"`
+	Transaction Transaction `json:"transaction"`
+}
+
+type TransferCompletedEvent struct {
+	From                   string  `json:"from"`
+	To                     string  `json:"to"`
+	Amount                 float64 `json:"amount"`
+	Fee                    float64 `json:"fee"`
+	SenderTransactionID    string  `json:"sender_transaction_id"`
+	RecipientTransactionID string  `json:"recipient_transaction_id"`
+}
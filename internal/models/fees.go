@@ -0,0 +1,27 @@
+package models
+
+// fee schedule operations
+const (
+	FeeOperationTransfer = "transfer"
+	FeeOperationCredit   = "credit"
+	FeeOperationDebit    = "debit"
+)
+
+// FeeRule charges Percent of the amount plus Fixed, capped at MaxFee if set.
+type FeeRule struct {
+	Operation string
+	Currency  string
+	Tier      string
+	Percent   float64
+	Fixed     float64
+	MaxFee    *float64
+}
+
+// FeeQuote previews an operation. Total is the resulting change of the payer's
+// balance, fee included.
+type FeeQuote struct {
+	Amount float64 `json:"amount"`
+	Fee    float64 `json:"fee"`
+	Total  float64 `json:"total"`
+	DryRun bool    `json:"dry_run"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// IdempotencyKey is a request sent with an Idempotency-Key header. StatusCode
+// and Response are set once the request has been answered.
+type IdempotencyKey struct {
+	ClientID    string
+	Key         string
+	RequestHash string
+	StatusCode  int
+	Response    []byte
+	CreatedAt   time.Time
+}
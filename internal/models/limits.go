@@ -0,0 +1,28 @@
+package models
+
+const (
+	LimitSubjectUser = "user"
+	LimitSubjectTier = "tier"
+)
+
+// SpendingLimits caps outgoing money of a user. A nil field is unlimited.
+type SpendingLimits struct {
+	SubjectType  string   `json:"subject_type,omitempty"`
+	Subject      string   `json:"subject,omitempty"`
+	MaxSingle    *float64 `json:"max_single" validate:"omitempty,gt=0"`
+	DailyTotal   *float64 `json:"daily_total" validate:"omitempty,gt=0"`
+	MonthlyTotal *float64 `json:"monthly_total" validate:"omitempty,gt=0"`
+	HourlyCount  *int     `json:"hourly_count" validate:"omitempty,gt=0"`
+}
+
+// SpendingUsage aggregates the outgoing transactions of a user.
+type SpendingUsage struct {
+	DailyTotal   float64
+	MonthlyTotal float64
+	HourlyCount  int
+}
+
+type UserTier struct {
+	UserID string `json:"uuid" validate:"required,uuid"`
+	Tier   string `json:"tier" validate:"required"`
+}
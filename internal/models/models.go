@@ -1,43 +1,72 @@
 package models
 
+import "time"
+
 type Transfer struct {
 	From   string  `json:"from" validate:"required,uuid"`
 	To     string  `json:"to" validate:"required,uuid"`
 	Amount float64 `json:"amount" validate:"gt=0"`
+	DryRun bool    `json:"dry_run"`
+	Who    string  `json:"-" validate:"required"`
+	// Description replaces the default descriptions of both legs when set.
+	Description string `json:"-"`
 }
 
 type User struct {
 	ID       string  `json:"uuid" validate:"required,uuid"`
 	Balance  float64 `json:"balance" validate:"omitempty"`
 	Currency string  `json:"currency,omitempty" validate:"omitempty"`
+	Status   string  `json:"status,omitempty" validate:"omitempty"`
+	// At is set when the balance is the one the user had at that moment.
+	At *time.Time `json:"at,omitempty"`
+	// CacheStatus tells whether the balance came from the balance cache and
+	// CachedAt when it was read from the database, they are sent as response
+	// metadata.
+	CacheStatus string     `json:"-"`
+	CachedAt    *time.Time `json:"-"`
 }
 
+// where a balance was read from
+const (
+	CacheHit    = "hit"
+	CacheMiss   = "miss"
+	CacheBypass = "bypass"
+)
+
 type UserBalanceUpdate struct {
 	UserID      string  `json:"uuid" validate:"required,uuid"`
-	Who         string  `json:"who" validate:"required"`
+	Who         string  `json:"-" validate:"required"`
 	Description string  `json:"description" validate:"omitempty"`
 	Amount      float64 `json:"amount" validate:"required"`
 	Currency    string  `json:"currency" validate:"required"`
+	DryRun      bool    `json:"dry_run"`
+	Operation   string  `json:"-"`
+	// Reverses is the transaction a reversal undoes
+	Reverses string `json:"-"`
 }
 
 type UserBalanceUpdateResponse struct {
-	User        User        `json:"user"`
-	Transaction Transaction `json:"transaction"`
+	User           User         `json:"user"`
+	Transaction    Transaction  `json:"transaction"`
+	FeeTransaction *Transaction `json:"fee_transaction,omitempty"`
+	Quote          *FeeQuote    `json:"quote,omitempty"`
 }
 
 type Transaction struct {
-	TrxID       string  `json:"id"`
-	Date        string  `json:"date"`
-	Time        string  `json:"time"`
-	Timestamp   int     `json:"timestamp"`
-	Who         string  `json:"who"`
-	Description string  `json:"description"`
-	Amount      float64 `json:"amount"`
-	Currency    string  `json:"currency"`
+	TrxID       string    `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Who         string    `json:"who"`
+	Description string    `json:"description"`
+	Amount      float64   `json:"amount"`
+	Currency    string    `json:"currency"`
+	Operation   string    `json:"operation"`
 }
 
 type TransferResponse struct {
-	Success string `json:"success,required"`
+	Success string    `json:"success,required"`
+	Quote   *FeeQuote `json:"quote,omitempty"`
+	// TransactionID is the sender's transaction.
+	TransactionID string `json:"-"`
 }
 
 type TransactionsListRequest struct {
@@ -46,10 +75,15 @@ type TransactionsListRequest struct {
 	Offset int64  `json:"offset" validate:"omitempty,gte=0"`
 	SortBy string `json:"sort_by" validate:"omitempty,oneof=date amount"`
 	Cmp    string `json:"cmp" validate:"omitempty,oneof=d i"`
+	// Location is the time zone transaction times are given in.
+	Location *time.Location `json:"-" validate:"-"`
 }
 
 type TransactionsListResponse struct {
 	TransactionsList []Transaction `json:"transactions,omitempty"`
+	// ArchivedBefore is set when the transactions made before it were
+	// archived, they are no longer listed
+	ArchivedBefore *time.Time `json:"archived_before,omitempty"`
 }
 
 type Exchange struct {
@@ -59,3 +93,18 @@ type Exchange struct {
 const (
 	RUB = "RUB"
 )
+
+// transaction operations
+const (
+	OperationUpdate      = "update"
+	OperationTransferOut = "transfer_out"
+	OperationTransferIn  = "transfer_in"
+	OperationReversal    = "reversal"
+	OperationFee         = "fee"
+	OperationAdjustment  = "adjustment"
+	OperationCorrection  = "correction"
+)
+
+// AbortDescription starts the description of the reversal of an aborted
+// transaction, its uuid follows.
+const AbortDescription = "abort transaction "
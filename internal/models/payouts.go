@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// payout job states, derived from the state of the rows
+const (
+	PayoutJobQueued    = "queued"
+	PayoutJobRunning   = "running"
+	PayoutJobCompleted = "completed"
+)
+
+// payout row states
+const (
+	PayoutRowPending = "pending"
+	PayoutRowApplied = "applied"
+	PayoutRowFailed  = "failed"
+)
+
+type PayoutJob struct {
+	ID        int64       `json:"id"`
+	Client    string      `json:"-"`
+	Status    string      `json:"status"`
+	TotalRows int64       `json:"total_rows"`
+	Processed int64       `json:"processed_rows"`
+	Applied   int64       `json:"applied"`
+	Failed    int64       `json:"failed"`
+	CreatedAt time.Time   `json:"created_at"`
+	Failures  []PayoutRow `json:"failures,omitempty"`
+}
+
+// PayoutRow is a line of a payout file, Row is its number among the data lines.
+type PayoutRow struct {
+	JobID       int64   `json:"-"`
+	Row         int     `json:"row"`
+	UserID      string  `json:"uuid"`
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description"`
+	Status      string  `json:"status"`
+	Error       string  `json:"error,omitempty"`
+	TrxID       *string `json:"transaction_id,omitempty"`
+	Client      string  `json:"-"`
+}
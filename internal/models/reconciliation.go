@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Discrepancy is a user whose balance differs from the sum of their
+// transactions. FirstDivergentTransaction is the first transaction after which
+// the balance stopped matching the running sum, when the audit chain covers it.
+type Discrepancy struct {
+	UserID                    string  `json:"uuid"`
+	Expected                  float64 `json:"expected"`
+	Actual                    float64 `json:"actual"`
+	Difference                float64 `json:"difference"`
+	FirstDivergentTransaction *string `json:"first_divergent_transaction"`
+	CorrectionTransaction     *string `json:"correction_transaction,omitempty"`
+}
+
+type ReconciliationReport struct {
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at"`
+	Fixed         bool          `json:"fixed"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
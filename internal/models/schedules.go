@@ -0,0 +1,97 @@
+package models
+
+import "time"
+
+// schedule kinds
+const (
+	ScheduleKindTransfer = "transfer"
+	ScheduleKindUpdate   = "update"
+)
+
+// schedule recurrences
+const (
+	RecurrenceOnce    = "once"
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+)
+
+// schedule states
+const (
+	ScheduleActive    = "active"
+	SchedulePaused    = "paused"
+	ScheduleCompleted = "completed"
+	ScheduleFailed    = "failed"
+	ScheduleCancelled = "cancelled"
+)
+
+// schedule run states
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunRetrying  = "retrying"
+	RunFailed    = "failed"
+	RunUnknown   = "unknown"
+)
+
+// ScheduleRequest creates a schedule. A transfer sends Amount from UserID to
+// To, an update applies Amount to UserID like /balance/update, so a charge has
+// a negative amount. Monthly schedules run on DayOfMonth, the last day of
+// shorter months, and default to the day of FirstRunAt. An occurrence failing
+// for insufficient funds is retried MaxRetries times, RetryInterval seconds
+// apart.
+type ScheduleRequest struct {
+	Kind          string    `json:"kind" validate:"required,oneof=transfer update"`
+	UserID        string    `json:"uuid" validate:"required,uuid"`
+	To            string    `json:"to" validate:"omitempty,uuid"`
+	Amount        float64   `json:"amount" validate:"required"`
+	Description   string    `json:"description"`
+	FirstRunAt    time.Time `json:"first_run_at" validate:"required"`
+	Recurrence    string    `json:"recurrence" validate:"required,oneof=once daily weekly monthly"`
+	DayOfMonth    int       `json:"day_of_month" validate:"omitempty,min=1,max=31"`
+	MaxRetries    int       `json:"max_retries" validate:"gte=0,lte=100"`
+	RetryInterval int       `json:"retry_interval_seconds" validate:"omitempty,gte=60"`
+}
+
+// ScheduleUpdate changes the given fields of a schedule. Paused pauses or
+// resumes it.
+type ScheduleUpdate struct {
+	Amount        *float64 `json:"amount" validate:"omitempty,ne=0"`
+	Description   *string  `json:"description"`
+	Paused        *bool    `json:"paused"`
+	MaxRetries    *int     `json:"max_retries" validate:"omitempty,gte=0,lte=100"`
+	RetryInterval *int     `json:"retry_interval_seconds" validate:"omitempty,gte=60"`
+}
+
+type Schedule struct {
+	ID            string     `json:"id"`
+	Client        string     `json:"-"`
+	Kind          string     `json:"kind"`
+	UserID        string     `json:"uuid"`
+	To            *string    `json:"to,omitempty"`
+	Amount        float64    `json:"amount"`
+	Description   string     `json:"description"`
+	Recurrence    string     `json:"recurrence"`
+	DayOfMonth    *int       `json:"day_of_month,omitempty"`
+	MaxRetries    int        `json:"max_retries"`
+	RetryInterval int        `json:"retry_interval_seconds"`
+	Status        string     `json:"status"`
+	Attempt       int        `json:"attempt"`
+	OccurrenceAt  time.Time  `json:"occurrence_at"`
+	NextRunAt     *time.Time `json:"next_run_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type ScheduleRun struct {
+	ID           int64      `json:"id"`
+	ScheduleID   string     `json:"schedule_id"`
+	OccurrenceAt time.Time  `json:"occurrence_at"`
+	Attempt      int        `json:"attempt"`
+	Status       string     `json:"status"`
+	Error        *string    `json:"error,omitempty"`
+	TrxID        *string    `json:"transaction_id,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	// ReplayOf is the failed run this one was made by hand for.
+	ReplayOf *int64 `json:"replay_of,omitempty"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// statement formats
+const (
+	StatementPDF = "pdf"
+	StatementCSV = "csv"
+)
+
+// StatementRequest covers the days From to To, both inclusive, as they are in
+// Location.
+type StatementRequest struct {
+	UserID   string `validate:"required,uuid"`
+	From     time.Time
+	To       time.Time
+	Format   string `validate:"omitempty,oneof=pdf csv"`
+	Location *time.Location
+}
+
+// Statement lists the transactions of a period with the balance after each of
+// them. Balances are derived from the transaction history.
+type Statement struct {
+	UserID         string          `json:"uuid"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	Currency       string          `json:"currency"`
+	OpeningBalance float64         `json:"opening_balance"`
+	ClosingBalance float64         `json:"closing_balance"`
+	TotalCredits   float64         `json:"total_credits"`
+	TotalDebits    float64         `json:"total_debits"`
+	Lines          []StatementLine `json:"lines"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+}
+
+type StatementLine struct {
+	Transaction
+	Balance float64 `json:"balance"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type WebhookSubscriptionRequest struct {
+	URL        string   `json:"url" validate:"required,url"`
+	EventTypes []string `json:"event_types" validate:"omitempty,dive,oneof=balance.changed transfer.completed"`
+}
+
+// WebhookSubscription is a partner endpoint. Secret is only returned when the
+// subscription is created. Accounts are those the client was limited to when
+// subscribing, events of other accounts are not sent, none means all.
+type WebhookSubscription struct {
+	ID         string    `json:"id"`
+	ClientID   string    `json:"client_id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	Accounts   []string  `json:"accounts"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookSubscriptionsResponse struct {
+	Subscriptions []WebhookSubscription `json:"subscriptions"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      *string         `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+// DueWebhookDelivery is a delivery joined with where and how to send it.
+type DueWebhookDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
+
+type WebhookDeliveriesRequest struct {
+	SubscriptionID string `json:"subscription_id" validate:"required,uuid"`
+	Limit          int64  `json:"limit" validate:"required,gte=1,lte=100"`
+	Offset         int64  `json:"offset" validate:"omitempty,gte=0"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// WebhookPayload is the JSON body POSTed to subscribers.
+type WebhookPayload struct {
+	DeliveryID int64           `json:"delivery_id"`
+	EventID    int64           `json:"event_id"`
+	Type       string          `json:"type"`
+	Data       json.RawMessage `json:"data"`
+}
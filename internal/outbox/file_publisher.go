@@ -0,0 +1,51 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"users_balance/internal/models"
+)
+
+// FilePublisher writes events as JSON lines, to stdout when no path is given.
+// It is meant for local runs.
+type FilePublisher struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	if path == "" {
+		return &FilePublisher{w: os.Stdout}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FilePublisher{w: f}, nil
+}
+
+func (p *FilePublisher) Publish(_ context.Context, event models.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err = p.w.Write(append(line, '\n'))
+	return err
+}
+
+func (p *FilePublisher) Close() error {
+	if p.w == os.Stdout {
+		return nil
+	}
+
+	return p.w.Close()
+}
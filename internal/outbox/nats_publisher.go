@@ -0,0 +1,278 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"users_balance/internal/models"
+)
+
+// NATSOptions configures a NATSPublisher. URL is nats://host:port, or
+// tls://host:port to require TLS, and may carry user:password@ or token@.
+// User with Password, or Token, override the credentials of the URL. CAFile
+// verifies the server against other roots than the system ones, CertFile with
+// KeyFile present a client certificate.
+type NATSOptions struct {
+	URL           string
+	SubjectPrefix string
+	User          string
+	Password      string
+	Token         string
+	TLS           bool
+	CAFile        string
+	CertFile      string
+	KeyFile       string
+}
+
+// natsInfo is the part of the INFO of a server the publisher uses.
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	TLSRequired bool   `json:"tls_required"`
+	Name        string `json:"name"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+}
+
+// NATSPublisher publishes events to "<prefix>.<event type>" over the core NATS
+// text protocol. Every publish is followed by a PING so an event only counts as
+// delivered once the server has processed it. The connection is upgraded to
+// TLS when configured or when the server requires it.
+type NATSPublisher struct {
+	addr    string
+	prefix  string
+	connect natsConnect
+	// tls is nil unless TLS was configured
+	tls *tls.Config
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func NewNATSPublisher(opts NATSOptions) (*NATSPublisher, error) {
+	raw := opts.URL
+	if !strings.Contains(raw, "://") {
+		raw = "nats://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "nats url")
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, errors.Errorf("nats url: unknown scheme %q", u.Scheme)
+	}
+
+	p := &NATSPublisher{
+		addr:    u.Host,
+		prefix:  opts.SubjectPrefix,
+		connect: natsConnect{Name: "balance_api"},
+	}
+
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			p.connect.User, p.connect.Pass = u.User.Username(), password
+		} else {
+			p.connect.AuthToken = u.User.Username()
+		}
+	}
+	if opts.User != "" {
+		p.connect.User, p.connect.Pass, p.connect.AuthToken = opts.User, opts.Password, ""
+	}
+	if opts.Token != "" {
+		p.connect.User, p.connect.Pass, p.connect.AuthToken = "", "", opts.Token
+	}
+
+	if opts.TLS || u.Scheme == "tls" || opts.CAFile != "" || opts.CertFile != "" {
+		p.tls, err = natsTLSConfig(u.Hostname(), opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func natsTLSConfig(host string, opts NATSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+
+	if opts.CAFile != "" {
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "nats ca")
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("nats ca: no certificates in %s", opts.CAFile)
+		}
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "nats client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, event models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	subject := event.Type
+	if p.prefix != "" {
+		subject = p.prefix + "." + event.Type
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.dial(ctx); err != nil {
+		return err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	p.conn.SetDeadline(deadline)
+
+	msg := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+	if _, err := p.conn.Write([]byte(msg)); err != nil {
+		p.reset()
+		return errors.Wrap(err, "nats write")
+	}
+
+	if err := p.waitPong(); err != nil {
+		p.reset()
+		return err
+	}
+
+	return nil
+}
+
+func (p *NATSPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+// dial connects and authenticates, the server's answer to a PING after CONNECT
+// tells whether it accepted the credentials.
+func (p *NATSPublisher) dial(ctx context.Context) error {
+	if p.conn != nil {
+		return nil
+	}
+
+	var d net.Dialer
+	var conn net.Conn
+	conn, err := d.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return errors.Wrap(err, "nats dial")
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO") {
+		conn.Close()
+		return errors.New("nats: no INFO from server")
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "INFO"))), &info); err != nil {
+		conn.Close()
+		return errors.Wrap(err, "nats info")
+	}
+
+	if p.tls != nil || info.TLSRequired {
+		cfg := p.tls
+		if cfg == nil {
+			host, _, _ := net.SplitHostPort(p.addr)
+			cfg = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return errors.Wrap(err, "nats tls")
+		}
+		conn = tlsConn
+		r = bufio.NewReader(conn)
+	}
+
+	connect := p.connect
+	connect.TLSRequired = p.tls != nil || info.TLSRequired
+	payload, err := json.Marshal(connect)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if _, err := conn.Write([]byte("CONNECT " + string(payload) + "\r\nPING\r\n")); err != nil {
+		conn.Close()
+		return errors.Wrap(err, "nats connect")
+	}
+
+	p.conn = conn
+	p.r = r
+	if err := p.waitPong(); err != nil {
+		p.reset()
+		return errors.Wrap(err, "nats connect")
+	}
+
+	return nil
+}
+
+func (p *NATSPublisher) waitPong() error {
+	for {
+		line, err := p.r.ReadString('\n')
+		if err != nil {
+			return errors.Wrap(err, "nats read")
+		}
+
+		switch {
+		case strings.HasPrefix(line, "PONG"):
+			return nil
+		case strings.HasPrefix(line, "PING"):
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return errors.Wrap(err, "nats write")
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.Errorf("nats: %s", strings.TrimSpace(line))
+		}
+	}
+}
+
+func (p *NATSPublisher) reset() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn = nil
+	p.r = nil
+}
@@ -0,0 +1,91 @@
+package outbox
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+	"users_balance/internal/interfaces"
+)
+
+const defaultBatchSize = 100
+
+// Relay moves events from the outbox table to a publisher. An event is marked
+// published in the same transaction that locked it, after the publisher has
+// accepted it, so a crash in between only causes a redelivery.
+type Relay struct {
+	Log          *zap.SugaredLogger
+	DBHandler    interfaces.IDBHandler
+	OutboxRepo   interfaces.IOutboxRepo
+	Publisher    interfaces.IEventPublisher
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+// Run polls the outbox until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := r.relayBatch(ctx)
+			if err != nil {
+				r.Log.Warnf("outbox relay :: %s", err)
+				break
+			}
+			if n < r.batchSize() {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) relayBatch(ctx context.Context) (n int, err error) {
+	tx, err := r.DBHandler.StartTransaction(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err = r.DBHandler.FinishTransaction(ctx, tx, err)
+	}()
+
+	events, err := r.OutboxRepo.LockUnpublished(tx, r.batchSize())
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	// publish in order and stop at the first failure, the rest stays locked
+	// until commit and is retried on the next tick
+	published := make([]int64, 0, len(events))
+	for _, event := range events {
+		if err := r.Publisher.Publish(ctx, event); err != nil {
+			r.Log.Warnf("outbox relay :: publish event %d :: %s", event.ID, err)
+			break
+		}
+		published = append(published, event.ID)
+	}
+
+	if len(published) == 0 {
+		return 0, nil
+	}
+
+	if err := r.OutboxRepo.MarkPublished(tx, published); err != nil {
+		return 0, err
+	}
+
+	return len(published), nil
+}
+
+func (r *Relay) batchSize() int {
+	if r.BatchSize <= 0 {
+		return defaultBatchSize
+	}
+
+	return r.BatchSize
+}
@@ -0,0 +1,52 @@
+package payouts
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+	"users_balance/internal/interfaces"
+)
+
+// Pool runs Workers goroutines that apply pending payout rows one at a time.
+// Rows are locked with SKIP LOCKED, so pools of several replicas share the
+// work.
+type Pool struct {
+	Log          *zap.SugaredLogger
+	Service      interfaces.IPayoutService
+	Workers      int
+	PollInterval time.Duration
+}
+
+// Run processes rows until ctx is cancelled, idle workers poll every
+// PollInterval.
+func (p *Pool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < p.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Pool) work(ctx context.Context) {
+	for {
+		processed, err := p.Service.ProcessNext(ctx)
+		if err != nil {
+			p.Log.Warnf("payouts :: %s", err)
+		}
+
+		if processed && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.PollInterval):
+		}
+	}
+}
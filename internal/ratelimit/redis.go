@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+	"users_balance/internal/redis"
+)
+
+// tokenBucketScript refills and takes from a bucket stored as a hash. It
+// returns {allowed, milliseconds until the next token}.
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local state = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + (now - last) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call("HSET", KEYS[1], "tokens", tokens, "last", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, wait}
+`
+
+// RedisStore keeps token buckets in any server speaking the Redis protocol
+// with Lua scripting, so limits are shared between replicas.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(addr string) *RedisStore {
+	return &RedisStore{
+		client: redis.NewClient(addr),
+	}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	reply, err := s.client.Do(ctx, "EVAL", tokenBucketScript, "1", "ratelimit:"+key,
+		strconv.FormatFloat(rate, 'f', -1, 64), strconv.Itoa(burst))
+	if err != nil {
+		return false, 0, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, errors.Errorf("redis: unexpected reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	wait, _ := values[1].(int64)
+
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
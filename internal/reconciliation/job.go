@@ -0,0 +1,76 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"time"
+	"users_balance/internal/interfaces"
+)
+
+// Job reconciles balances on a schedule. Each run is logged and, when
+// ReportDir is set, written there as a report file. Fix is safe with several
+// replicas running the job, corrections are rechecked under a row lock.
+type Job struct {
+	Log       *zap.SugaredLogger
+	Service   interfaces.IReconciliationService
+	Interval  time.Duration
+	Fix       bool
+	ReportDir string
+	Format    string
+}
+
+// Run reconciles every Interval until ctx is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := j.runOnce(ctx); err != nil {
+			j.Log.Warnf("reconciliation :: %s", err)
+		}
+	}
+}
+
+func (j *Job) runOnce(ctx context.Context) error {
+	report, err := j.Service.Reconcile(ctx, j.Fix)
+	if err != nil {
+		return err
+	}
+
+	if len(report.Discrepancies) == 0 {
+		j.Log.Infof("reconciliation :: balances match")
+		return nil
+	}
+	j.Log.Warnf("reconciliation :: %d discrepancies, fixed: %t", len(report.Discrepancies), report.Fixed)
+
+	if j.ReportDir == "" {
+		return nil
+	}
+
+	format := j.Format
+	if format == "" {
+		format = FormatJSON
+	}
+	name := fmt.Sprintf("reconciliation-%s.%s", report.StartedAt.Format("20060102T150405Z"), format)
+
+	f, err := os.Create(filepath.Join(j.ReportDir, name))
+	if err != nil {
+		return err
+	}
+
+	if err := WriteReport(f, report, format); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
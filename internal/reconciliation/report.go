@@ -0,0 +1,67 @@
+package reconciliation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"users_balance/internal/models"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+var csvHeader = []string{"uuid", "expected", "actual", "difference", "first_divergent_transaction", "correction_transaction"}
+
+// WriteReport writes a report as JSON, or as CSV with one discrepancy per row.
+func WriteReport(w io.Writer, report models.ReconciliationReport, format string) error {
+	switch format {
+	case FormatJSON, "":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatCSV:
+		return writeCSV(w, report)
+	default:
+		return errors.Errorf("unknown report format %q", format)
+	}
+}
+
+func writeCSV(w io.Writer, report models.ReconciliationReport) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, d := range report.Discrepancies {
+		err := cw.Write([]string{
+			d.UserID,
+			formatAmount(d.Expected),
+			formatAmount(d.Actual),
+			formatAmount(d.Difference),
+			stringOrEmpty(d.FirstDivergentTransaction),
+			stringOrEmpty(d.CorrectionTransaction),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
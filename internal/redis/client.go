@@ -0,0 +1,137 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const poolSize = 8
+
+// Client runs commands on any server speaking the Redis protocol over a small
+// pool of connections.
+type Client struct {
+	addr  string
+	conns chan *conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func NewClient(addr string) *Client {
+	return &Client{
+		addr:  addr,
+		conns: make(chan *conn, poolSize),
+	}
+}
+
+// Do runs a command and returns its reply: a string, an int64, nil or a
+// []interface{} of those.
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Second))
+	}
+
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := conn.Write([]byte(cmd.String())); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "redis write")
+	}
+
+	reply, err := readReply(conn.r)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "redis read")
+	}
+
+	c.release(conn)
+	return reply, nil
+}
+
+func (c *Client) acquire(ctx context.Context) (*conn, error) {
+	select {
+	case conn := <-c.conns:
+		return conn, nil
+	default:
+	}
+
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "redis dial")
+	}
+
+	return &conn{Conn: nc, r: bufio.NewReader(nc)}, nil
+}
+
+func (c *Client) release(conn *conn) {
+	select {
+	case c.conns <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, errors.New("short reply")
+	}
+	payload := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, errors.New(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, errors.Errorf("unknown reply type %q", line[0])
+	}
+}
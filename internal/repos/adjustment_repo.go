@@ -0,0 +1,162 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"users_balance/internal/models"
+)
+
+const adjustmentColumns = `id, user_uuid, amount, currency, reason, status, proposed_by, reviewed_by, transaction_id, error,
+						   created_at, reviewed_at`
+
+type AdjustmentRepo struct {
+	Log *zap.SugaredLogger
+}
+
+func (r *AdjustmentRepo) CreateAdjustment(conn *pgxpool.Conn, req models.AdjustmentProposal, operator string) (models.ManualAdjustment, error) {
+	const CreateAdjustmentStatement = `INSERT INTO manual_adjustments (user_uuid, amount, currency, reason, proposed_by)
+									   VALUES ($1, $2, $3, $4, $5)
+									   RETURNING ` + adjustmentColumns + `;`
+
+	adj, err := scanAdjustment(conn.QueryRow(context.Background(), CreateAdjustmentStatement, req.UserID, req.Amount,
+		req.Currency, req.Reason, operator))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.ManualAdjustment{}, err
+	}
+
+	return adj, nil
+}
+
+func (r *AdjustmentRepo) GetAdjustment(conn *pgxpool.Conn, id string) (models.ManualAdjustment, error) {
+	const GetAdjustmentStatement = `SELECT ` + adjustmentColumns + ` FROM manual_adjustments WHERE id = $1;`
+
+	adj, err := scanAdjustment(conn.QueryRow(context.Background(), GetAdjustmentStatement, id))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.ManualAdjustment{}, err
+	}
+
+	return adj, nil
+}
+
+// LockAdjustment reads an adjustment and locks it until the transaction of the
+// caller ends, reviews of it made at once wait for each other.
+func (r *AdjustmentRepo) LockAdjustment(conn *pgxpool.Conn, id string) (models.ManualAdjustment, error) {
+	const LockAdjustmentStatement = `SELECT ` + adjustmentColumns + ` FROM manual_adjustments WHERE id = $1 FOR UPDATE;`
+
+	adj, err := scanAdjustment(conn.QueryRow(context.Background(), LockAdjustmentStatement, id))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.ManualAdjustment{}, err
+	}
+
+	return adj, nil
+}
+
+func (r *AdjustmentRepo) ListAdjustments(conn *pgxpool.Conn, req models.AdjustmentsListRequest) ([]models.ManualAdjustment, error) {
+	const ListAdjustmentsStatement = `SELECT ` + adjustmentColumns + ` FROM manual_adjustments
+									  WHERE $1 = '' OR status = $1
+									  ORDER BY created_at DESC
+									  LIMIT $2
+									  OFFSET $3;`
+
+	rows, err := conn.Query(context.Background(), ListAdjustmentsStatement, req.Status, req.Limit, req.Offset)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.ManualAdjustment{}
+	for rows.Next() {
+		adj, err := scanAdjustment(rows)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		list = append(list, adj)
+	}
+
+	return list, rows.Err()
+}
+
+// ReviewAdjustment approves or rejects a pending adjustment proposed by
+// another operator. It matches no row otherwise.
+func (r *AdjustmentRepo) ReviewAdjustment(conn *pgxpool.Conn, id string, operator string, status string) (models.ManualAdjustment, error) {
+	const ReviewAdjustmentStatement = `UPDATE manual_adjustments SET status = $3, reviewed_by = $2, reviewed_at = now()
+									   WHERE id = $1 AND status = 'pending' AND proposed_by <> $2
+									   RETURNING ` + adjustmentColumns + `;`
+
+	adj, err := scanAdjustment(conn.QueryRow(context.Background(), ReviewAdjustmentStatement, id, operator, status))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.ManualAdjustment{}, err
+	}
+
+	return adj, nil
+}
+
+// FinishAdjustment records the outcome of posting an approved adjustment.
+func (r *AdjustmentRepo) FinishAdjustment(conn *pgxpool.Conn, id string, status string, trxID *string, reason *string) (models.ManualAdjustment, error) {
+	const FinishAdjustmentStatement = `UPDATE manual_adjustments SET status = $2, transaction_id = $3, error = $4
+									   WHERE id = $1 AND status = 'approved'
+									   RETURNING ` + adjustmentColumns + `;`
+
+	adj, err := scanAdjustment(conn.QueryRow(context.Background(), FinishAdjustmentStatement, id, status, trxID, reason))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.ManualAdjustment{}, err
+	}
+
+	return adj, nil
+}
+
+func (r *AdjustmentRepo) InsertAuditEntry(conn *pgxpool.Conn, entry models.AuditEntry) error {
+	const InsertAuditEntryStatement = `INSERT INTO admin_audit_log (adjustment_id, action, actor, details)
+									   VALUES ($1, $2, $3, $4);`
+
+	_, err := conn.Exec(context.Background(), InsertAuditEntryStatement, entry.AdjustmentID, entry.Action, entry.Actor,
+		entry.Details)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *AdjustmentRepo) ListAuditEntries(conn *pgxpool.Conn, adjustmentID string) ([]models.AuditEntry, error) {
+	const ListAuditEntriesStatement = `SELECT id, adjustment_id, action, actor, details, created_at FROM admin_audit_log
+									   WHERE adjustment_id = $1 ORDER BY id;`
+
+	rows, err := conn.Query(context.Background(), ListAuditEntriesStatement, adjustmentID)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		err := rows.Scan(&entry.ID, &entry.AdjustmentID, &entry.Action, &entry.Actor, &entry.Details, &entry.CreatedAt)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func scanAdjustment(row pgx.Row) (models.ManualAdjustment, error) {
+	var adj models.ManualAdjustment
+	err := row.Scan(&adj.ID, &adj.UserID, &adj.Amount, &adj.Currency, &adj.Reason, &adj.Status, &adj.ProposedBy,
+		&adj.ReviewedBy, &adj.TransactionID, &adj.Error, &adj.CreatedAt, &adj.ReviewedAt)
+
+	return adj, err
+}
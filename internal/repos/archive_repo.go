@@ -0,0 +1,190 @@
+package balance_repos
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"time"
+	"users_balance/internal/models"
+)
+
+type ArchiveRepo struct {
+	Log *zap.SugaredLogger
+}
+
+// CreatePartition adds the partition of the month of the given moment, it
+// returns false when it exists.
+func (r *ArchiveRepo) CreatePartition(conn *pgxpool.Conn, month time.Time) (bool, error) {
+	const CreatePartitionStatement = `SELECT create_transactions_partition($1);`
+
+	var created bool
+	err := conn.QueryRow(context.Background(), CreatePartitionStatement, month).Scan(&created)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return false, err
+	}
+
+	return created, nil
+}
+
+// ListPartitions returns the monthly partitions of the transactions table,
+// the oldest first.
+func (r *ArchiveRepo) ListPartitions(conn *pgxpool.Conn) ([]models.TransactionPartition, error) {
+	const ListPartitionsStatement = `SELECT c.relname FROM pg_inherits i
+									 JOIN pg_class c ON c.oid = i.inhrelid
+									 WHERE i.inhparent = 'transactions'::regclass
+									 AND c.relname ~ '^transactions_[0-9]{4}_[0-9]{2}$'
+									 ORDER BY c.relname;`
+
+	rows, err := conn.Query(context.Background(), ListPartitionsStatement)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []models.TransactionPartition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+
+		var year, month int
+		if _, err := fmt.Sscanf(name, "transactions_%04d_%02d", &year, &month); err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+		from := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		partitions = append(partitions, models.TransactionPartition{Name: name, From: from, To: from.AddDate(0, 1, 0)})
+	}
+
+	return partitions, rows.Err()
+}
+
+// ExportPartition calls fn with the user and each transaction of a partition,
+// in the order they were made.
+func (r *ArchiveRepo) ExportPartition(conn *pgxpool.Conn, partition string, fn func(userUUID string, trx models.Transaction) error) error {
+	statement := `SELECT COALESCE(user_uuid::text, ''), trx_uuid, created_at, COALESCE(who, ''),
+				  COALESCE(description, ''), COALESCE(amount, 0), COALESCE(currency, ''), operation
+				  FROM ` + pgx.Identifier{partition}.Sanitize() + `
+				  ORDER BY created_at, trx_uuid;`
+
+	rows, err := conn.Query(context.Background(), statement)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userUUID string
+		var trx models.Transaction
+		err := rows.Scan(&userUUID, &trx.TrxID, &trx.CreatedAt, &trx.Who, &trx.Description, &trx.Amount,
+			&trx.Currency, &trx.Operation)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return err
+		}
+		if err := fn(userUUID, trx); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ArchivePartition records an archived partition, adds its transactions to
+// the archived balances of their users and drops it. It fails when the
+// partition no longer holds the transactions that were archived.
+func (r *ArchiveRepo) ArchivePartition(conn *pgxpool.Conn, archive models.TransactionArchive) error {
+	partition := pgx.Identifier{archive.Partition}.Sanitize()
+	countStatement := `SELECT COUNT(*) FROM ` + partition + `;`
+	foldStatement := `INSERT INTO archived_balances (user_uuid, amount, transactions)
+					  SELECT user_uuid, SUM(amount::float8), COUNT(*) FROM ` + partition + `
+					  WHERE user_uuid IS NOT NULL
+					  GROUP BY user_uuid
+					  ON CONFLICT (user_uuid) DO UPDATE
+					  SET amount = archived_balances.amount + EXCLUDED.amount,
+					  transactions = archived_balances.transactions + EXCLUDED.transactions;`
+	const RecordArchiveStatement = `INSERT INTO transaction_archives
+									(partition, range_start, range_end, location, format, transactions, amount, sha256)
+									VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+	dropStatement := `DROP TABLE ` + partition + `;`
+
+	ctx := context.Background()
+
+	var count int64
+	if err := conn.QueryRow(ctx, countStatement).Scan(&count); err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+	if count != archive.Transactions {
+		return errors.Errorf("%s holds %d transactions, %d were archived", archive.Partition, count,
+			archive.Transactions)
+	}
+
+	if _, err := conn.Exec(ctx, foldStatement); err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	_, err := conn.Exec(ctx, RecordArchiveStatement, archive.Partition, archive.From, archive.To, archive.Location,
+		archive.Format, archive.Transactions, archive.Amount, archive.SHA256)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	if _, err := conn.Exec(ctx, dropStatement); err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ArchivedBefore returns the moment the transactions of a user are complete
+// from, nil while none of them were archived.
+func (r *ArchiveRepo) ArchivedBefore(conn *pgxpool.Conn, userUUID string) (*time.Time, error) {
+	const ArchivedBeforeStatement = `SELECT transactions_archived_before($1);`
+
+	var before *time.Time
+	err := conn.QueryRow(context.Background(), ArchivedBeforeStatement, userUUID).Scan(&before)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+
+	return before, nil
+}
+
+// TryArchiveLock takes the archive lock for the session of conn, it returns
+// false when another session holds it.
+func (r *ArchiveRepo) TryArchiveLock(conn *pgxpool.Conn) (bool, error) {
+	const TryArchiveLockStatement = `SELECT pg_try_advisory_lock(hashtext('transaction_archives'));`
+
+	var locked bool
+	err := conn.QueryRow(context.Background(), TryArchiveLockStatement).Scan(&locked)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return false, err
+	}
+
+	return locked, nil
+}
+
+func (r *ArchiveRepo) ReleaseArchiveLock(conn *pgxpool.Conn) error {
+	const ReleaseArchiveLockStatement = `SELECT pg_advisory_unlock(hashtext('transaction_archives'));`
+
+	_, err := conn.Exec(context.Background(), ReleaseArchiveLockStatement)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"users_balance/internal/models"
+)
+
+type AuditRepo struct {
+	Log *zap.SugaredLogger
+}
+
+// ListChain returns up to limit links following afterSeq, in chain order.
+func (r *AuditRepo) ListChain(conn *pgxpool.Conn, afterSeq int64, limit int) ([]models.AuditChainEntry, error) {
+	const ListChainStatement = `SELECT seq, entity, entity_id, payload, prev_hash, hash, created_at FROM audit_chain
+								WHERE seq > $1
+								ORDER BY seq
+								LIMIT $2;`
+
+	rows, err := conn.Query(context.Background(), ListChainStatement, afterSeq, limit)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditChainEntry
+	for rows.Next() {
+		var entry models.AuditChainEntry
+		err := rows.Scan(&entry.Seq, &entry.Entity, &entry.EntityID, &entry.Payload, &entry.PrevHash, &entry.Hash,
+			&entry.CreatedAt)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// SequencePending chains up to limit committed pending links and returns how
+// many it chained.
+func (r *AuditRepo) SequencePending(conn *pgxpool.Conn, limit int) (int, error) {
+	const SequencePendingStatement = `SELECT audit_chain_sequence($1);`
+
+	var chained int
+	err := conn.QueryRow(context.Background(), SequencePendingStatement, limit).Scan(&chained)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return 0, err
+	}
+
+	return chained, nil
+}
+
+// ChainHead returns the number of links and the last one.
+func (r *AuditRepo) ChainHead(conn *pgxpool.Conn) (int64, models.AuditChainEntry, error) {
+	const ChainHeadStatement = `SELECT (SELECT COUNT(*) FROM audit_chain), seq, hash, created_at FROM audit_chain
+								ORDER BY seq DESC
+								LIMIT 1;`
+
+	var count int64
+	var head models.AuditChainEntry
+	err := conn.QueryRow(context.Background(), ChainHeadStatement).Scan(&count, &head.Seq, &head.Hash, &head.CreatedAt)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return 0, models.AuditChainEntry{}, err
+	}
+
+	return count, head, nil
+}
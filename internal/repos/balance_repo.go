@@ -3,9 +3,11 @@ package balance_repos
 import (
 	"context"
 	"encoding/json"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"go.uber.org/zap"
 	"net/http"
+	"time"
 	"users_balance/internal/config"
 	"users_balance/internal/models"
 )
@@ -17,9 +19,9 @@ type UserBalanceRepo struct {
 }
 
 func (r *UserBalanceRepo) GetUserBalance(conn *pgxpool.Conn, uuid string) (models.User, error) {
-	const GetUserBalanceStatement = `SELECT * FROM users WHERE uuid = $1;`
+	const GetUserBalanceStatement = `SELECT uuid, account_balance(users), status FROM users WHERE uuid = $1;`
 	var user models.User
-	err := conn.QueryRow(context.Background(), GetUserBalanceStatement, uuid).Scan(&user.ID, &user.Balance)
+	err := conn.QueryRow(context.Background(), GetUserBalanceStatement, uuid).Scan(&user.ID, &user.Balance, &user.Status)
 	if err != nil {
 		r.Log.Info(err.Error())
 		return models.User{}, err
@@ -28,20 +30,164 @@ func (r *UserBalanceRepo) GetUserBalance(conn *pgxpool.Conn, uuid string) (model
 	return user, nil
 }
 
+// LockUserBalance reads an account like GetUserBalance and locks its users row
+// until the transaction of the caller ends, so its status can not change
+// meanwhile. An exclusive lock also keeps other exclusive holders and debits
+// out, credits are never kept out of the shards of a hot account.
+func (r *UserBalanceRepo) LockUserBalance(conn *pgxpool.Conn, uuid string, exclusive bool) (models.User, error) {
+	const LockUserBalanceStatement = `SELECT uuid, account_balance(users), status FROM users WHERE uuid = $1
+									  FOR NO KEY UPDATE;`
+	const ShareUserBalanceStatement = `SELECT uuid, account_balance(users), status FROM users WHERE uuid = $1
+									   FOR KEY SHARE;`
+
+	statement := ShareUserBalanceStatement
+	if exclusive {
+		statement = LockUserBalanceStatement
+	}
+
+	var user models.User
+	err := conn.QueryRow(context.Background(), statement, uuid).Scan(&user.ID, &user.Balance, &user.Status)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// UpdateAccount changes the balance of an account. A hot account, which has
+// shards, is changed through them and its whole balance is returned.
 func (r *UserBalanceRepo) UpdateAccount(conn *pgxpool.Conn, req models.UserBalanceUpdate) (models.User, error) {
-	const UpdateAccountStatement = `UPDATE users SET balance = balance + $2 WHERE uuid = $1
+	user, err := r.updateUnsharded(conn, req)
+	if err == pgx.ErrNoRows {
+		return r.updateShards(conn, req)
+	}
+
+	return user, err
+}
+
+// updateShards credits a shard of a hot account picked at random, so credits
+// running at once mostly hold different rows, or drains every shard into the
+// users row and debits it there. It runs in the transaction of the caller.
+func (r *UserBalanceRepo) updateShards(conn *pgxpool.Conn, req models.UserBalanceUpdate) (models.User, error) {
+	const CreditShardStatement = `UPDATE balance_shards SET balance = balance + $2
+								  WHERE uuid = $1 AND shard = (SELECT floor(random() * shards)::int FROM users
+															   WHERE uuid = $1 AND shards > 0 FOR KEY SHARE);`
+	const DebitAccountStatement = `UPDATE users SET balance = balance + $2 WHERE uuid = $1;`
+
+	if req.Amount >= 0 {
+		tag, err := conn.Exec(context.Background(), CreditShardStatement, req.UserID, req.Amount)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return models.User{}, err
+		}
+		if tag.RowsAffected() == 0 {
+			// unknown, or its shards were folded back since the first update
+			return r.updateUnsharded(conn, req)
+		}
+
+		return r.GetUserBalance(conn, req.UserID)
+	}
+
+	drained, err := r.drainShards(conn, req.UserID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	tag, err := conn.Exec(context.Background(), DebitAccountStatement, req.UserID, req.Amount+drained)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.User{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.User{}, pgx.ErrNoRows
+	}
+
+	return r.GetUserBalance(conn, req.UserID)
+}
+
+func (r *UserBalanceRepo) updateUnsharded(conn *pgxpool.Conn, req models.UserBalanceUpdate) (models.User, error) {
+	const UpdateAccountStatement = `UPDATE users SET balance = balance + $2 WHERE uuid = $1 AND shards = 0
 								   RETURNING "uuid", "balance";`
 
 	var user models.User
 	err := conn.QueryRow(context.Background(), UpdateAccountStatement, req.UserID, req.Amount).Scan(&user.ID, &user.Balance)
 	if err != nil {
-		r.Log.Info(err.Error())
+		// no row is also how a hot account answers, not worth a line
+		if err != pgx.ErrNoRows {
+			r.Log.Info(err.Error())
+		}
 		return models.User{}, err
 	}
 
 	return user, nil
 }
 
+// drainShards locks the shards of an account, in order so drains do not
+// deadlock, sets them to zero and returns what they held. The caller adds it
+// to the users row in the same transaction.
+func (r *UserBalanceRepo) drainShards(conn *pgxpool.Conn, uuid string) (float64, error) {
+	const LockShardsStatement = `SELECT COALESCE(SUM(balance), 0) FROM (
+									SELECT balance FROM balance_shards WHERE uuid = $1 ORDER BY shard FOR UPDATE
+								 ) AS locked;`
+	const DrainShardsStatement = `UPDATE balance_shards SET balance = 0 WHERE uuid = $1 AND balance <> 0;`
+
+	var drained float64
+	err := conn.QueryRow(context.Background(), LockShardsStatement, uuid).Scan(&drained)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return 0, err
+	}
+
+	_, err = conn.Exec(context.Background(), DrainShardsStatement, uuid)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return 0, err
+	}
+
+	return drained, nil
+}
+
+// SetAccountShards folds the shards of an account into its users row and gives
+// it shards new empty ones, none when shards is 0. It runs in the transaction
+// of the caller.
+func (r *UserBalanceRepo) SetAccountShards(conn *pgxpool.Conn, uuid string, shards int) (models.Account, error) {
+	const LockAccountStatement = `SELECT uuid FROM users WHERE uuid = $1 FOR UPDATE;`
+	const FoldShardsStatement = `UPDATE users SET balance = balance + $2, shards = $3 WHERE uuid = $1;`
+	const DeleteShardsStatement = `DELETE FROM balance_shards WHERE uuid = $1;`
+	const CreateShardsStatement = `INSERT INTO balance_shards (uuid, shard)
+								   SELECT $1, shard FROM generate_series(0, $2 - 1) AS shard;`
+
+	ctx := context.Background()
+	var locked string
+	if err := conn.QueryRow(ctx, LockAccountStatement, uuid).Scan(&locked); err != nil {
+		r.Log.Info(err.Error())
+		return models.Account{}, err
+	}
+
+	drained, err := r.drainShards(conn, uuid)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	if _, err := conn.Exec(ctx, FoldShardsStatement, uuid, drained, shards); err != nil {
+		r.Log.Info(err.Error())
+		return models.Account{}, err
+	}
+
+	if _, err := conn.Exec(ctx, DeleteShardsStatement, uuid); err != nil {
+		r.Log.Info(err.Error())
+		return models.Account{}, err
+	}
+
+	if _, err := conn.Exec(ctx, CreateShardsStatement, uuid, shards); err != nil {
+		r.Log.Info(err.Error())
+		return models.Account{}, err
+	}
+
+	return r.GetAccount(conn, uuid)
+}
+
 func (r *UserBalanceRepo) CreateUser(conn *pgxpool.Conn, req models.UserBalanceUpdate) (models.User, error) {
 	const CreateUserStatement = `INSERT INTO users (uuid, balance) VALUES ($1, $2) 
 								 RETURNING "uuid", "balance";`
@@ -57,20 +203,89 @@ func (r *UserBalanceRepo) CreateUser(conn *pgxpool.Conn, req models.UserBalanceU
 	return user, nil
 }
 
+func (r *UserBalanceRepo) CreateAccount(conn *pgxpool.Conn, req models.NewAccount) (models.Account, error) {
+	const CreateAccountStatement = `INSERT INTO users (uuid, balance, tier)
+									VALUES (COALESCE($1::uuid, uuid_generate_v4()), 0, COALESCE(NULLIF($2, ''), 'default'))
+									RETURNING uuid, balance, tier, status, created_at, shards;`
+
+	var userID *string
+	if req.UserID != "" {
+		userID = &req.UserID
+	}
+
+	var account models.Account
+	err := conn.QueryRow(context.Background(), CreateAccountStatement, userID, req.Tier).Scan(&account.ID,
+		&account.Balance, &account.Tier, &account.Status, &account.CreatedAt, &account.Shards)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Account{}, err
+	}
+
+	return account, nil
+}
+
+func (r *UserBalanceRepo) GetAccount(conn *pgxpool.Conn, uuid string) (models.Account, error) {
+	const GetAccountStatement = `SELECT uuid, account_balance(users), tier, status, created_at, shards
+								 FROM users WHERE uuid = $1;`
+
+	var account models.Account
+	err := conn.QueryRow(context.Background(), GetAccountStatement, uuid).Scan(&account.ID, &account.Balance,
+		&account.Tier, &account.Status, &account.CreatedAt, &account.Shards)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Account{}, err
+	}
+
+	return account, nil
+}
+
+// SetAccountStatus moves the account from one of the given states to status.
+// Closing additionally requires a zero balance, checked in the same statement.
+// It first locks the users row against every other lock, so it waits for the
+// balance changes that checked the old status and those to come see the new
+// one. It runs in the transaction of the caller.
+func (r *UserBalanceRepo) SetAccountStatus(conn *pgxpool.Conn, uuid string, from []string, status string) (models.Account, error) {
+	const LockAccountStatement = `SELECT uuid FROM users WHERE uuid = $1 FOR UPDATE;`
+	const SetAccountStatusStatement = `UPDATE users SET status = $3
+									   WHERE uuid = $1 AND status = ANY($2) AND ($3 <> 'closed' OR account_balance(users) = 0)
+									   RETURNING uuid, account_balance(users), tier, status, created_at, shards;`
+
+	var locked string
+	if err := conn.QueryRow(context.Background(), LockAccountStatement, uuid).Scan(&locked); err != nil {
+		r.Log.Info(err.Error())
+		return models.Account{}, err
+	}
+
+	var account models.Account
+	err := conn.QueryRow(context.Background(), SetAccountStatusStatement, uuid, from, status).Scan(&account.ID,
+		&account.Balance, &account.Tier, &account.Status, &account.CreatedAt, &account.Shards)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Account{}, err
+	}
+
+	return account, nil
+}
+
 func (r *UserBalanceRepo) InsertTransaction(conn *pgxpool.Conn, req models.UserBalanceUpdate) (models.Transaction, error) {
-	const UpdateTransactionListStatement = `INSERT INTO transactions (user_uuid, who, description, amount, currency) 
-											VALUES ($1, $2, $3, $4, $5)
-											RETURNING "trx_uuid", CAST("trx_date" AS text), CAST("trx_time" AS text);`
+	const UpdateTransactionListStatement = `INSERT INTO transactions (user_uuid, who, description, amount, currency, operation, reverses) 
+											VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::uuid)
+											RETURNING trx_uuid, created_at;`
+
+	if req.Operation == "" {
+		req.Operation = models.OperationUpdate
+	}
 
 	trx := models.Transaction{
 		Who:         req.Who,
 		Description: req.Description,
 		Amount:      req.Amount,
 		Currency:    req.Currency,
+		Operation:   req.Operation,
 	}
 
 	err := conn.QueryRow(context.Background(), UpdateTransactionListStatement, req.UserID, req.Who, req.Description,
-		req.Amount, req.Currency).Scan(&trx.TrxID, &trx.Date, &trx.Time)
+		req.Amount, req.Currency, req.Operation, req.Reverses).Scan(&trx.TrxID, &trx.CreatedAt)
 	if err != nil {
 		r.Log.Info(err.Error())
 		return models.Transaction{}, err
@@ -80,12 +295,12 @@ func (r *UserBalanceRepo) InsertTransaction(conn *pgxpool.Conn, req models.UserB
 }
 
 func (r *UserBalanceRepo) GetTransaction(conn *pgxpool.Conn, userUUID string, trxUUID string) (models.Transaction, error) {
-	const GetTransactionStatement = `SELECT trx_uuid, CAST("trx_date" AS text), CAST("trx_time" AS text), who, description, amount, currency 
-									  FROM transactions WHERE uuid = $1 && rtx_uuid = $2;`
+	const GetTransactionStatement = `SELECT trx_uuid, created_at, who, description, amount, currency, operation
+									  FROM transactions WHERE user_uuid = $1 AND trx_uuid = $2;`
 
 	var trx models.Transaction
 	err := conn.QueryRow(context.Background(), GetTransactionStatement, userUUID,
-		trxUUID).Scan(&trx.TrxID, &trx.Date, &trx.Time, &trx.Who, &trx.Description, &trx.Amount, &trx.Currency)
+		trxUUID).Scan(&trx.TrxID, &trx.CreatedAt, &trx.Who, &trx.Description, &trx.Amount, &trx.Currency, &trx.Operation)
 	if err != nil {
 		r.Log.Info(err.Error())
 		return models.Transaction{}, err
@@ -95,8 +310,9 @@ func (r *UserBalanceRepo) GetTransaction(conn *pgxpool.Conn, userUUID string, tr
 }
 
 func (r *UserBalanceRepo) GetTransactionsList(conn *pgxpool.Conn, userID string, limit int64, offset int64) ([]models.Transaction, error) {
-	const GetTransactionsListStatement = `SELECT trx_uuid, CAST("trx_date" AS text), CAST("trx_time" AS text), u_timestamp, who, description, amount, currency 
-									  	   FROM transactions WHERE user_uuid = $1 
+	const GetTransactionsListStatement = `SELECT trx_uuid, created_at, who, description, amount, currency, operation
+									  	   FROM transactions WHERE user_uuid = $1
+									  	   ORDER BY created_at, trx_uuid
 									  	   LIMIT $2
 									 	   OFFSET $3;`
 
@@ -109,7 +325,7 @@ func (r *UserBalanceRepo) GetTransactionsList(conn *pgxpool.Conn, userID string,
 
 	for rows.Next() {
 		var trx models.Transaction
-		err := rows.Scan(&trx.TrxID, &trx.Date, &trx.Time, &trx.Timestamp, &trx.Who, &trx.Description, &trx.Amount, &trx.Currency)
+		err := rows.Scan(&trx.TrxID, &trx.CreatedAt, &trx.Who, &trx.Description, &trx.Amount, &trx.Currency, &trx.Operation)
 		if err != nil {
 			r.Log.Info(err.Error())
 			return nil, err
@@ -120,6 +336,51 @@ func (r *UserBalanceRepo) GetTransactionsList(conn *pgxpool.Conn, userID string,
 	return trxList, nil
 }
 
+// GetBalanceBefore sums the user's transactions made before the given moment,
+// which is not before the archived ones.
+func (r *UserBalanceRepo) GetBalanceBefore(conn *pgxpool.Conn, userID string, at time.Time) (float64, error) {
+	const GetBalanceBeforeStatement = `SELECT COALESCE((SELECT amount FROM archived_balances WHERE user_uuid = $1), 0)
+									   + COALESCE(SUM(amount::float8), 0) FROM transactions
+									   WHERE user_uuid = $1 AND created_at < $2;`
+
+	var balance float64
+	err := conn.QueryRow(context.Background(), GetBalanceBeforeStatement, userID, at).Scan(&balance)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+// GetTransactionsBetween returns the user's transactions made from one moment
+// until another, excluded, in the order they were made.
+func (r *UserBalanceRepo) GetTransactionsBetween(conn *pgxpool.Conn, userID string, from time.Time, to time.Time) ([]models.Transaction, error) {
+	const GetTransactionsBetweenStatement = `SELECT trx_uuid, created_at, who, description, amount, currency, operation
+											 FROM transactions WHERE user_uuid = $1 AND created_at >= $2 AND created_at < $3
+											 ORDER BY created_at, trx_uuid;`
+
+	rows, err := conn.Query(context.Background(), GetTransactionsBetweenStatement, userID, from, to)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trxList []models.Transaction
+	for rows.Next() {
+		var trx models.Transaction
+		err := rows.Scan(&trx.TrxID, &trx.CreatedAt, &trx.Who, &trx.Description, &trx.Amount, &trx.Currency, &trx.Operation)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		trxList = append(trxList, trx)
+	}
+
+	return trxList, rows.Err()
+}
+
 func (r *UserBalanceRepo) GetExchangeRate(request *http.Request) (float64, error) {
 	resp, err := r.Client.Do(request)
 	if err != nil || resp.StatusCode != http.StatusOK {
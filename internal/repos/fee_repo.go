@@ -0,0 +1,32 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"users_balance/internal/models"
+)
+
+type FeeRepo struct {
+	Log *zap.SugaredLogger
+}
+
+// GetFeeRule picks the rule for the user's tier, falling back to the '*' tier.
+// Unknown users are treated as the default tier.
+func (r *FeeRepo) GetFeeRule(conn *pgxpool.Conn, operation string, currency string, userUUID string) (models.FeeRule, error) {
+	const GetFeeRuleStatement = `SELECT operation, currency, tier, percent, fixed, max_fee FROM fee_schedule
+								 WHERE operation = $1 AND currency = $2
+								 AND tier IN (COALESCE((SELECT tier FROM users WHERE uuid = $3), 'default'), '*')
+								 ORDER BY tier = '*'
+								 LIMIT 1;`
+
+	var rule models.FeeRule
+	err := conn.QueryRow(context.Background(), GetFeeRuleStatement, operation, currency, userUUID).Scan(&rule.Operation,
+		&rule.Currency, &rule.Tier, &rule.Percent, &rule.Fixed, &rule.MaxFee)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.FeeRule{}, err
+	}
+
+	return rule, nil
+}
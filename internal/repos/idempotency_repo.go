@@ -0,0 +1,86 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"time"
+	"users_balance/internal/models"
+)
+
+type IdempotencyRepo struct {
+	Log *zap.SugaredLogger
+}
+
+// Claim takes the key for the request, a key older than ttl is taken over.
+// When the key is held it returns the stored request instead.
+func (r *IdempotencyRepo) Claim(conn *pgxpool.Conn, key models.IdempotencyKey, ttl time.Duration) (models.IdempotencyKey, bool, error) {
+	const ClaimStatement = `INSERT INTO idempotency_keys (client_id, key, request_hash) VALUES ($1, $2, $3)
+							ON CONFLICT (client_id, key) DO UPDATE
+								SET request_hash = EXCLUDED.request_hash, status_code = NULL, response = NULL,
+									created_at = now()
+								WHERE idempotency_keys.created_at < $4
+							RETURNING created_at;`
+	const GetStatement = `SELECT request_hash, COALESCE(status_code, 0), response, created_at FROM idempotency_keys
+						  WHERE client_id = $1 AND key = $2;`
+
+	expired := time.Now().Add(-ttl)
+	err := conn.QueryRow(context.Background(), ClaimStatement, key.ClientID, key.Key, key.RequestHash,
+		expired).Scan(&key.CreatedAt)
+	switch {
+	case err == nil:
+		return key, true, nil
+	case err != pgx.ErrNoRows:
+		r.Log.Info(err.Error())
+		return models.IdempotencyKey{}, false, err
+	}
+
+	stored := models.IdempotencyKey{ClientID: key.ClientID, Key: key.Key}
+	err = conn.QueryRow(context.Background(), GetStatement, key.ClientID, key.Key).Scan(&stored.RequestHash,
+		&stored.StatusCode, &stored.Response, &stored.CreatedAt)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.IdempotencyKey{}, false, err
+	}
+
+	return stored, false, nil
+}
+
+func (r *IdempotencyRepo) Complete(conn *pgxpool.Conn, key models.IdempotencyKey) error {
+	const CompleteStatement = `UPDATE idempotency_keys SET status_code = $3, response = $4
+							   WHERE client_id = $1 AND key = $2;`
+
+	_, err := conn.Exec(context.Background(), CompleteStatement, key.ClientID, key.Key, key.StatusCode, key.Response)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Release frees a key whose request was not answered, so it can be retried.
+func (r *IdempotencyRepo) Release(conn *pgxpool.Conn, clientID string, key string) error {
+	const ReleaseStatement = `DELETE FROM idempotency_keys WHERE client_id = $1 AND key = $2 AND status_code IS NULL;`
+
+	_, err := conn.Exec(context.Background(), ReleaseStatement, clientID, key)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *IdempotencyRepo) DeleteExpired(conn *pgxpool.Conn, ttl time.Duration) (int64, error) {
+	const DeleteExpiredStatement = `DELETE FROM idempotency_keys WHERE created_at < $1;`
+
+	tag, err := conn.Exec(context.Background(), DeleteExpiredStatement, time.Now().Add(-ttl))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,113 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"users_balance/internal/models"
+)
+
+type SpendingLimitsRepo struct {
+	Log *zap.SugaredLogger
+}
+
+// GetEffectiveLimits merges the user's own limits with the limits of their tier,
+// user values win field by field.
+func (r *SpendingLimitsRepo) GetEffectiveLimits(conn *pgxpool.Conn, userUUID string) (models.SpendingLimits, error) {
+	const GetEffectiveLimitsStatement = `SELECT COALESCE(u.max_single, t.max_single), COALESCE(u.daily_total, t.daily_total),
+										 COALESCE(u.monthly_total, t.monthly_total), COALESCE(u.hourly_count, t.hourly_count)
+										 FROM users us
+										 LEFT JOIN spending_limits u ON u.subject_type = 'user' AND u.subject = us.uuid::text
+										 LEFT JOIN spending_limits t ON t.subject_type = 'tier' AND t.subject = us.tier
+										 WHERE us.uuid = $1;`
+
+	limits := models.SpendingLimits{SubjectType: models.LimitSubjectUser, Subject: userUUID}
+	err := conn.QueryRow(context.Background(), GetEffectiveLimitsStatement, userUUID).Scan(&limits.MaxSingle,
+		&limits.DailyTotal, &limits.MonthlyTotal, &limits.HourlyCount)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.SpendingLimits{}, err
+	}
+
+	return limits, nil
+}
+
+// GetUsage sums outgoing money for the current day and month and counts
+// outgoing transfers of the last hour. Reversals are not spending, nor are the
+// transfer legs they aborted.
+func (r *SpendingLimitsRepo) GetUsage(conn *pgxpool.Conn, userUUID string) (models.SpendingUsage, error) {
+	const GetUsageStatement = `SELECT
+							   COALESCE(-SUM(amount) FILTER (WHERE created_at >= date_trunc('day', now())), 0),
+							   COALESCE(-SUM(amount), 0),
+							   COUNT(*) FILTER (WHERE operation = $2 AND created_at >= now() - interval '1 hour')
+							   FROM transactions t
+							   WHERE user_uuid = $1 AND amount < 0 AND operation <> $3
+							   AND created_at >= date_trunc('month', now())
+							   AND NOT EXISTS (SELECT 1 FROM transactions a WHERE a.reverses = t.trx_uuid);`
+
+	var usage models.SpendingUsage
+	err := conn.QueryRow(context.Background(), GetUsageStatement, userUUID, models.OperationTransferOut,
+		models.OperationReversal).Scan(&usage.DailyTotal, &usage.MonthlyTotal, &usage.HourlyCount)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.SpendingUsage{}, err
+	}
+
+	return usage, nil
+}
+
+func (r *SpendingLimitsRepo) GetLimits(conn *pgxpool.Conn, subjectType string, subject string) (models.SpendingLimits, error) {
+	const GetLimitsStatement = `SELECT subject_type, subject, max_single, daily_total, monthly_total, hourly_count
+								FROM spending_limits WHERE subject_type = $1 AND subject = $2;`
+
+	var limits models.SpendingLimits
+	err := conn.QueryRow(context.Background(), GetLimitsStatement, subjectType, subject).Scan(&limits.SubjectType,
+		&limits.Subject, &limits.MaxSingle, &limits.DailyTotal, &limits.MonthlyTotal, &limits.HourlyCount)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.SpendingLimits{}, err
+	}
+
+	return limits, nil
+}
+
+func (r *SpendingLimitsRepo) SetLimits(conn *pgxpool.Conn, limits models.SpendingLimits) (models.SpendingLimits, error) {
+	const SetLimitsStatement = `INSERT INTO spending_limits (subject_type, subject, max_single, daily_total, monthly_total, hourly_count)
+								VALUES ($1, $2, $3, $4, $5, $6)
+								ON CONFLICT (subject_type, subject) DO UPDATE SET max_single = EXCLUDED.max_single,
+								daily_total = EXCLUDED.daily_total, monthly_total = EXCLUDED.monthly_total,
+								hourly_count = EXCLUDED.hourly_count;`
+
+	_, err := conn.Exec(context.Background(), SetLimitsStatement, limits.SubjectType, limits.Subject, limits.MaxSingle,
+		limits.DailyTotal, limits.MonthlyTotal, limits.HourlyCount)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.SpendingLimits{}, err
+	}
+
+	return limits, nil
+}
+
+func (r *SpendingLimitsRepo) DeleteLimits(conn *pgxpool.Conn, subjectType string, subject string) (bool, error) {
+	const DeleteLimitsStatement = `DELETE FROM spending_limits WHERE subject_type = $1 AND subject = $2;`
+
+	tag, err := conn.Exec(context.Background(), DeleteLimitsStatement, subjectType, subject)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *SpendingLimitsRepo) SetUserTier(conn *pgxpool.Conn, req models.UserTier) (bool, error) {
+	const SetUserTierStatement = `UPDATE users SET tier = $2 WHERE uuid = $1;`
+
+	tag, err := conn.Exec(context.Background(), SetUserTierStatement, req.UserID, req.Tier)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
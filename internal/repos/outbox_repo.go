@@ -0,0 +1,87 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"users_balance/internal/models"
+)
+
+type OutboxRepo struct {
+	Log *zap.SugaredLogger
+}
+
+func (r *OutboxRepo) InsertEvent(conn *pgxpool.Conn, event models.Event) (models.Event, error) {
+	const InsertEventStatement = `INSERT INTO outbox (event_type, event_key, payload) VALUES ($1, $2, $3)
+								  RETURNING id, created_at;`
+
+	err := conn.QueryRow(context.Background(), InsertEventStatement, event.Type, event.Key,
+		string(event.Payload)).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Event{}, err
+	}
+
+	return event, nil
+}
+
+func (r *OutboxRepo) GetEvent(conn *pgxpool.Conn, id int64) (models.Event, error) {
+	const GetEventStatement = `SELECT id, event_type, event_key, payload, created_at FROM outbox WHERE id = $1;`
+
+	var event models.Event
+	var payload string
+	err := conn.QueryRow(context.Background(), GetEventStatement, id).Scan(&event.ID, &event.Type, &event.Key,
+		&payload, &event.CreatedAt)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Event{}, err
+	}
+	event.Payload = []byte(payload)
+
+	return event, nil
+}
+
+// LockUnpublished returns the oldest unpublished events, locking them for the
+// surrounding transaction so concurrent relays skip them.
+func (r *OutboxRepo) LockUnpublished(tx pgx.Tx, limit int) ([]models.Event, error) {
+	const LockUnpublishedStatement = `SELECT id, event_type, event_key, payload, created_at FROM outbox
+									  WHERE published_at IS NULL
+									  ORDER BY id
+									  LIMIT $1
+									  FOR UPDATE SKIP LOCKED;`
+
+	rows, err := tx.Query(context.Background(), LockUnpublishedStatement, limit)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		var event models.Event
+		var payload string
+		err := rows.Scan(&event.ID, &event.Type, &event.Key, &payload, &event.CreatedAt)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		event.Payload = []byte(payload)
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *OutboxRepo) MarkPublished(tx pgx.Tx, ids []int64) error {
+	const MarkPublishedStatement = `UPDATE outbox SET published_at = now() WHERE id = ANY($1);`
+
+	_, err := tx.Exec(context.Background(), MarkPublishedStatement, ids)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"users_balance/internal/models"
+)
+
+type PayoutRepo struct {
+	Log *zap.SugaredLogger
+}
+
+func (r *PayoutRepo) CreateJob(conn *pgxpool.Conn, client string) (models.PayoutJob, error) {
+	const CreateJobStatement = `INSERT INTO payout_jobs (client) VALUES ($1)
+								RETURNING id, created_at;`
+
+	job := models.PayoutJob{Client: client, Status: models.PayoutJobQueued}
+	err := conn.QueryRow(context.Background(), CreateJobStatement, client).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.PayoutJob{}, err
+	}
+
+	return job, nil
+}
+
+// InsertRows copies the rows of a job in one COPY.
+func (r *PayoutRepo) InsertRows(conn *pgxpool.Conn, jobID int64, rows []models.PayoutRow) error {
+	data := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		data[i] = []interface{}{jobID, row.Row, row.UserID, row.Amount, row.Description}
+	}
+
+	_, err := conn.CopyFrom(context.Background(), pgx.Identifier{"payout_job_rows"},
+		[]string{"job_id", "row_no", "user_uuid", "amount", "description"}, pgx.CopyFromRows(data))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// MissingUsers returns the uuids among the given ones without an account.
+func (r *PayoutRepo) MissingUsers(conn *pgxpool.Conn, uuids []string) ([]string, error) {
+	const MissingUsersStatement = `SELECT id FROM unnest($1::uuid[]) AS id
+								   WHERE NOT EXISTS (SELECT 1 FROM users WHERE uuid = id);`
+
+	rows, err := conn.Query(context.Background(), MissingUsersStatement, uuids)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var missing []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		missing = append(missing, id)
+	}
+
+	return missing, rows.Err()
+}
+
+// GetJob returns a job of a client with its progress counters.
+func (r *PayoutRepo) GetJob(conn *pgxpool.Conn, id int64, client string) (models.PayoutJob, error) {
+	const GetJobStatement = `SELECT j.id, j.client, j.created_at, COUNT(*),
+							 COUNT(*) FILTER (WHERE r.status <> 'pending'),
+							 COUNT(*) FILTER (WHERE r.status = 'applied'),
+							 COUNT(*) FILTER (WHERE r.status = 'failed')
+							 FROM payout_jobs j
+							 JOIN payout_job_rows r ON r.job_id = j.id
+							 WHERE j.id = $1 AND j.client = $2
+							 GROUP BY j.id;`
+
+	var job models.PayoutJob
+	err := conn.QueryRow(context.Background(), GetJobStatement, id, client).Scan(&job.ID, &job.Client, &job.CreatedAt,
+		&job.TotalRows, &job.Processed, &job.Applied, &job.Failed)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.PayoutJob{}, err
+	}
+
+	return job, nil
+}
+
+func (r *PayoutRepo) ListFailures(conn *pgxpool.Conn, jobID int64) ([]models.PayoutRow, error) {
+	const ListFailuresStatement = `SELECT row_no, user_uuid, amount, description, status, COALESCE(error, '')
+								   FROM payout_job_rows
+								   WHERE job_id = $1 AND status = 'failed'
+								   ORDER BY row_no;`
+
+	rows, err := conn.Query(context.Background(), ListFailuresStatement, jobID)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []models.PayoutRow
+	for rows.Next() {
+		row := models.PayoutRow{JobID: jobID}
+		if err := rows.Scan(&row.Row, &row.UserID, &row.Amount, &row.Description, &row.Status, &row.Error); err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		failures = append(failures, row)
+	}
+
+	return failures, rows.Err()
+}
+
+// LockNextRow locks the oldest pending row no other worker holds. It must run
+// in the transaction that applies the row.
+func (r *PayoutRepo) LockNextRow(conn *pgxpool.Conn) (models.PayoutRow, error) {
+	const LockNextRowStatement = `SELECT r.job_id, r.row_no, r.user_uuid, r.amount, r.description, j.client
+								  FROM payout_job_rows r
+								  JOIN payout_jobs j ON j.id = r.job_id
+								  WHERE r.status = 'pending'
+								  ORDER BY r.job_id, r.row_no
+								  LIMIT 1
+								  FOR UPDATE OF r SKIP LOCKED;`
+
+	var row models.PayoutRow
+	err := conn.QueryRow(context.Background(), LockNextRowStatement).Scan(&row.JobID, &row.Row, &row.UserID, &row.Amount,
+		&row.Description, &row.Client)
+	if err != nil {
+		return models.PayoutRow{}, err
+	}
+	row.Status = models.PayoutRowPending
+
+	return row, nil
+}
+
+func (r *PayoutRepo) FinishRow(conn *pgxpool.Conn, row models.PayoutRow) error {
+	const FinishRowStatement = `UPDATE payout_job_rows SET status = $3, error = NULLIF($4, ''), trx_uuid = $5, processed_at = now()
+								WHERE job_id = $1 AND row_no = $2;`
+
+	_, err := conn.Exec(context.Background(), FinishRowStatement, row.JobID, row.Row, row.Status, row.Error, row.TrxID)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"users_balance/internal/models"
+)
+
+type ReconciliationRepo struct {
+	Log *zap.SugaredLogger
+}
+
+// ledgerColumns are the uuid, the balance the transactions of a user add up
+// to, archived ones included, and their actual balance of a users row u. Both
+// are numeric rounded to cents so they compare exactly, whatever the rounding
+// of the real typed columns.
+const ledgerColumns = `u.uuid,
+					   COALESCE((SELECT round(a.amount::numeric, 2) FROM archived_balances a WHERE a.user_uuid = u.uuid), 0)
+					   + COALESCE((SELECT SUM(round(t.amount::float8::numeric, 2)) FROM transactions t
+								   WHERE t.user_uuid = u.uuid), 0) AS expected,
+					   round(account_balance(u)::float8::numeric, 2) AS actual`
+
+// FindDiscrepancies returns users whose balance differs from the sum of their
+// transactions, archived ones included, by a cent or more.
+func (r *ReconciliationRepo) FindDiscrepancies(conn *pgxpool.Conn) ([]models.Discrepancy, error) {
+	const FindDiscrepanciesStatement = `SELECT uuid, expected, actual, actual - expected
+										FROM (SELECT ` + ledgerColumns + ` FROM users u) ledger
+										WHERE actual <> expected
+										ORDER BY uuid;`
+
+	rows, err := conn.Query(context.Background(), FindDiscrepanciesStatement)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	discrepancies := []models.Discrepancy{}
+	for rows.Next() {
+		var d models.Discrepancy
+		if err := rows.Scan(&d.UserID, &d.Expected, &d.Actual, &d.Difference); err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		discrepancies = append(discrepancies, d)
+	}
+
+	return discrepancies, rows.Err()
+}
+
+// LockUser locks a user row and recomputes its discrepancy, so a correction is
+// based on the state it is written against.
+func (r *ReconciliationRepo) LockUser(conn *pgxpool.Conn, userUUID string) (models.Discrepancy, error) {
+	const LockUserStatement = `SELECT uuid, expected, actual, actual - expected
+							   FROM (SELECT ` + ledgerColumns + ` FROM users u WHERE u.uuid = $1 FOR UPDATE OF u) ledger;`
+
+	var d models.Discrepancy
+	err := conn.QueryRow(context.Background(), LockUserStatement, userUUID).Scan(&d.UserID, &d.Expected, &d.Actual,
+		&d.Difference)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Discrepancy{}, err
+	}
+
+	return d, nil
+}
+
+// UserChain returns the audit chain links of a user's balance changes and
+// transactions, in chain order.
+func (r *ReconciliationRepo) UserChain(conn *pgxpool.Conn, userUUID string) ([]models.AuditChainEntry, error) {
+	const UserChainStatement = `SELECT seq, entity, entity_id, payload FROM audit_chain
+								WHERE (entity = 'balance' AND entity_id = $1)
+								OR (entity = 'transaction' AND payload::json->>'user_uuid' = $1)
+								ORDER BY seq;`
+
+	rows, err := conn.Query(context.Background(), UserChainStatement, userUUID)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditChainEntry
+	for rows.Next() {
+		var entry models.AuditChainEntry
+		if err := rows.Scan(&entry.Seq, &entry.Entity, &entry.EntityID, &entry.Payload); err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,318 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"users_balance/internal/models"
+)
+
+const scheduleColumns = `id, client, kind, user_uuid, to_uuid, amount, description, recurrence, day_of_month, max_retries,
+						 retry_interval, status, attempt, occurrence_at, next_run_at, created_at`
+
+const scheduleRunColumns = `id, schedule_id, occurrence_at, attempt, status, error, trx_uuid, started_at, finished_at,
+							replay_of`
+
+type ScheduleRepo struct {
+	Log *zap.SugaredLogger
+}
+
+func (r *ScheduleRepo) CreateSchedule(conn *pgxpool.Conn, s models.Schedule) (models.Schedule, error) {
+	const CreateScheduleStatement = `INSERT INTO scheduled_transfers (client, kind, user_uuid, to_uuid, amount, description,
+									 recurrence, day_of_month, max_retries, retry_interval, occurrence_at, next_run_at)
+									 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+									 RETURNING ` + scheduleColumns + `;`
+
+	created, err := scanSchedule(conn.QueryRow(context.Background(), CreateScheduleStatement, s.Client, s.Kind, s.UserID,
+		s.To, s.Amount, s.Description, s.Recurrence, s.DayOfMonth, s.MaxRetries, s.RetryInterval, s.OccurrenceAt))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Schedule{}, err
+	}
+
+	return created, nil
+}
+
+func (r *ScheduleRepo) GetSchedule(conn *pgxpool.Conn, id string, client string) (models.Schedule, error) {
+	const GetScheduleStatement = `SELECT ` + scheduleColumns + ` FROM scheduled_transfers WHERE id = $1 AND client = $2;`
+
+	s, err := scanSchedule(conn.QueryRow(context.Background(), GetScheduleStatement, id, client))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Schedule{}, err
+	}
+
+	return s, nil
+}
+
+func (r *ScheduleRepo) ListSchedules(conn *pgxpool.Conn, client string) ([]models.Schedule, error) {
+	const ListSchedulesStatement = `SELECT ` + scheduleColumns + ` FROM scheduled_transfers
+									WHERE client = $1
+									ORDER BY created_at;`
+
+	return r.querySchedules(conn, ListSchedulesStatement, client)
+}
+
+// UpdateSchedule changes the given fields of an active or paused schedule, it
+// matches no row otherwise.
+func (r *ScheduleRepo) UpdateSchedule(conn *pgxpool.Conn, id string, client string, upd models.ScheduleUpdate) (models.Schedule, error) {
+	const UpdateScheduleStatement = `UPDATE scheduled_transfers SET
+									 amount = COALESCE($3, amount),
+									 description = COALESCE($4, description),
+									 status = CASE WHEN $5::boolean THEN 'paused' WHEN NOT $5::boolean THEN 'active' ELSE status END,
+									 max_retries = COALESCE($6, max_retries),
+									 retry_interval = COALESCE($7, retry_interval)
+									 WHERE id = $1 AND client = $2 AND status IN ('active', 'paused')
+									 RETURNING ` + scheduleColumns + `;`
+
+	s, err := scanSchedule(conn.QueryRow(context.Background(), UpdateScheduleStatement, id, client, upd.Amount,
+		upd.Description, upd.Paused, upd.MaxRetries, upd.RetryInterval))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Schedule{}, err
+	}
+
+	return s, nil
+}
+
+// CancelSchedule stops a schedule that has not ended, it matches no row
+// otherwise.
+func (r *ScheduleRepo) CancelSchedule(conn *pgxpool.Conn, id string, client string) (models.Schedule, error) {
+	const CancelScheduleStatement = `UPDATE scheduled_transfers SET status = 'cancelled', next_run_at = NULL
+									 WHERE id = $1 AND client = $2 AND status IN ('active', 'paused')
+									 RETURNING ` + scheduleColumns + `;`
+
+	s, err := scanSchedule(conn.QueryRow(context.Background(), CancelScheduleStatement, id, client))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Schedule{}, err
+	}
+
+	return s, nil
+}
+
+// ClaimNextDue marks the schedule due the longest as running and returns it,
+// it matches no row when none is due.
+func (r *ScheduleRepo) ClaimNextDue(conn *pgxpool.Conn) (models.Schedule, error) {
+	const ClaimNextDueStatement = `UPDATE scheduled_transfers SET running_since = now()
+								   WHERE id = (
+									   SELECT id FROM scheduled_transfers
+									   WHERE status = 'active' AND running_since IS NULL AND next_run_at <= now()
+									   ORDER BY next_run_at
+									   LIMIT 1
+									   FOR UPDATE SKIP LOCKED
+								   )
+								   RETURNING ` + scheduleColumns + `;`
+
+	s, err := scanSchedule(conn.QueryRow(context.Background(), ClaimNextDueStatement))
+	if err != nil {
+		if err != pgx.ErrNoRows {
+			r.Log.Info(err.Error())
+		}
+		return models.Schedule{}, err
+	}
+
+	return s, nil
+}
+
+// ListInterrupted returns the schedules claimed by a worker that stopped
+// before recording the outcome of the run.
+func (r *ScheduleRepo) ListInterrupted(conn *pgxpool.Conn) ([]models.Schedule, error) {
+	const ListInterruptedStatement = `SELECT ` + scheduleColumns + ` FROM scheduled_transfers
+									  WHERE running_since IS NOT NULL;`
+
+	return r.querySchedules(conn, ListInterruptedStatement)
+}
+
+// StartRun records the start of a run of the schedule's current occurrence.
+func (r *ScheduleRepo) StartRun(conn *pgxpool.Conn, s models.Schedule) (models.ScheduleRun, error) {
+	const StartRunStatement = `INSERT INTO scheduled_transfer_runs (schedule_id, occurrence_at, attempt, status)
+							   VALUES ($1, $2, $3, 'running')
+							   RETURNING ` + scheduleRunColumns + `;`
+
+	run, err := scanScheduleRun(conn.QueryRow(context.Background(), StartRunStatement, s.ID, s.OccurrenceAt, s.Attempt+1))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.ScheduleRun{}, err
+	}
+
+	return run, nil
+}
+
+// FinishRun records the outcome of a run and moves its schedule on. Runs an
+// interrupted worker left open are closed with the same outcome.
+func (r *ScheduleRepo) FinishRun(conn *pgxpool.Conn, run models.ScheduleRun, s models.Schedule) error {
+	const FinishRunStatement = `UPDATE scheduled_transfer_runs SET status = $2, error = $3, trx_uuid = $4, finished_at = now()
+								WHERE schedule_id = $1 AND status = 'running' AND replay_of IS NULL;`
+	// a schedule paused or cancelled during the run keeps its state
+	const AdvanceScheduleStatement = `UPDATE scheduled_transfers SET
+									  status = CASE WHEN status = 'active' OR $2 IN ('completed', 'failed') THEN $2 ELSE status END,
+									  attempt = $3, occurrence_at = $4,
+									  next_run_at = CASE WHEN status = 'cancelled' THEN NULL ELSE $5 END,
+									  running_since = NULL
+									  WHERE id = $1;`
+
+	_, err := conn.Exec(context.Background(), FinishRunStatement, run.ScheduleID, run.Status, run.Error, run.TrxID)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	_, err = conn.Exec(context.Background(), AdvanceScheduleStatement, s.ID, s.Status, s.Attempt, s.OccurrenceAt, s.NextRunAt)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *ScheduleRepo) ListRuns(conn *pgxpool.Conn, scheduleID string, limit int64, offset int64) ([]models.ScheduleRun, error) {
+	const ListRunsStatement = `SELECT ` + scheduleRunColumns + ` FROM scheduled_transfer_runs
+							   WHERE schedule_id = $1
+							   ORDER BY id DESC
+							   LIMIT $2
+							   OFFSET $3;`
+
+	rows, err := conn.Query(context.Background(), ListRunsStatement, scheduleID, limit, offset)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.ScheduleRun{}
+	for rows.Next() {
+		run, err := scanScheduleRun(rows)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (r *ScheduleRepo) GetRun(conn *pgxpool.Conn, id int64) (models.ScheduleRun, error) {
+	const GetRunStatement = `SELECT ` + scheduleRunColumns + ` FROM scheduled_transfer_runs WHERE id = $1;`
+
+	run, err := scanScheduleRun(conn.QueryRow(context.Background(), GetRunStatement, id))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.ScheduleRun{}, err
+	}
+
+	return run, nil
+}
+
+// GetRunSchedule returns the schedule of a run whatever client owns it.
+func (r *ScheduleRepo) GetRunSchedule(conn *pgxpool.Conn, run models.ScheduleRun) (models.Schedule, error) {
+	const GetRunScheduleStatement = `SELECT ` + scheduleColumns + ` FROM scheduled_transfers WHERE id = $1;`
+
+	s, err := scanSchedule(conn.QueryRow(context.Background(), GetRunScheduleStatement, run.ScheduleID))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.Schedule{}, err
+	}
+
+	return s, nil
+}
+
+// StartReplay records the start of a replay of run, it fails with a unique
+// violation when the run has been replayed already.
+func (r *ScheduleRepo) StartReplay(conn *pgxpool.Conn, run models.ScheduleRun) (models.ScheduleRun, error) {
+	const StartReplayStatement = `INSERT INTO scheduled_transfer_runs (schedule_id, occurrence_at, attempt, status, replay_of)
+								  VALUES ($1, $2, $3, 'running', $4)
+								  RETURNING ` + scheduleRunColumns + `;`
+
+	replay, err := scanScheduleRun(conn.QueryRow(context.Background(), StartReplayStatement, run.ScheduleID,
+		run.OccurrenceAt, run.Attempt, run.ID))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.ScheduleRun{}, err
+	}
+
+	return replay, nil
+}
+
+// FinishReplay records the outcome of a replay, the schedule is left as it is.
+func (r *ScheduleRepo) FinishReplay(conn *pgxpool.Conn, run models.ScheduleRun) (models.ScheduleRun, error) {
+	const FinishReplayStatement = `UPDATE scheduled_transfer_runs SET status = $2, error = $3, trx_uuid = $4, finished_at = now()
+								   WHERE id = $1
+								   RETURNING ` + scheduleRunColumns + `;`
+
+	finished, err := scanScheduleRun(conn.QueryRow(context.Background(), FinishReplayStatement, run.ID, run.Status,
+		run.Error, run.TrxID))
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.ScheduleRun{}, err
+	}
+
+	return finished, nil
+}
+
+// TryLeadership takes the scheduler lock for the session of conn, it returns
+// false when another session holds it.
+func (r *ScheduleRepo) TryLeadership(conn *pgxpool.Conn) (bool, error) {
+	const TryLeadershipStatement = `SELECT pg_try_advisory_lock(hashtext('scheduled_transfers'));`
+
+	var leader bool
+	err := conn.QueryRow(context.Background(), TryLeadershipStatement).Scan(&leader)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return false, err
+	}
+
+	return leader, nil
+}
+
+func (r *ScheduleRepo) ReleaseLeadership(conn *pgxpool.Conn) error {
+	const ReleaseLeadershipStatement = `SELECT pg_advisory_unlock(hashtext('scheduled_transfers'));`
+
+	_, err := conn.Exec(context.Background(), ReleaseLeadershipStatement)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *ScheduleRepo) querySchedules(conn *pgxpool.Conn, statement string, args ...interface{}) ([]models.Schedule, error) {
+	rows, err := conn.Query(context.Background(), statement, args...)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Schedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		list = append(list, s)
+	}
+
+	return list, rows.Err()
+}
+
+func scanSchedule(row pgx.Row) (models.Schedule, error) {
+	var s models.Schedule
+	err := row.Scan(&s.ID, &s.Client, &s.Kind, &s.UserID, &s.To, &s.Amount, &s.Description, &s.Recurrence, &s.DayOfMonth,
+		&s.MaxRetries, &s.RetryInterval, &s.Status, &s.Attempt, &s.OccurrenceAt, &s.NextRunAt, &s.CreatedAt)
+
+	return s, err
+}
+
+func scanScheduleRun(row pgx.Row) (models.ScheduleRun, error) {
+	var run models.ScheduleRun
+	err := row.Scan(&run.ID, &run.ScheduleID, &run.OccurrenceAt, &run.Attempt, &run.Status, &run.Error, &run.TrxID,
+		&run.StartedAt, &run.FinishedAt, &run.ReplayOf)
+
+	return run, err
+}
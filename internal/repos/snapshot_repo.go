@@ -0,0 +1,114 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"time"
+)
+
+type SnapshotRepo struct {
+	Log *zap.SugaredLogger
+}
+
+// TakeSnapshots stores the balance at the given moment of every user with
+// transactions since their last snapshot, adding those transactions to it.
+// Snapshots older than the archived transactions of a user are passed over,
+// the archived balance is the base instead.
+func (r *SnapshotRepo) TakeSnapshots(conn *pgxpool.Conn, at time.Time) (int64, error) {
+	const TakeSnapshotsStatement = `INSERT INTO balance_snapshots (user_uuid, taken_at, balance)
+									SELECT u.uuid, $1, COALESCE(s.balance, a.amount, 0) + COALESCE(SUM(t.amount::float8), 0)
+									FROM users u
+									LEFT JOIN archived_balances a ON a.user_uuid = u.uuid
+									LEFT JOIN LATERAL (
+										SELECT taken_at, balance FROM balance_snapshots
+										WHERE user_uuid = u.uuid
+										AND taken_at >= COALESCE(transactions_archived_before(u.uuid), '-infinity')
+										ORDER BY taken_at DESC
+										LIMIT 1
+									) s ON true
+									LEFT JOIN transactions t ON t.user_uuid = u.uuid
+										AND t.created_at <= $1
+										AND (s.taken_at IS NULL OR t.created_at > s.taken_at)
+									WHERE s.taken_at IS NULL OR s.taken_at < $1
+									GROUP BY u.uuid, s.taken_at, s.balance, a.amount
+									HAVING s.taken_at IS NULL OR COUNT(t.trx_uuid) > 0
+									ON CONFLICT DO NOTHING;`
+
+	tag, err := conn.Exec(context.Background(), TakeSnapshotsStatement, at)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// DropStaleSnapshots re-verifies the snapshots taken since the given moment
+// against the ledger: each has to be the balance of the snapshot before it, or
+// the archived balance, plus the transactions made in between. A transaction
+// that committed after a snapshot was taken but is stamped before it breaks
+// that, such a snapshot and the later ones of its user are deleted to be taken
+// again. It returns how many were deleted.
+func (r *SnapshotRepo) DropStaleSnapshots(conn *pgxpool.Conn, since time.Time) (int64, error) {
+	const DropStaleSnapshotsStatement = `WITH stale AS (
+											 SELECT s.user_uuid, MIN(s.taken_at) AS taken_at
+											 FROM balance_snapshots s
+											 LEFT JOIN archived_balances a ON a.user_uuid = s.user_uuid
+											 LEFT JOIN LATERAL (
+												 SELECT taken_at, balance FROM balance_snapshots
+												 WHERE user_uuid = s.user_uuid AND taken_at < s.taken_at
+												 AND taken_at >= COALESCE(transactions_archived_before(s.user_uuid), '-infinity')
+												 ORDER BY taken_at DESC
+												 LIMIT 1
+											 ) p ON true
+											 WHERE s.taken_at >= $1
+											 AND round(s.balance::numeric, 2) <> round((COALESCE(p.balance, a.amount, 0)
+												 + COALESCE((SELECT SUM(t.amount::float8) FROM transactions t
+															 WHERE t.user_uuid = s.user_uuid
+															 AND t.created_at <= s.taken_at
+															 AND (p.taken_at IS NULL OR t.created_at > p.taken_at)), 0))::numeric, 2)
+											 GROUP BY s.user_uuid
+										 )
+										 DELETE FROM balance_snapshots b
+										 USING stale
+										 WHERE b.user_uuid = stale.user_uuid AND b.taken_at >= stale.taken_at;`
+
+	tag, err := conn.Exec(context.Background(), DropStaleSnapshotsStatement, since)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// GetBalanceAt returns the ledger balance of a user at the given moment from
+// the closest earlier snapshot and the transactions made after it. The moment
+// is not before the archived transactions of the user, snapshots older than
+// them are passed over for the archived balance.
+func (r *SnapshotRepo) GetBalanceAt(conn *pgxpool.Conn, userUUID string, at time.Time) (float64, error) {
+	const GetBalanceAtStatement = `WITH s AS (
+									   SELECT taken_at, balance FROM balance_snapshots
+									   WHERE user_uuid = $1 AND taken_at <= $2
+									   AND taken_at >= COALESCE(transactions_archived_before($1), '-infinity')
+									   ORDER BY taken_at DESC
+									   LIMIT 1
+								   )
+								   SELECT COALESCE((SELECT balance FROM s),
+												   (SELECT amount FROM archived_balances WHERE user_uuid = $1), 0)
+										  + COALESCE(SUM(amount::float8), 0)
+								   FROM transactions
+								   WHERE user_uuid = $1
+								   AND created_at <= $2
+								   AND created_at > COALESCE((SELECT taken_at FROM s), '-infinity');`
+
+	var balance float64
+	err := conn.QueryRow(context.Background(), GetBalanceAtStatement, userUUID, at).Scan(&balance)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return 0, err
+	}
+
+	return balance, nil
+}
@@ -0,0 +1,206 @@
+package balance_repos
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"time"
+	"users_balance/internal/models"
+)
+
+type WebhookRepo struct {
+	Log *zap.SugaredLogger
+}
+
+func (r *WebhookRepo) CreateSubscription(conn *pgxpool.Conn, sub models.WebhookSubscription) (models.WebhookSubscription, error) {
+	const CreateSubscriptionStatement = `INSERT INTO webhook_subscriptions (client_id, url, secret, event_types, accounts)
+										 VALUES ($1, $2, $3, $4, $5)
+										 RETURNING id, created_at;`
+
+	err := conn.QueryRow(context.Background(), CreateSubscriptionStatement, sub.ClientID, sub.URL, sub.Secret,
+		sub.EventTypes, sub.Accounts).Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return models.WebhookSubscription{}, err
+	}
+
+	return sub, nil
+}
+
+func (r *WebhookRepo) ListSubscriptions(conn *pgxpool.Conn, clientID string) ([]models.WebhookSubscription, error) {
+	const ListSubscriptionsStatement = `SELECT id, client_id, url, event_types, accounts, created_at FROM webhook_subscriptions
+										WHERE client_id = $1 ORDER BY created_at;`
+
+	rows, err := conn.Query(context.Background(), ListSubscriptionsStatement, clientID)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []models.WebhookSubscription{}
+	for rows.Next() {
+		var sub models.WebhookSubscription
+		err := rows.Scan(&sub.ID, &sub.ClientID, &sub.URL, &sub.EventTypes, &sub.Accounts, &sub.CreatedAt)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+func (r *WebhookRepo) DeleteSubscription(conn *pgxpool.Conn, clientID string, id string) (bool, error) {
+	const DeleteSubscriptionStatement = `DELETE FROM webhook_subscriptions WHERE client_id = $1 AND id = $2;`
+
+	tag, err := conn.Exec(context.Background(), DeleteSubscriptionStatement, clientID, id)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// EnqueueDeliveries creates a pending delivery of the event for every
+// subscription interested in its type and allowed to see its account, the
+// event key. It runs in the event's transaction.
+func (r *WebhookRepo) EnqueueDeliveries(conn *pgxpool.Conn, event models.Event) error {
+	const EnqueueDeliveriesStatement = `INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+										SELECT id, $1, $2, $3 FROM webhook_subscriptions
+										WHERE (event_types = '{}' OR $2 = ANY(event_types))
+										AND (accounts = '{}' OR lower($4) = ANY(accounts));`
+
+	_, err := conn.Exec(context.Background(), EnqueueDeliveriesStatement, event.ID, event.Type, string(event.Payload),
+		event.Key)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *WebhookRepo) ListDeliveries(conn *pgxpool.Conn, clientID string, req models.WebhookDeliveriesRequest) ([]models.WebhookDelivery, error) {
+	const ListDeliveriesStatement = `SELECT d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+									 d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at
+									 FROM webhook_deliveries d
+									 JOIN webhook_subscriptions s ON s.id = d.subscription_id
+									 WHERE s.client_id = $1 AND d.subscription_id = $2
+									 ORDER BY d.id DESC
+									 LIMIT $3
+									 OFFSET $4;`
+
+	rows, err := conn.Query(context.Background(), ListDeliveriesStatement, clientID, req.SubscriptionID, req.Limit, req.Offset)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var payload string
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		d.Payload = []byte(payload)
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ReplayDelivery puts a delivery back in the queue with a fresh retry budget.
+func (r *WebhookRepo) ReplayDelivery(conn *pgxpool.Conn, clientID string, deliveryID int64) (bool, error) {
+	const ReplayDeliveryStatement = `UPDATE webhook_deliveries d SET status = 'pending', attempts = 0, next_attempt_at = now(),
+									 delivered_at = NULL
+									 FROM webhook_subscriptions s
+									 WHERE s.id = d.subscription_id AND s.client_id = $1 AND d.id = $2;`
+
+	tag, err := conn.Exec(context.Background(), ReplayDeliveryStatement, clientID, deliveryID)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ClaimDue leases pending deliveries whose next attempt is due until lease
+// from now. The claim commits at once, the deliveries are then sent outside of
+// any transaction and other dispatchers skip them until the lease expires.
+func (r *WebhookRepo) ClaimDue(conn *pgxpool.Conn, limit int, lease time.Duration) ([]models.DueWebhookDelivery, error) {
+	const ClaimDueStatement = `UPDATE webhook_deliveries d SET locked_until = now() + make_interval(secs => $2)
+							   FROM webhook_subscriptions s
+							   WHERE s.id = d.subscription_id AND d.id IN (
+								   SELECT id FROM webhook_deliveries
+								   WHERE status = 'pending' AND next_attempt_at <= now()
+								   AND (locked_until IS NULL OR locked_until <= now())
+								   ORDER BY next_attempt_at
+								   LIMIT $1
+								   FOR UPDATE SKIP LOCKED
+							   )
+							   RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.attempts,
+							   s.url, s.secret;`
+
+	rows, err := conn.Query(context.Background(), ClaimDueStatement, limit, lease.Seconds())
+	if err != nil {
+		r.Log.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []models.DueWebhookDelivery
+	for rows.Next() {
+		var d models.DueWebhookDelivery
+		var payload string
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Attempts, &d.URL, &d.Secret)
+		if err != nil {
+			r.Log.Info(err.Error())
+			return nil, err
+		}
+		d.Payload = []byte(payload)
+		due = append(due, d)
+	}
+
+	return due, rows.Err()
+}
+
+func (r *WebhookRepo) MarkDelivered(tx pgx.Tx, id int64, statusCode int) error {
+	const MarkDeliveredStatement = `UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1,
+									last_status_code = $2, last_error = NULL, delivered_at = now(), locked_until = NULL
+									WHERE id = $1;`
+
+	_, err := tx.Exec(context.Background(), MarkDeliveredStatement, id, statusCode)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// MarkFailed records a failed attempt and schedules the next one, or moves the
+// delivery to the dead-letter state when dead is set.
+func (r *WebhookRepo) MarkFailed(tx pgx.Tx, id int64, statusCode *int, reason string, next time.Time, dead bool) error {
+	const MarkFailedStatement = `UPDATE webhook_deliveries SET attempts = attempts + 1, last_status_code = $2,
+								 last_error = $3, next_attempt_at = $4, locked_until = NULL,
+								 status = CASE WHEN $5 THEN 'dead' ELSE 'pending' END
+								 WHERE id = $1;`
+
+	_, err := tx.Exec(context.Background(), MarkFailedStatement, id, statusCode, reason, next, dead)
+	if err != nil {
+		r.Log.Info(err.Error())
+		return err
+	}
+
+	return nil
+}
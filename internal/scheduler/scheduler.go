@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"time"
+	"users_balance/internal/interfaces"
+)
+
+// Scheduler runs the scheduled transfers that are due. Every replica runs one,
+// but only the holder of a session advisory lock executes schedules, so an
+// occurrence is never run by two replicas. The lock goes with the session: when
+// the leader dies or loses its connection, another replica takes over on its
+// next attempt.
+type Scheduler struct {
+	Log          *zap.SugaredLogger
+	DBHandler    interfaces.IDBHandler
+	ScheduleRepo interfaces.IScheduleRepo
+	Service      interfaces.IScheduleService
+	PollInterval time.Duration
+}
+
+// Run tries to become the leader every PollInterval, then runs due schedules
+// every PollInterval while it leads, until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		if err := s.lead(ctx); err != nil {
+			s.Log.Warnf("scheduler :: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+// lead holds the lock on a dedicated connection for as long as it is alive.
+func (s *Scheduler) lead(ctx context.Context) error {
+	conn, err := s.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	leader, err := s.ScheduleRepo.TryLeadership(conn)
+	if err != nil || !leader {
+		return err
+	}
+	defer s.resign(conn)
+
+	s.Log.Info("scheduler :: acquired leadership")
+
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Service.RunDue(ctx)
+		if err != nil {
+			s.Log.Warnf("scheduler :: %s", err)
+		}
+		if n > 0 {
+			s.Log.Infof("scheduler :: ran %d schedules", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// the lock is lost with the connection
+		if err := conn.Ping(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Scheduler) resign(conn *pgxpool.Conn) {
+	if err := s.ScheduleRepo.ReleaseLeadership(conn); err != nil {
+		s.Log.Warnf("scheduler :: release leadership :: %s", err)
+		return
+	}
+
+	s.Log.Info("scheduler :: released leadership")
+}
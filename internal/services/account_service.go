@@ -0,0 +1,150 @@
+package balance_services
+
+import (
+	"context"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+const pgUniqueViolation = "23505"
+
+type AccountService struct {
+	Log         *zap.SugaredLogger
+	BalanceRepo interfaces.ICompanyDetailsRepo
+	DBHandler   interfaces.IDBHandler
+	// BalanceCache holds statuses with the balances, nil when the cache is off
+	BalanceCache interfaces.IBalanceCache
+}
+
+func (s *AccountService) CreateAccount(req models.NewAccount) (models.Account, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.Account{}, err
+	}
+	defer conn.Release()
+
+	account, err := s.BalanceRepo.CreateAccount(conn, req)
+	pgErr, isPgErr := errors.Cause(err).(*pgconn.PgError)
+	switch {
+	case isPgErr && pgErr.Code == pgUniqueViolation:
+		return models.Account{}, er.ErrAccountExists
+	case err != nil:
+		return models.Account{}, err
+	}
+
+	return account, nil
+}
+
+func (s *AccountService) GetAccount(uuid string) (models.Account, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.Account{}, err
+	}
+	defer conn.Release()
+
+	account, err := s.BalanceRepo.GetAccount(conn, uuid)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.Account{}, er.ErrNotFound
+	case err != nil:
+		return models.Account{}, err
+	}
+
+	return account, nil
+}
+
+func (s *AccountService) FreezeAccount(uuid string) (models.Account, error) {
+	return s.setStatus(uuid, []string{models.AccountActive}, models.AccountFrozen)
+}
+
+func (s *AccountService) UnfreezeAccount(uuid string) (models.Account, error) {
+	return s.setStatus(uuid, []string{models.AccountFrozen}, models.AccountActive)
+}
+
+func (s *AccountService) CloseAccount(uuid string) (models.Account, error) {
+	return s.setStatus(uuid, []string{models.AccountActive, models.AccountFrozen}, models.AccountClosed)
+}
+
+// SetShards makes an account hot, its credits are spread over the given number
+// of shard rows, or folds its shards back into the users row when it is 0.
+func (s *AccountService) SetShards(req models.AccountShards) (models.Account, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.Account{}, err
+	}
+	defer conn.Release()
+
+	var account models.Account
+	err = inTransaction(conn, func() error {
+		account, err = s.BalanceRepo.SetAccountShards(conn, req.UserID, req.Shards)
+		return err
+	})
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.Account{}, er.ErrNotFound
+	case err != nil:
+		return models.Account{}, err
+	}
+
+	return account, nil
+}
+
+func (s *AccountService) setStatus(uuid string, from []string, status string) (models.Account, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.Account{}, err
+	}
+	defer conn.Release()
+
+	var account models.Account
+	err = inTransaction(conn, func() error {
+		account, err = s.BalanceRepo.SetAccountStatus(conn, uuid, from, status)
+		return err
+	})
+	invalidateBalances(s.Log, s.BalanceCache, uuid)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.Account{}, s.statusConflict(conn, uuid, status)
+	case err != nil:
+		return models.Account{}, err
+	}
+
+	return account, nil
+}
+
+// statusConflict explains why a status change matched no row.
+func (s *AccountService) statusConflict(conn *pgxpool.Conn, uuid string, status string) error {
+	account, err := s.BalanceRepo.GetAccount(conn, uuid)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return er.ErrNotFound
+	case err != nil:
+		return err
+	case account.Status == models.AccountClosed:
+		return er.ErrAccountClosed
+	case status == models.AccountClosed:
+		return er.ErrAccountNotEmpty
+	case account.Status == models.AccountFrozen:
+		return er.ErrAccountFrozen
+	default:
+		return er.ErrAccountState
+	}
+}
+
+// checkAccountActive rejects balance changes of frozen and closed accounts.
+func checkAccountActive(user models.User) error {
+	switch user.Status {
+	case models.AccountFrozen:
+		return er.ErrAccountFrozen
+	case models.AccountClosed:
+		return er.ErrAccountClosed
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,220 @@
+package balance_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+// AdjustmentService implements four-eyes manual adjustments: one operator
+// proposes, another approves, and only then the change is posted.
+type AdjustmentService struct {
+	Log                *zap.SugaredLogger
+	AdjustmentRepo     interfaces.IAdjustmentRepo
+	UserBalanceService *UserBalanceService
+	DBHandler          interfaces.IDBHandler
+}
+
+func (s *AdjustmentService) Propose(operator string, req models.AdjustmentProposal) (models.ManualAdjustment, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.ManualAdjustment{}, err
+	}
+	defer conn.Release()
+
+	var adj models.ManualAdjustment
+	err = inTransaction(conn, func() error {
+		adj, err = s.AdjustmentRepo.CreateAdjustment(conn, req, operator)
+		if err != nil {
+			return err
+		}
+
+		details := fmt.Sprintf("amount=%v currency=%s reason=%q", req.Amount, req.Currency, req.Reason)
+		return s.audit(conn, adj.ID, models.AuditProposed, operator, &details)
+	})
+	if err != nil {
+		return models.ManualAdjustment{}, err
+	}
+
+	return adj, nil
+}
+
+func (s *AdjustmentService) Get(id string) (models.ManualAdjustment, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.ManualAdjustment{}, err
+	}
+	defer conn.Release()
+
+	adj, err := s.AdjustmentRepo.GetAdjustment(conn, id)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.ManualAdjustment{}, er.ErrAdjustmentNotFound
+	case err != nil:
+		return models.ManualAdjustment{}, err
+	}
+
+	return adj, nil
+}
+
+func (s *AdjustmentService) List(req models.AdjustmentsListRequest) (models.AdjustmentsListResponse, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.AdjustmentsListResponse{}, err
+	}
+	defer conn.Release()
+
+	list, err := s.AdjustmentRepo.ListAdjustments(conn, req)
+	if err != nil {
+		return models.AdjustmentsListResponse{}, err
+	}
+
+	return models.AdjustmentsListResponse{Adjustments: list}, nil
+}
+
+// Approve marks the adjustment approved and posts it like UpdateAccount with
+// both operators recorded as who. The review, the posting and its outcome are
+// one transaction, a failed posting is only undone itself and recorded on the
+// adjustment.
+func (s *AdjustmentService) Approve(operator string, id string, req models.AdjustmentReview) (models.ManualAdjustment, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.ManualAdjustment{}, err
+	}
+	defer conn.Release()
+
+	var adj models.ManualAdjustment
+	var postErr error
+	err = inTransaction(conn, func() error {
+		adj, err = s.review(conn, operator, id, models.AdjustmentApproved, models.AuditApproved, req)
+		if err != nil {
+			return err
+		}
+
+		update := models.UserBalanceUpdate{
+			UserID:      adj.UserID,
+			Who:         adj.ProposedBy + "," + operator,
+			Description: adj.Reason,
+			Amount:      adj.Amount,
+			Currency:    adj.Currency,
+			Operation:   models.OperationAdjustment,
+		}
+		var resp models.UserBalanceUpdateResponse
+		postErr = inSavepoint(conn, func() (err error) {
+			resp, err = s.UserBalanceService.updateAccount(conn, update)
+			return err
+		})
+
+		if postErr != nil {
+			reason := postErr.Error()
+			adj, err = s.AdjustmentRepo.FinishAdjustment(conn, adj.ID, models.AdjustmentFailed, nil, &reason)
+			if err != nil {
+				return err
+			}
+			return s.audit(conn, adj.ID, models.AuditFailed, operator, &reason)
+		}
+
+		trxID := resp.Transaction.TrxID
+		adj, err = s.AdjustmentRepo.FinishAdjustment(conn, adj.ID, models.AdjustmentPosted, &trxID, nil)
+		if err != nil {
+			return err
+		}
+		details := fmt.Sprintf("transaction=%s balance=%v", trxID, resp.User.Balance)
+		return s.audit(conn, adj.ID, models.AuditPosted, operator, &details)
+	})
+	if adj.UserID != "" {
+		s.UserBalanceService.invalidateBalances(adj.UserID)
+	}
+	if err != nil {
+		return models.ManualAdjustment{}, err
+	}
+
+	if postErr != nil {
+		return adj, postErr
+	}
+
+	return adj, nil
+}
+
+func (s *AdjustmentService) Reject(operator string, id string, req models.AdjustmentReview) (models.ManualAdjustment, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.ManualAdjustment{}, err
+	}
+	defer conn.Release()
+
+	var adj models.ManualAdjustment
+	err = inTransaction(conn, func() error {
+		adj, err = s.review(conn, operator, id, models.AdjustmentRejected, models.AuditRejected, req)
+		return err
+	})
+	if err != nil {
+		return models.ManualAdjustment{}, err
+	}
+
+	return adj, nil
+}
+
+func (s *AdjustmentService) AuditLog(id string) (models.AuditLogResponse, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.AuditLogResponse{}, err
+	}
+	defer conn.Release()
+
+	entries, err := s.AdjustmentRepo.ListAuditEntries(conn, id)
+	switch {
+	case err != nil:
+		return models.AuditLogResponse{}, err
+	case len(entries) == 0:
+		return models.AuditLogResponse{}, er.ErrAdjustmentNotFound
+	}
+
+	return models.AuditLogResponse{Entries: entries}, nil
+}
+
+// review locks a pending adjustment proposed by another operator and records
+// the decision. It runs in the transaction of the caller.
+func (s *AdjustmentService) review(conn *pgxpool.Conn, operator string, id string, status string, action string, req models.AdjustmentReview) (models.ManualAdjustment, error) {
+	adj, err := s.AdjustmentRepo.LockAdjustment(conn, id)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.ManualAdjustment{}, er.ErrAdjustmentNotFound
+	case err != nil:
+		return models.ManualAdjustment{}, err
+	case adj.Status != models.AdjustmentPending:
+		return models.ManualAdjustment{}, er.ErrAdjustmentReviewed
+	case adj.ProposedBy == operator:
+		return models.ManualAdjustment{}, er.ErrSameOperator
+	}
+
+	adj, err = s.AdjustmentRepo.ReviewAdjustment(conn, id, operator, status)
+	if err != nil {
+		return models.ManualAdjustment{}, err
+	}
+
+	var details *string
+	if req.Comment != "" {
+		details = &req.Comment
+	}
+	if err := s.audit(conn, adj.ID, action, operator, details); err != nil {
+		return models.ManualAdjustment{}, err
+	}
+
+	return adj, nil
+}
+
+func (s *AdjustmentService) audit(conn *pgxpool.Conn, id string, action string, actor string, details *string) error {
+	return s.AdjustmentRepo.InsertAuditEntry(conn, models.AuditEntry{
+		AdjustmentID: id,
+		Action:       action,
+		Actor:        actor,
+		Details:      details,
+	})
+}
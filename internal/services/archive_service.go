@@ -0,0 +1,161 @@
+package balance_services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+	"users_balance/internal/archive"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+// partitionsAhead is how many months after the current one are given their
+// partition in advance.
+const partitionsAhead = 2
+
+type ArchiveService struct {
+	Log         *zap.SugaredLogger
+	ArchiveRepo interfaces.IArchiveRepo
+	DBHandler   interfaces.IDBHandler
+	// Store receives the archive files, nil while archival is off
+	Store interfaces.IArchiveStore
+	// Retention is how many months before the current one stay in the table
+	Retention int
+}
+
+// Archive creates the partitions of the current and coming months, then moves
+// the months past retention to the store, the oldest first. Only one replica
+// archives at a time, the others return an empty report.
+func (s *ArchiveService) Archive(ctx context.Context) (models.ArchiveReport, error) {
+	conn, err := s.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return models.ArchiveReport{}, err
+	}
+	defer conn.Release()
+
+	report := models.ArchiveReport{
+		StartedAt:         time.Now().UTC(),
+		CreatedPartitions: []string{},
+		Archived:          []models.TransactionArchive{},
+	}
+
+	locked, err := s.ArchiveRepo.TryArchiveLock(conn)
+	if err != nil {
+		return models.ArchiveReport{}, err
+	}
+	if !locked {
+		report.FinishedAt = time.Now().UTC()
+		return report, nil
+	}
+	defer s.ArchiveRepo.ReleaseArchiveLock(conn)
+
+	current := time.Date(report.StartedAt.Year(), report.StartedAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= partitionsAhead; i++ {
+		month := current.AddDate(0, i, 0)
+		created, err := s.ArchiveRepo.CreatePartition(conn, month)
+		if err != nil {
+			return models.ArchiveReport{}, err
+		}
+		if created {
+			report.CreatedPartitions = append(report.CreatedPartitions,
+				fmt.Sprintf("transactions_%04d_%02d", month.Year(), month.Month()))
+		}
+	}
+
+	if s.Store == nil {
+		report.FinishedAt = time.Now().UTC()
+		return report, nil
+	}
+
+	partitions, err := s.ArchiveRepo.ListPartitions(conn)
+	if err != nil {
+		return models.ArchiveReport{}, err
+	}
+
+	cutoff := current.AddDate(0, -s.Retention, 0)
+	for _, partition := range partitions {
+		if partition.To.After(cutoff) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return models.ArchiveReport{}, err
+		}
+
+		archived, err := s.archivePartition(ctx, conn, partition)
+		if err != nil {
+			return models.ArchiveReport{}, errors.Wrap(err, partition.Name)
+		}
+		report.Archived = append(report.Archived, archived)
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	return report, nil
+}
+
+// archivePartition writes a partition to an archive file, stores it and then
+// drops the partition. A run stopped in between stores the file again.
+// Dropping the partition locks the transactions table for the moment it
+// takes.
+func (s *ArchiveService) archivePartition(ctx context.Context, conn *pgxpool.Conn, partition models.TransactionPartition) (models.TransactionArchive, error) {
+	f, err := ioutil.TempFile("", partition.Name+".*."+archive.Format)
+	if err != nil {
+		return models.TransactionArchive{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+	writer, err := archive.NewWriter(io.MultiWriter(f, hash))
+	if err != nil {
+		return models.TransactionArchive{}, err
+	}
+	if err := s.ArchiveRepo.ExportPartition(conn, partition.Name, writer.Write); err != nil {
+		return models.TransactionArchive{}, err
+	}
+	if err := writer.Close(); err != nil {
+		return models.TransactionArchive{}, err
+	}
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return models.TransactionArchive{}, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return models.TransactionArchive{}, err
+	}
+
+	key := path.Join("transactions", partition.From.Format("2006"), partition.Name+"."+archive.Format)
+	location, err := s.Store.Put(ctx, key, f, size)
+	if err != nil {
+		return models.TransactionArchive{}, err
+	}
+
+	archived := models.TransactionArchive{
+		Partition:    partition.Name,
+		From:         partition.From,
+		To:           partition.To,
+		Location:     location,
+		Format:       archive.Format,
+		Transactions: writer.Transactions,
+		Amount:       writer.Amount,
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	err = inTransaction(conn, func() error {
+		return s.ArchiveRepo.ArchivePartition(conn, archived)
+	})
+	if err != nil {
+		return models.TransactionArchive{}, err
+	}
+
+	return archived, nil
+}
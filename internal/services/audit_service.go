@@ -0,0 +1,168 @@
+package balance_services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+	"users_balance/internal/config"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+const auditVerifyBatch = 1000
+
+// genesisHash is the prev_hash of the first link.
+var genesisHash = strings.Repeat("0", 64)
+
+type AuditService struct {
+	Log       *zap.SugaredLogger
+	Config    *config.Config
+	AuditRepo interfaces.IAuditRepo
+	DBHandler interfaces.IDBHandler
+}
+
+// Sequence chains the links of every committed balance mutation still pending
+// and returns how many it chained. Mutations are only written to a pending
+// table so they do not wait for each other, the chain is extended here.
+func (s *AuditService) Sequence(ctx context.Context) (int, error) {
+	conn, err := s.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		chained, err := s.AuditRepo.SequencePending(conn, auditVerifyBatch)
+		if err != nil {
+			return total, err
+		}
+		total += chained
+
+		if chained < auditVerifyBatch {
+			return total, nil
+		}
+	}
+}
+
+// Verify walks the whole chain and reports the first link whose sequence,
+// back reference or hash does not match.
+func (s *AuditService) Verify(ctx context.Context) (models.ChainReport, error) {
+	conn, err := s.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return models.ChainReport{}, err
+	}
+	defer conn.Release()
+
+	report := models.ChainReport{LastHash: genesisHash, Valid: true}
+	var lastSeq int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return models.ChainReport{}, err
+		}
+
+		entries, err := s.AuditRepo.ListChain(conn, lastSeq, auditVerifyBatch)
+		if err != nil {
+			return models.ChainReport{}, err
+		}
+
+		for _, entry := range entries {
+			reason := ""
+			expected := ChainHash(report.LastHash, entry)
+			switch {
+			case entry.Seq != lastSeq+1:
+				reason = fmt.Sprintf("sequence gap, expected %d", lastSeq+1)
+			case entry.PrevHash != report.LastHash:
+				reason = "prev_hash does not match the previous link"
+			case entry.Hash != expected:
+				reason = "hash does not match the link content"
+			}
+
+			if reason != "" {
+				seq := entry.Seq
+				report.BrokenAt = &seq
+				report.Reason = reason
+				report.Expected = &expected
+				report.Valid = false
+				return report, nil
+			}
+
+			report.Checked++
+			report.LastHash = entry.Hash
+			lastSeq = entry.Seq
+		}
+
+		if len(entries) < auditVerifyBatch {
+			return report, nil
+		}
+	}
+}
+
+// Checkpoint signs the current head of the chain with the configured Ed25519
+// key.
+func (s *AuditService) Checkpoint() (models.AuditCheckpoint, error) {
+	key, err := s.signingKey()
+	if err != nil {
+		return models.AuditCheckpoint{}, err
+	}
+
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.AuditCheckpoint{}, err
+	}
+	defer conn.Release()
+
+	checkpoint := models.AuditCheckpoint{LastHash: genesisHash, CreatedAt: time.Now().UTC()}
+	count, head, err := s.AuditRepo.ChainHead(conn)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+	case err != nil:
+		return models.AuditCheckpoint{}, err
+	default:
+		checkpoint.Count = count
+		checkpoint.LastSeq = head.Seq
+		checkpoint.LastHash = head.Hash
+	}
+
+	checkpoint.SignedPayload = fmt.Sprintf("%d|%d|%s|%s", checkpoint.Count, checkpoint.LastSeq, checkpoint.LastHash,
+		checkpoint.CreatedAt.Format(time.RFC3339Nano))
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(checkpoint.SignedPayload)))
+	checkpoint.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	return checkpoint, nil
+}
+
+func (s *AuditService) signingKey() (ed25519.PrivateKey, error) {
+	if s.Config.AuditData.SigningKey == "" {
+		return nil, er.ErrNoSigningKey
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(string(s.Config.AuditData.SigningKey))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, er.ErrNoSigningKey
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ChainHash computes a link hash the same way audit_chain_append does.
+func ChainHash(prevHash string, entry models.AuditChainEntry) string {
+	data := prevHash + "|" + strconv.FormatInt(entry.Seq, 10) + "|" + entry.Entity + "|" + entry.EntityID + "|" + entry.Payload
+	sum := sha256.Sum256([]byte(data))
+
+	return hex.EncodeToString(sum[:])
+}
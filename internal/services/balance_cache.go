@@ -0,0 +1,62 @@
+package balance_services
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+// readBalance reads the current balance through the cache when it is on. A
+// failing cache is skipped, the balance is then read from the database.
+func (s *UserBalanceService) readBalance(uuid string) (models.User, error) {
+	if s.BalanceCache == nil {
+		return s.loadBalance(uuid, nil)
+	}
+	ctx := context.Background()
+
+	cached, hit, token, err := s.BalanceCache.Get(ctx, uuid)
+	if err != nil {
+		s.Log.Warnf("balance cache :: get %s :: %s", uuid, err)
+		result, err := s.loadBalance(uuid, nil)
+		result.CacheStatus = models.CacheBypass
+		return result, err
+	}
+	if hit {
+		cached.CacheStatus = models.CacheHit
+		return cached, nil
+	}
+
+	result, err := s.loadBalance(uuid, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := s.BalanceCache.Set(ctx, result, token); err != nil {
+		s.Log.Warnf("balance cache :: set %s :: %s", uuid, err)
+	}
+	result.CacheStatus = models.CacheMiss
+
+	return result, nil
+}
+
+// invalidateBalances drops the cached balances of wallets written to. It runs
+// once the write is committed or rolled back, a fee also credits the revenue
+// account.
+func (s *UserBalanceService) invalidateBalances(uuids ...string) {
+	if revenue := s.Config.FeeData.RevenueAccount; revenue != "" {
+		uuids = append(uuids, revenue)
+	}
+
+	invalidateBalances(s.Log, s.BalanceCache, uuids...)
+}
+
+func invalidateBalances(log *zap.SugaredLogger, cache interfaces.IBalanceCache, uuids ...string) {
+	if cache == nil || len(uuids) == 0 {
+		return
+	}
+
+	if err := cache.Invalidate(context.Background(), uuids...); err != nil {
+		log.Errorf("balance cache :: invalidate %v :: %s", uuids, err)
+	}
+}
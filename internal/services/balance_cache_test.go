@@ -0,0 +1,233 @@
+package balance_services
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+	"users_balance/internal/balancecache"
+	"users_balance/internal/config"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+	"users_balance/internal/repos"
+)
+
+// recordingCache remembers the wallets invalidated through it.
+type recordingCache struct {
+	interfaces.IBalanceCache
+
+	mu          sync.Mutex
+	invalidated []string
+}
+
+func (c *recordingCache) Invalidate(ctx context.Context, uuids ...string) error {
+	c.mu.Lock()
+	c.invalidated = append(c.invalidated, uuids...)
+	c.mu.Unlock()
+
+	return c.IBalanceCache.Invalidate(ctx, uuids...)
+}
+
+func (c *recordingCache) wasInvalidated(uuid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, invalidated := range c.invalidated {
+		if invalidated == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+func TestInvalidateBalancesAddsRevenueAccount(t *testing.T) {
+	cache := &recordingCache{IBalanceCache: balancecache.NewMemoryStore(10, time.Minute)}
+	revenue := uuid.NewString()
+	s := &UserBalanceService{
+		Log:          zap.NewNop().Sugar(),
+		Config:       &config.Config{FeeData: config.FeeData{RevenueAccount: revenue}},
+		BalanceCache: cache,
+	}
+	wallet := uuid.NewString()
+
+	s.invalidateBalances(wallet)
+
+	if !cache.wasInvalidated(wallet) || !cache.wasInvalidated(revenue) {
+		t.Fatalf("invalidated %v, want %s and the revenue account %s", cache.invalidated, wallet, revenue)
+	}
+}
+
+func TestReadBalanceServesCachedBalance(t *testing.T) {
+	cache := balancecache.NewMemoryStore(10, time.Minute)
+	wallet := uuid.NewString()
+	_, _, token, _ := cache.Get(context.Background(), wallet)
+	cache.Set(context.Background(), models.User{ID: wallet, Balance: 100}, token)
+
+	// no database, a hit must not need one
+	s := &UserBalanceService{Log: zap.NewNop().Sugar(), Config: &config.Config{}, BalanceCache: cache}
+
+	user, err := s.GetUserBalance(wallet, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Balance != 100 || user.CacheStatus != models.CacheHit {
+		t.Fatalf("got %+v, want the cached balance 100", user)
+	}
+}
+
+// poolHandler hands out the connections of a pool.
+type poolHandler struct {
+	interfaces.IDBHandler
+	pool *pgxpool.Pool
+}
+
+func (h poolHandler) AcquireConn(ctx context.Context) (*pgxpool.Conn, error) {
+	return h.pool.Acquire(ctx)
+}
+
+// newDatabaseService returns a service on the database of TEST_DATABASE_URL,
+// with the schema of assets/init.sql applied, and skips the test without one.
+func newDatabaseService(t *testing.T) (*UserBalanceService, *recordingCache) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	schema, err := ioutil.ReadFile("../../assets/init.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(context.Background(), string(schema)); err != nil {
+		t.Fatal(err)
+	}
+
+	log := zap.NewNop().Sugar()
+	cfg := &config.Config{AccountsData: config.AccountsData{AutoCreate: true}}
+	cache := &recordingCache{IBalanceCache: balancecache.NewMemoryStore(100, time.Minute)}
+
+	return &UserBalanceService{
+		Log:          log,
+		Config:       cfg,
+		BalanceRepo:  &balance_repos.UserBalanceRepo{Log: log, Client: http.DefaultClient, Config: cfg},
+		LimitsRepo:   &balance_repos.SpendingLimitsRepo{Log: log},
+		FeeRepo:      &balance_repos.FeeRepo{Log: log},
+		OutboxRepo:   &balance_repos.OutboxRepo{Log: log},
+		WebhookRepo:  &balance_repos.WebhookRepo{Log: log},
+		SnapshotRepo: &balance_repos.SnapshotRepo{Log: log},
+		ArchiveRepo:  &balance_repos.ArchiveRepo{Log: log},
+		DBHandler:    poolHandler{pool: pool},
+		BalanceCache: cache,
+	}, cache
+}
+
+func credit(t *testing.T, s *UserBalanceService, wallet string, amount float64) {
+	t.Helper()
+	_, err := s.UpdateAccount(models.UserBalanceUpdate{
+		UserID:   wallet,
+		Who:      "test",
+		Amount:   amount,
+		Currency: models.RUB,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cachedBalance reads a balance through the cache, expecting the given cache
+// status.
+func cachedBalance(t *testing.T, s *UserBalanceService, wallet string, status string) float64 {
+	t.Helper()
+	user, err := s.GetUserBalance(wallet, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.CacheStatus != status {
+		t.Fatalf("balance of %s was a cache %s, want %s", wallet, user.CacheStatus, status)
+	}
+
+	return user.Balance
+}
+
+func TestUpdateAccountInvalidatesBalance(t *testing.T) {
+	s, cache := newDatabaseService(t)
+	wallet := uuid.NewString()
+	credit(t, s, wallet, 100)
+
+	cachedBalance(t, s, wallet, models.CacheMiss)
+	cachedBalance(t, s, wallet, models.CacheHit)
+
+	credit(t, s, wallet, 50)
+
+	if !cache.wasInvalidated(wallet) {
+		t.Fatal("the credit did not invalidate the wallet")
+	}
+	if balance := cachedBalance(t, s, wallet, models.CacheMiss); balance != 150 {
+		t.Fatalf("balance %v after the credit, want 150", balance)
+	}
+}
+
+func TestUpdateAccountDryRunKeepsBalance(t *testing.T) {
+	s, _ := newDatabaseService(t)
+	wallet := uuid.NewString()
+	credit(t, s, wallet, 100)
+	cachedBalance(t, s, wallet, models.CacheMiss)
+
+	_, err := s.UpdateAccount(models.UserBalanceUpdate{
+		UserID:   wallet,
+		Who:      "test",
+		Amount:   -30,
+		Currency: models.RUB,
+		DryRun:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cachedBalance(t, s, wallet, models.CacheHit)
+}
+
+func TestTransferInvalidatesBothBalances(t *testing.T) {
+	s, _ := newDatabaseService(t)
+	from, to := uuid.NewString(), uuid.NewString()
+	credit(t, s, from, 100)
+	credit(t, s, to, 10)
+	cachedBalance(t, s, from, models.CacheMiss)
+	cachedBalance(t, s, to, models.CacheMiss)
+
+	if _, err := s.Transfer(models.Transfer{From: from, To: to, Amount: 40}); err != nil {
+		t.Fatal(err)
+	}
+
+	if balance := cachedBalance(t, s, from, models.CacheMiss); balance != 60 {
+		t.Errorf("payer balance %v after the transfer, want 60", balance)
+	}
+	if balance := cachedBalance(t, s, to, models.CacheMiss); balance != 50 {
+		t.Errorf("payee balance %v after the transfer, want 50", balance)
+	}
+}
+
+func TestFailedTransferInvalidatesBalances(t *testing.T) {
+	s, cache := newDatabaseService(t)
+	from, to := uuid.NewString(), uuid.NewString()
+	credit(t, s, from, 10)
+	credit(t, s, to, 10)
+
+	// a failure may come after the first leg was written and aborted
+	s.Transfer(models.Transfer{From: from, To: to, Amount: 40})
+
+	if !cache.wasInvalidated(from) || !cache.wasInvalidated(to) {
+		t.Fatalf("invalidated %v, want %s and %s", cache.invalidated, from, to)
+	}
+}
@@ -2,13 +2,13 @@ package balance_services
 
 import (
 	"context"
-	"fmt"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"net/http"
 	"sort"
+	"time"
 	"users_balance/internal/config"
 	er "users_balance/internal/errors"
 	"users_balance/internal/interfaces"
@@ -16,14 +16,45 @@ import (
 )
 
 type UserBalanceService struct {
-	Log         *zap.SugaredLogger
-	Config      *config.Config
-	BalanceRepo interfaces.ICompanyDetailsRepo
-	DBHandler   interfaces.IDBHandler
+	Log          *zap.SugaredLogger
+	Config       *config.Config
+	BalanceRepo  interfaces.ICompanyDetailsRepo
+	LimitsRepo   interfaces.ISpendingLimitsRepo
+	FeeRepo      interfaces.IFeeRepo
+	OutboxRepo   interfaces.IOutboxRepo
+	WebhookRepo  interfaces.IWebhookRepo
+	SnapshotRepo interfaces.ISnapshotRepo
+	ArchiveRepo  interfaces.IArchiveRepo
+	DBHandler    interfaces.IDBHandler
+	// BalanceCache serves current balances, nil when the cache is off
+	BalanceCache interfaces.IBalanceCache
 }
 
 //provide users balance
-func (s *UserBalanceService) GetUserBalance(uuid string, currency string) (models.User, error) {
+//when at is set, the balance the user had at that moment from the transaction history
+func (s *UserBalanceService) GetUserBalance(uuid string, currency string, at *time.Time) (models.User, error) {
+	var result models.User
+	var err error
+	if at == nil {
+		result, err = s.readBalance(uuid)
+	} else {
+		result, err = s.loadBalance(uuid, at)
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if currency != "" && currency != "RUB" {
+		s.calculateExchangeBalance(&result, currency)
+		return result, nil
+	}
+
+	result.Currency = models.RUB
+	return result, nil
+}
+
+// loadBalance reads the balance from the database.
+func (s *UserBalanceService) loadBalance(uuid string, at *time.Time) (models.User, error) {
 	conn, err := s.DBHandler.AcquireConn(context.Background())
 	if err != nil {
 		s.Log.Info(err.Error())
@@ -39,12 +70,20 @@ func (s *UserBalanceService) GetUserBalance(uuid string, currency string) (model
 		return models.User{}, err
 	}
 
-	if currency != "" && currency != "RUB" {
-		s.calculateExchangeBalance(&result, currency)
-		return result, nil
+	if at != nil {
+		if err := s.checkArchived(conn, uuid, *at); err != nil {
+			return models.User{}, err
+		}
+		result.Balance, err = s.SnapshotRepo.GetBalanceAt(conn, uuid, *at)
+		if err != nil {
+			return models.User{}, err
+		}
+		result.At = at
+		if s.BalanceCache != nil {
+			result.CacheStatus = models.CacheBypass
+		}
 	}
 
-	result.Currency = models.RUB
 	return result, nil
 }
 
@@ -54,37 +93,105 @@ func (s *UserBalanceService) UpdateAccount(req models.UserBalanceUpdate) (models
 		return models.UserBalanceUpdateResponse{}, err
 	}
 	defer conn.Release()
+	if !req.DryRun {
+		defer s.invalidateBalances(req.UserID)
+	}
+
+	var result models.UserBalanceUpdateResponse
+	err = inTransaction(conn, func() error {
+		result, err = s.updateAccount(conn, req)
+		return err
+	})
+	if err != nil {
+		return models.UserBalanceUpdateResponse{}, err
+	}
+
+	return result, nil
+}
+
+// updateAccount applies a balance change, its fee and their outbox events on
+// conn. Callers run it inside a transaction. The account is locked until the
+// transaction ends so it can not be frozen or closed after its status was
+// checked, debits hold it alone so their funds check stays true.
+func (s *UserBalanceService) updateAccount(conn *pgxpool.Conn, req models.UserBalanceUpdate) (models.UserBalanceUpdateResponse, error) {
+	account, err := s.BalanceRepo.LockUserBalance(conn, req.UserID, req.Amount < 0)
+	exists := err == nil
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows && !s.Config.AccountsData.AutoCreate:
+		return models.UserBalanceUpdateResponse{}, er.ErrNotFound
+	case errors.Cause(err) == pgx.ErrNoRows:
+	case err != nil:
+		return models.UserBalanceUpdateResponse{}, err
+	default:
+		if err := checkAccountActive(account); err != nil {
+			return models.UserBalanceUpdateResponse{}, err
+		}
+	}
+
+	fee, err := s.quoteFee(conn, req.UserID, feeOperation(req), req.Amount, req.Currency)
+	if err != nil {
+		return models.UserBalanceUpdateResponse{}, err
+	}
 
-	if req.Amount < 0 {
-		result, err := s.BalanceRepo.GetUserBalance(conn, req.UserID)
+	if req.Amount-fee < 0 {
 		switch {
-		case err == nil && result.Balance+req.Amount < 0:
-			return models.UserBalanceUpdateResponse{}, er.ErrInsufficientFunds
-		case errors.Cause(err) == pgx.ErrNoRows:
+		case !exists:
 			return models.UserBalanceUpdateResponse{}, er.ErrNegativeCreate
+		case account.Balance+req.Amount-fee < 0:
+			return models.UserBalanceUpdateResponse{}, er.ErrInsufficientFunds
 		}
 	}
 
-	user, err := s.BalanceRepo.UpdateAccount(conn, req)
-	switch {
-	case errors.Cause(err) == pgx.ErrNoRows:
-		result, err := s.createNewUser(conn, req)
+	// transfers are checked once as a whole in Transfer, system operations
+	// such as reversals and manual adjustments are not spending. The fee is
+	// spent with the amount.
+	if req.Amount < 0 && (req.Operation == "" || req.Operation == models.OperationUpdate) {
+		err = checkSpendingLimits(s.LimitsRepo, conn, req.UserID, fee-req.Amount, false)
 		if err != nil {
 			return models.UserBalanceUpdateResponse{}, err
 		}
-		return result, nil
-	case err != nil:
-		return models.UserBalanceUpdateResponse{}, err
 	}
 
-	trx, err := s.BalanceRepo.InsertTransaction(conn, req)
+	if req.DryRun {
+		quote := &models.FeeQuote{Amount: req.Amount, Fee: fee, Total: req.Amount - fee, DryRun: true}
+		return models.UserBalanceUpdateResponse{Quote: quote}, nil
+	}
+
+	var result models.UserBalanceUpdateResponse
+	if exists {
+		user, err := s.BalanceRepo.UpdateAccount(conn, req)
+		if err != nil {
+			return models.UserBalanceUpdateResponse{}, err
+		}
+
+		trx, err := s.BalanceRepo.InsertTransaction(conn, req)
+		if err != nil {
+			return models.UserBalanceUpdateResponse{}, err
+		}
+
+		result = models.UserBalanceUpdateResponse{
+			User:        user,
+			Transaction: trx,
+		}
+	} else {
+		result, err = s.createNewUser(conn, req)
+		if err != nil {
+			return models.UserBalanceUpdateResponse{}, err
+		}
+	}
+
+	err = s.emitBalanceChanged(conn, result.User, result.Transaction)
 	if err != nil {
 		return models.UserBalanceUpdateResponse{}, err
 	}
 
-	result := models.UserBalanceUpdateResponse{
-		User:        user,
-		Transaction: trx,
+	if fee > 0 {
+		feeTrx, _, user, err := s.chargeFee(conn, req.UserID, fee, req.Currency, req.Who, result.Transaction.TrxID)
+		if err != nil {
+			return models.UserBalanceUpdateResponse{}, err
+		}
+		result.User = user
+		result.FeeTransaction = &feeTrx
 	}
 
 	return result, nil
@@ -97,10 +204,8 @@ func (s *UserBalanceService) Transfer(req models.Transfer) (models.TransferRespo
 		return models.TransferResponse{}, err
 	}
 	defer conn.Release()
-
-	err = s.isTransferPossible(conn, req.From, req.To, req.Amount)
-	if err != nil {
-		return models.TransferResponse{}, err
+	if !req.DryRun {
+		defer s.invalidateBalances(req.From, req.To)
 	}
 
 	res, err := s.doTransfer(conn, req)
@@ -125,29 +230,113 @@ func (s *UserBalanceService) GetTransactionsList(req models.TransactionsListRequ
 		return models.TransactionsListResponse{}, er.ErrNotFound
 	case err != nil:
 		return models.TransactionsListResponse{}, err
-	case len(list) == 0:
+	}
+
+	archivedBefore, err := s.ArchiveRepo.ArchivedBefore(conn, req.UserID)
+	if err != nil {
+		return models.TransactionsListResponse{}, err
+	}
+	// a user whose every transaction is archived still has a history
+	if len(list) == 0 && (archivedBefore == nil || req.Offset > 0) {
 		return models.TransactionsListResponse{}, er.ErrNotFound
 	}
 
+	for i := range list {
+		list[i].CreatedAt = list[i].CreatedAt.In(req.Location)
+	}
 	trxsort(list, req.SortBy, req.Cmp)
 
 	result := models.TransactionsListResponse{
 		TransactionsList: list,
+		ArchivedBefore:   archivedBefore,
 	}
 
 	return result, nil
 }
 
+// GetStatement builds the statement of a period. The opening balance is the
+// sum of all earlier transactions, a period starting before the archived
+// transactions of the user can not be stated.
+func (s *UserBalanceService) GetStatement(req models.StatementRequest) (models.Statement, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		s.Log.Info("acquire conn error")
+		return models.Statement{}, err
+	}
+	defer conn.Release()
+
+	_, err = s.BalanceRepo.GetUserBalance(conn, req.UserID)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.Statement{}, er.ErrNotFound
+	case err != nil:
+		return models.Statement{}, err
+	}
+
+	if err := s.checkArchived(conn, req.UserID, req.From); err != nil {
+		return models.Statement{}, err
+	}
+
+	opening, err := s.BalanceRepo.GetBalanceBefore(conn, req.UserID, req.From)
+	if err != nil {
+		return models.Statement{}, err
+	}
+
+	list, err := s.BalanceRepo.GetTransactionsBetween(conn, req.UserID, req.From, req.To.AddDate(0, 0, 1))
+	if err != nil {
+		return models.Statement{}, err
+	}
+
+	statement := models.Statement{
+		UserID:         req.UserID,
+		From:           req.From,
+		To:             req.To,
+		Currency:       models.RUB,
+		OpeningBalance: opening,
+		Lines:          make([]models.StatementLine, 0, len(list)),
+		GeneratedAt:    time.Now().UTC(),
+	}
+
+	balance := opening
+	for _, trx := range list {
+		trx.CreatedAt = trx.CreatedAt.In(req.Location)
+		balance += trx.Amount
+		if trx.Amount >= 0 {
+			statement.TotalCredits += trx.Amount
+		} else {
+			statement.TotalDebits -= trx.Amount
+		}
+		statement.Lines = append(statement.Lines, models.StatementLine{Transaction: trx, Balance: balance})
+	}
+	statement.ClosingBalance = balance
+
+	return statement, nil
+}
+
+// checkArchived fails with an *er.ArchivedError when at is before the end of
+// the user's archived transactions, which are only kept as a sum.
+func (s *UserBalanceService) checkArchived(conn *pgxpool.Conn, uuid string, at time.Time) error {
+	before, err := s.ArchiveRepo.ArchivedBefore(conn, uuid)
+	if err != nil {
+		return err
+	}
+	if before != nil && at.Before(*before) {
+		return &er.ArchivedError{Before: *before}
+	}
+
+	return nil
+}
+
 func trxsort(list []models.Transaction, by string, cmp string) {
 	switch by {
 	case "date":
 		if cmp == "d" {
 			sort.SliceStable(list, func(i, j int) bool {
-				return list[i].Timestamp > list[j].Timestamp
+				return list[i].CreatedAt.After(list[j].CreatedAt)
 			})
 		} else if cmp == "i" {
 			sort.SliceStable(list, func(i, j int) bool {
-				return list[i].Timestamp < list[j].Timestamp
+				return list[i].CreatedAt.Before(list[j].CreatedAt)
 			})
 		}
 	case "amount":
@@ -181,35 +370,86 @@ func (s *UserBalanceService) createNewUser(conn *pgxpool.Conn, req models.UserBa
 	return result, nil
 }
 
+// doTransfer checks the sender and debits the amount and its fee in one
+// transaction, holding the sender's row so transfers made at once are checked
+// one after the other, then credits the recipient in a second one. The debit
+// and the fee are reversed when the second fails.
 func (s *UserBalanceService) doTransfer(conn *pgxpool.Conn, req models.Transfer) (models.TransferResponse, error) {
 	const senderTransferDescriptionStatement = `transfer to another user`
 	sender := models.UserBalanceUpdate{
 		UserID:      req.From,
-		Who:         req.From,
+		Who:         req.Who,
 		Description: senderTransferDescriptionStatement,
 		Amount:      -req.Amount,
 		Currency:    models.RUB,
+		Operation:   models.OperationTransferOut,
+	}
+	if req.Description != "" {
+		sender.Description = req.Description
 	}
-	senderUpd, err := s.UpdateAccount(sender)
+	var fee float64
+	var senderUpd models.UserBalanceUpdateResponse
+	var feeTrx, incomeTrx models.Transaction
+	err := inTransaction(conn, func() (err error) {
+		fee, err = s.isTransferPossible(conn, req.From, req.To, req.Amount)
+		if err != nil || req.DryRun {
+			return err
+		}
+
+		senderUpd, err = s.updateAccount(conn, sender)
+		if err != nil || fee <= 0 {
+			return err
+		}
+
+		feeTrx, incomeTrx, _, err = s.chargeFee(conn, req.From, fee, models.RUB, req.Who, senderUpd.Transaction.TrxID)
+		return err
+	})
 	if err != nil {
 		return models.TransferResponse{}, err
 	}
 
+	if req.DryRun {
+		quote := &models.FeeQuote{Amount: req.Amount, Fee: fee, Total: -(req.Amount + fee), DryRun: true}
+		return models.TransferResponse{Success: "true", Quote: quote}, nil
+	}
+
 	const recipientTransferDescriptionStatement = `transfer from another user`
 	recipient := models.UserBalanceUpdate{
 		UserID:      req.To,
-		Who:         req.From,
+		Who:         req.Who,
 		Description: recipientTransferDescriptionStatement,
 		Amount:      req.Amount,
 		Currency:    models.RUB,
+		Operation:   models.OperationTransferIn,
+	}
+	if req.Description != "" {
+		recipient.Description = req.Description
 	}
-	_, err = s.UpdateAccount(recipient)
+	err = inTransaction(conn, func() error {
+		recipientUpd, err := s.updateAccount(conn, recipient)
+		if err != nil {
+			return err
+		}
+
+		return s.emitEvent(conn, models.EventTransferCompleted, req.From, models.TransferCompletedEvent{
+			From:                   req.From,
+			To:                     req.To,
+			Amount:                 req.Amount,
+			Fee:                    fee,
+			SenderTransactionID:    senderUpd.Transaction.TrxID,
+			RecipientTransactionID: recipientUpd.Transaction.TrxID,
+		})
+	})
 	if err != nil {
 		s.abortTransaction(conn, sender.UserID, senderUpd.Transaction.TrxID)
+		if fee > 0 {
+			s.abortTransaction(conn, req.From, feeTrx.TrxID)
+			s.abortTransaction(conn, s.Config.FeeData.RevenueAccount, incomeTrx.TrxID)
+		}
 		return models.TransferResponse{}, err
 	}
 
-	return models.TransferResponse{Success: "true"}, nil
+	return models.TransferResponse{Success: "true", TransactionID: senderUpd.Transaction.TrxID}, nil
 }
 
 func (s *UserBalanceService) abortTransaction(conn *pgxpool.Conn, userUUID string, trxUUID string) bool {
@@ -221,43 +461,82 @@ func (s *UserBalanceService) abortTransaction(conn *pgxpool.Conn, userUUID strin
 	abortSatement := models.UserBalanceUpdate{
 		UserID:      userUUID,
 		Who:         "server",
-		Description: fmt.Sprintf("abort transaction %s", trxUUID),
+		Description: models.AbortDescription + trxUUID,
 		Amount:      -trx.Amount,
 		Currency:    trx.Currency,
+		Operation:   models.OperationReversal,
+		Reverses:    trxUUID,
 	}
-	_, err = s.BalanceRepo.UpdateAccount(conn, abortSatement)
-	if err != nil {
-		return false
-	}
+	err = inTransaction(conn, func() error {
+		user, err := s.BalanceRepo.UpdateAccount(conn, abortSatement)
+		if err != nil {
+			return err
+		}
+
+		reversal, err := s.BalanceRepo.InsertTransaction(conn, abortSatement)
+		if err != nil {
+			return err
+		}
 
-	_, err = s.BalanceRepo.InsertTransaction(conn, abortSatement)
+		return s.emitBalanceChanged(conn, user, reversal)
+	})
 	if err != nil {
+		s.Log.Errorf("abort transaction %s :: %s", trxUUID, err)
 		return false
 	}
 
 	return true
 }
 
-func (s *UserBalanceService) isTransferPossible(conn *pgxpool.Conn, senderUUID string, recipientUUID string, amount float64) error {
-	sender, err := s.BalanceRepo.GetUserBalance(conn, senderUUID)
-	_, err = s.BalanceRepo.GetUserBalance(conn, recipientUUID)
+// isTransferPossible locks the sender's row and checks both accounts, the
+// sender's funds and spending limits for the amount and its fee, which it
+// returns. It runs in the transaction of the caller.
+func (s *UserBalanceService) isTransferPossible(conn *pgxpool.Conn, senderUUID string, recipientUUID string, amount float64) (float64, error) {
+	sender, err := s.BalanceRepo.LockUserBalance(conn, senderUUID, true)
 	switch {
 	case errors.Cause(err) == pgx.ErrNoRows:
-		return er.ErrNotFound
+		return 0, er.ErrNotFound
 	case err != nil:
-		return err
-	case sender.Balance >= amount:
-		return nil
-	default:
-		return er.ErrNegativeBalance
+		return 0, err
+	}
+
+	recipient, err := s.BalanceRepo.GetUserBalance(conn, recipientUUID)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return 0, er.ErrNotFound
+	case err != nil:
+		return 0, err
+	}
+
+	if err := checkAccountActive(sender); err != nil {
+		return 0, err
+	}
+	if err := checkAccountActive(recipient); err != nil {
+		return 0, err
 	}
+
+	fee, err := s.quoteFee(conn, senderUUID, models.FeeOperationTransfer, amount, models.RUB)
+	if err != nil {
+		return 0, err
+	}
+
+	if sender.Balance < amount+fee {
+		return 0, er.ErrNegativeBalance
+	}
+
+	err = checkSpendingLimits(s.LimitsRepo, conn, senderUUID, amount+fee, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return fee, nil
 }
 
 func (s *UserBalanceService) calculateExchangeBalance(v *models.User, currency string) {
 	req, _ := http.NewRequest(http.MethodGet, s.Config.APIData.URL, nil)
 	req.URL.Path = s.Config.APIData.Path
 	q := req.URL.Query()
-	q.Add("apikey", s.Config.Key)
+	q.Add("apikey", string(s.Config.Key))
 	q.Add("base_currency", currency)
 	req.URL.RawQuery = q.Encode()
 
@@ -0,0 +1,98 @@
+package balance_services
+
+import (
+	"context"
+	er "users_balance/internal/errors"
+	"users_balance/internal/models"
+)
+
+// BatchUpdate applies the items in one database transaction so a batch costs a
+// single commit. Each item goes through the same checks as UpdateAccount and
+// runs in its own savepoint unless the batch is all or nothing. Items are still
+// applied one after the other, at several round trips each, while the
+// transaction holds the row locks of every account it touched so far: the
+// batch limit bounds how long that is.
+func (s *UserBalanceService) BatchUpdate(req models.BatchUpdateRequest) (models.BatchUpdateResponse, error) {
+	if len(req.Items) > s.Config.BatchData.MaxItems {
+		return models.BatchUpdateResponse{}, er.ErrBatchTooLarge
+	}
+
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.BatchUpdateResponse{}, err
+	}
+	defer conn.Release()
+
+	results := make([]models.BatchItemResult, len(req.Items))
+	uuids := make([]string, 0, len(req.Items))
+	for i, item := range req.Items {
+		results[i].Index = i
+		if !item.DryRun {
+			uuids = append(uuids, item.UserID)
+		}
+	}
+	defer s.invalidateBalances(uuids...)
+	failedAt := -1
+
+	err = inTransaction(conn, func() error {
+		for i, item := range req.Items {
+			var resp models.UserBalanceUpdateResponse
+			apply := func() error {
+				var err error
+				resp, err = s.updateAccount(conn, item)
+				return err
+			}
+
+			var err error
+			if req.AllOrNothing {
+				err = apply()
+			} else {
+				err = inSavepoint(conn, apply)
+			}
+
+			if err != nil {
+				results[i].Status = models.BatchItemFailed
+				results[i].Err = err
+				if req.AllOrNothing {
+					failedAt = i
+					return err
+				}
+				continue
+			}
+
+			results[i].Status = models.BatchItemApplied
+			results[i].Result = &resp
+		}
+
+		return nil
+	})
+
+	response := models.BatchUpdateResponse{Results: results}
+	switch {
+	case failedAt >= 0:
+		for i := range results {
+			switch {
+			case i < failedAt:
+				results[i].Status = models.BatchItemRolledBack
+				results[i].Result = nil
+			case i > failedAt:
+				results[i].Status = models.BatchItemSkipped
+			}
+		}
+		response.Failed = 1
+		return response, nil
+	case err != nil:
+		return models.BatchUpdateResponse{}, err
+	}
+
+	response.Committed = true
+	for _, result := range results {
+		if result.Status == models.BatchItemApplied {
+			response.Applied++
+		} else {
+			response.Failed++
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,101 @@
+package balance_services
+
+import (
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"math"
+	"users_balance/internal/models"
+)
+
+// feeOperation maps a balance update to its fee schedule operation. Legs of a
+// transfer, reversals and fees themselves are never charged here.
+func feeOperation(req models.UserBalanceUpdate) string {
+	switch {
+	case req.Operation != "" && req.Operation != models.OperationUpdate:
+		return ""
+	case req.Amount < 0:
+		return models.FeeOperationDebit
+	default:
+		return models.FeeOperationCredit
+	}
+}
+
+// quoteFee returns the commission for moving amount, 0 when no rule applies.
+func (s *UserBalanceService) quoteFee(conn *pgxpool.Conn, userUUID string, operation string, amount float64, currency string) (float64, error) {
+	if operation == "" || s.Config.FeeData.RevenueAccount == "" || userUUID == s.Config.FeeData.RevenueAccount {
+		return 0, nil
+	}
+
+	rule, err := s.FeeRepo.GetFeeRule(conn, operation, currency, userUUID)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return 0, nil
+	case err != nil:
+		return 0, err
+	}
+
+	fee := math.Abs(amount)*rule.Percent/100 + rule.Fixed
+	if rule.MaxFee != nil && fee > *rule.MaxFee {
+		fee = *rule.MaxFee
+	}
+
+	return math.Round(fee*100) / 100, nil
+}
+
+// chargeFee debits the fee from the payer and credits it to the revenue
+// account, returning the payer's fee transaction, the revenue account's credit
+// and the payer's updated balance.
+func (s *UserBalanceService) chargeFee(conn *pgxpool.Conn, payer string, fee float64, currency string, who string, trxUUID string) (models.Transaction, models.Transaction, models.User, error) {
+	charge := models.UserBalanceUpdate{
+		UserID:      payer,
+		Who:         who,
+		Description: fmt.Sprintf("fee for transaction %s", trxUUID),
+		Amount:      -fee,
+		Currency:    currency,
+		Operation:   models.OperationFee,
+	}
+	user, err := s.BalanceRepo.UpdateAccount(conn, charge)
+	if err != nil {
+		return models.Transaction{}, models.Transaction{}, models.User{}, err
+	}
+
+	trx, err := s.BalanceRepo.InsertTransaction(conn, charge)
+	if err != nil {
+		return models.Transaction{}, models.Transaction{}, models.User{}, err
+	}
+
+	err = s.emitBalanceChanged(conn, user, trx)
+	if err != nil {
+		return models.Transaction{}, models.Transaction{}, models.User{}, err
+	}
+
+	income := models.UserBalanceUpdate{
+		UserID:      s.Config.FeeData.RevenueAccount,
+		Who:         who,
+		Description: fmt.Sprintf("fee for transaction %s from %s", trxUUID, payer),
+		Amount:      fee,
+		Currency:    currency,
+		Operation:   models.OperationFee,
+	}
+	revenue, err := s.BalanceRepo.UpdateAccount(conn, income)
+	if errors.Cause(err) == pgx.ErrNoRows {
+		revenue, err = s.BalanceRepo.CreateUser(conn, income)
+	}
+	if err != nil {
+		return models.Transaction{}, models.Transaction{}, models.User{}, err
+	}
+
+	incomeTrx, err := s.BalanceRepo.InsertTransaction(conn, income)
+	if err != nil {
+		return models.Transaction{}, models.Transaction{}, models.User{}, err
+	}
+
+	err = s.emitBalanceChanged(conn, revenue, incomeTrx)
+	if err != nil {
+		return models.Transaction{}, models.Transaction{}, models.User{}, err
+	}
+
+	return trx, incomeTrx, user, nil
+}
@@ -0,0 +1,130 @@
+package balance_services
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+type SpendingLimitsService struct {
+	Log        *zap.SugaredLogger
+	LimitsRepo interfaces.ISpendingLimitsRepo
+	DBHandler  interfaces.IDBHandler
+}
+
+func (s *SpendingLimitsService) GetLimits(subjectType string, subject string) (models.SpendingLimits, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.SpendingLimits{}, err
+	}
+	defer conn.Release()
+
+	limits, err := s.LimitsRepo.GetLimits(conn, subjectType, subject)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.SpendingLimits{}, er.ErrLimitsNotFound
+	case err != nil:
+		return models.SpendingLimits{}, err
+	}
+
+	return limits, nil
+}
+
+func (s *SpendingLimitsService) SetLimits(limits models.SpendingLimits) (models.SpendingLimits, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.SpendingLimits{}, err
+	}
+	defer conn.Release()
+
+	return s.LimitsRepo.SetLimits(conn, limits)
+}
+
+func (s *SpendingLimitsService) DeleteLimits(subjectType string, subject string) error {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	deleted, err := s.LimitsRepo.DeleteLimits(conn, subjectType, subject)
+	switch {
+	case err != nil:
+		return err
+	case !deleted:
+		return er.ErrLimitsNotFound
+	}
+
+	return nil
+}
+
+func (s *SpendingLimitsService) SetUserTier(req models.UserTier) error {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	updated, err := s.LimitsRepo.SetUserTier(conn, req)
+	switch {
+	case err != nil:
+		return err
+	case !updated:
+		return er.ErrNotFound
+	}
+
+	return nil
+}
+
+// checkSpendingLimits fails with *er.LimitExceededError when debiting amount
+// from the user would break one of their rules. Transfers are also counted
+// against the hourly transfer count.
+func checkSpendingLimits(repo interfaces.ISpendingLimitsRepo, conn *pgxpool.Conn, userUUID string, amount float64, transfer bool) error {
+	limits, err := repo.GetEffectiveLimits(conn, userUUID)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return er.ErrNotFound
+	case err != nil:
+		return err
+	}
+
+	if limits.MaxSingle == nil && limits.DailyTotal == nil && limits.MonthlyTotal == nil && limits.HourlyCount == nil {
+		return nil
+	}
+
+	if limits.MaxSingle != nil && amount > *limits.MaxSingle {
+		return &er.LimitExceededError{Rule: "max_single", Remaining: *limits.MaxSingle}
+	}
+
+	usage, err := repo.GetUsage(conn, userUUID)
+	if err != nil {
+		return err
+	}
+
+	if limits.DailyTotal != nil && usage.DailyTotal+amount > *limits.DailyTotal {
+		return &er.LimitExceededError{Rule: "daily_total", Remaining: remaining(*limits.DailyTotal, usage.DailyTotal)}
+	}
+
+	if limits.MonthlyTotal != nil && usage.MonthlyTotal+amount > *limits.MonthlyTotal {
+		return &er.LimitExceededError{Rule: "monthly_total", Remaining: remaining(*limits.MonthlyTotal, usage.MonthlyTotal)}
+	}
+
+	if transfer && limits.HourlyCount != nil && usage.HourlyCount >= *limits.HourlyCount {
+		return &er.LimitExceededError{Rule: "hourly_count", Remaining: 0}
+	}
+
+	return nil
+}
+
+func remaining(limit float64, used float64) float64 {
+	if used >= limit {
+		return 0
+	}
+
+	return limit - used
+}
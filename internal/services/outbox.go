@@ -0,0 +1,84 @@
+package balance_services
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"users_balance/internal/models"
+)
+
+// inTransaction runs fn in a database transaction opened on conn. Repository
+// calls made with conn inside fn take part in it. When fn fails its error is
+// returned, annotated with the rollback error if the rollback failed too.
+func inTransaction(conn *pgxpool.Conn, fn func() error) error {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Begin")
+	}
+
+	if err := fn(); err != nil {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+			return errors.Wrapf(err, "Rollback: %s", rollbackErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit tx")
+	}
+
+	return nil
+}
+
+// inSavepoint runs fn inside a savepoint of the transaction open on conn, a
+// failure of fn only undoes its own changes.
+func inSavepoint(conn *pgxpool.Conn, fn func() error) error {
+	ctx := context.Background()
+
+	if _, err := conn.Exec(ctx, "SAVEPOINT item"); err != nil {
+		return errors.Wrap(err, "Savepoint")
+	}
+
+	if err := fn(); err != nil {
+		if _, rollbackErr := conn.Exec(ctx, "ROLLBACK TO SAVEPOINT item"); rollbackErr != nil {
+			return errors.Wrapf(err, "Rollback to savepoint: %s", rollbackErr)
+		}
+		return err
+	}
+
+	if _, err := conn.Exec(ctx, "RELEASE SAVEPOINT item"); err != nil {
+		return errors.Wrap(err, "Release savepoint")
+	}
+
+	return nil
+}
+
+// emitEvent writes an event to the outbox and queues its webhook deliveries.
+// It must run in the transaction of the change it describes.
+func (s *UserBalanceService) emitEvent(conn *pgxpool.Conn, eventType string, key string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	event, err := s.OutboxRepo.InsertEvent(conn, models.Event{
+		Type:    eventType,
+		Key:     key,
+		Payload: data,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.WebhookRepo.EnqueueDeliveries(conn, event)
+}
+
+func (s *UserBalanceService) emitBalanceChanged(conn *pgxpool.Conn, user models.User, trx models.Transaction) error {
+	return s.emitEvent(conn, models.EventBalanceChanged, user.ID, models.BalanceChangedEvent{
+		User:        user,
+		Transaction: trx,
+	})
+}
@@ -0,0 +1,259 @@
+package balance_services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io"
+	"strconv"
+	"strings"
+	"users_balance/internal/config"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+// maxPayoutLineErrors bounds the validation report of a bad file.
+const maxPayoutLineErrors = 100
+
+type PayoutService struct {
+	Log                *zap.SugaredLogger
+	Config             *config.Config
+	PayoutRepo         interfaces.IPayoutRepo
+	UserBalanceService *UserBalanceService
+	DBHandler          interfaces.IDBHandler
+}
+
+// CreateJob validates a whole uuid,amount,description file and queues its rows.
+// Nothing is queued when a line is invalid.
+func (s *PayoutService) CreateJob(client string, file io.Reader) (models.PayoutJob, error) {
+	rows, err := s.parseFile(file)
+	if err != nil {
+		return models.PayoutJob{}, err
+	}
+
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.PayoutJob{}, err
+	}
+	defer conn.Release()
+
+	if !s.Config.AccountsData.AutoCreate {
+		if err := s.checkUsersExist(conn, rows); err != nil {
+			return models.PayoutJob{}, err
+		}
+	}
+
+	var job models.PayoutJob
+	err = inTransaction(conn, func() error {
+		job, err = s.PayoutRepo.CreateJob(conn, client)
+		if err != nil {
+			return err
+		}
+
+		return s.PayoutRepo.InsertRows(conn, job.ID, rows)
+	})
+	if err != nil {
+		return models.PayoutJob{}, err
+	}
+	job.TotalRows = int64(len(rows))
+
+	return job, nil
+}
+
+func (s *PayoutService) GetJob(id int64, client string) (models.PayoutJob, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.PayoutJob{}, err
+	}
+	defer conn.Release()
+
+	job, err := s.PayoutRepo.GetJob(conn, id, client)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.PayoutJob{}, er.ErrPayoutJobNotFound
+	case err != nil:
+		return models.PayoutJob{}, err
+	}
+
+	switch {
+	case job.Processed == 0:
+		job.Status = models.PayoutJobQueued
+	case job.Processed < job.TotalRows:
+		job.Status = models.PayoutJobRunning
+	default:
+		job.Status = models.PayoutJobCompleted
+	}
+
+	if job.Failed > 0 {
+		job.Failures, err = s.PayoutRepo.ListFailures(conn, id)
+		if err != nil {
+			return models.PayoutJob{}, err
+		}
+	}
+
+	return job, nil
+}
+
+// ProcessNext applies the next pending row through the UpdateAccount path. The
+// row is marked in the same transaction, so after a restart processing goes on
+// from the first row that was not committed. It returns false when no row is
+// pending.
+func (s *PayoutService) ProcessNext(ctx context.Context) (bool, error) {
+	conn, err := s.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	processed := false
+	var userID string
+	err = inTransaction(conn, func() error {
+		row, err := s.PayoutRepo.LockNextRow(conn)
+		switch {
+		case errors.Cause(err) == pgx.ErrNoRows:
+			return nil
+		case err != nil:
+			return err
+		}
+		processed = true
+		userID = row.UserID
+
+		description := row.Description
+		if description == "" {
+			description = fmt.Sprintf("payout job %d row %d", row.JobID, row.Row)
+		}
+
+		var resp models.UserBalanceUpdateResponse
+		err = inSavepoint(conn, func() error {
+			resp, err = s.UserBalanceService.updateAccount(conn, models.UserBalanceUpdate{
+				UserID:      row.UserID,
+				Who:         row.Client,
+				Description: description,
+				Amount:      row.Amount,
+				Currency:    models.RUB,
+			})
+			return err
+		})
+		if err != nil {
+			row.Status = models.PayoutRowFailed
+			row.Error = err.Error()
+		} else {
+			row.Status = models.PayoutRowApplied
+			row.TrxID = &resp.Transaction.TrxID
+		}
+
+		return s.PayoutRepo.FinishRow(conn, row)
+	})
+	if processed {
+		s.UserBalanceService.invalidateBalances(userID)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return processed, nil
+}
+
+// parseFile reads the rows of a payout file. The header line is optional and
+// the description column may be left out.
+func (s *PayoutService) parseFile(file io.Reader) ([]models.PayoutRow, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows []models.PayoutRow
+	var lineErrors []er.PayoutLineError
+	addError := func(row int, format string, args ...interface{}) {
+		if len(lineErrors) < maxPayoutLineErrors {
+			lineErrors = append(lineErrors, er.PayoutLineError{Row: row, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	for n, first := 0, true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &er.PayoutFileError{Lines: []er.PayoutLineError{{Row: n + 1, Message: err.Error()}}}
+		}
+
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "uuid") {
+			continue
+		}
+		n++
+
+		if len(rows) >= s.Config.PayoutData.MaxRows {
+			addError(n, "more than %d rows", s.Config.PayoutData.MaxRows)
+			break
+		}
+
+		if len(record) < 2 || len(record) > 3 {
+			addError(n, "expected uuid,amount,description, got %d fields", len(record))
+			continue
+		}
+
+		row := models.PayoutRow{Row: n, UserID: strings.TrimSpace(record[0]), Status: models.PayoutRowPending}
+		if _, err := uuid.Parse(row.UserID); err != nil {
+			addError(n, "bad uuid %q", row.UserID)
+			continue
+		}
+
+		row.Amount, err = strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil || row.Amount <= 0 {
+			addError(n, "amount must be a positive number, got %q", record[1])
+			continue
+		}
+
+		if len(record) == 3 {
+			row.Description = record[2]
+		}
+		rows = append(rows, row)
+	}
+
+	switch {
+	case len(lineErrors) > 0:
+		return nil, &er.PayoutFileError{Lines: lineErrors}
+	case len(rows) == 0:
+		return nil, &er.PayoutFileError{Lines: []er.PayoutLineError{{Message: "no rows"}}}
+	}
+
+	return rows, nil
+}
+
+// checkUsersExist reports the rows crediting uuids without an account.
+func (s *PayoutService) checkUsersExist(conn *pgxpool.Conn, rows []models.PayoutRow) error {
+	seen := map[string]bool{}
+	var uuids []string
+	for _, row := range rows {
+		if !seen[row.UserID] {
+			seen[row.UserID] = true
+			uuids = append(uuids, row.UserID)
+		}
+	}
+
+	missing, err := s.PayoutRepo.MissingUsers(conn, uuids)
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+
+	unknown := map[string]bool{}
+	for _, id := range missing {
+		unknown[strings.ToLower(id)] = true
+	}
+
+	var lineErrors []er.PayoutLineError
+	for _, row := range rows {
+		if unknown[strings.ToLower(row.UserID)] && len(lineErrors) < maxPayoutLineErrors {
+			lineErrors = append(lineErrors, er.PayoutLineError{Row: row.Row, Message: er.ErrNotFound.Error()})
+		}
+	}
+
+	return &er.PayoutFileError{Lines: lineErrors}
+}
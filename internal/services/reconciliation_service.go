@@ -0,0 +1,168 @@
+package balance_services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"math"
+	"time"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+// reconcileTolerance absorbs the float rounding of amounts that are already
+// rounded to cents when the chain is replayed.
+const reconcileTolerance = 0.005
+
+type ReconciliationService struct {
+	Log                *zap.SugaredLogger
+	ReconciliationRepo interfaces.IReconciliationRepo
+	BalanceRepo        interfaces.ICompanyDetailsRepo
+	DBHandler          interfaces.IDBHandler
+}
+
+// Reconcile compares every balance with the sum of the user's transactions, in
+// cents. Discrepancies are only reported unless fix is set, then each is closed
+// by a correction transaction of the difference: the ledger is brought in line
+// with the balance, no money moves. Balances that are wrong themselves are
+// fixed with a manual adjustment.
+func (s *ReconciliationService) Reconcile(ctx context.Context, fix bool) (models.ReconciliationReport, error) {
+	conn, err := s.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return models.ReconciliationReport{}, err
+	}
+	defer conn.Release()
+
+	report := models.ReconciliationReport{StartedAt: time.Now().UTC(), Fixed: fix}
+
+	discrepancies, err := s.ReconciliationRepo.FindDiscrepancies(conn)
+	if err != nil {
+		return models.ReconciliationReport{}, err
+	}
+
+	for i := range discrepancies {
+		if err := ctx.Err(); err != nil {
+			return models.ReconciliationReport{}, err
+		}
+
+		d := &discrepancies[i]
+		chain, err := s.ReconciliationRepo.UserChain(conn, d.UserID)
+		if err != nil {
+			return models.ReconciliationReport{}, err
+		}
+		d.FirstDivergentTransaction = firstDivergentTransaction(chain)
+
+		if fix {
+			if err := s.correct(conn, d); err != nil {
+				return models.ReconciliationReport{}, err
+			}
+		}
+	}
+
+	report.Discrepancies = discrepancies
+	report.FinishedAt = time.Now().UTC()
+
+	return report, nil
+}
+
+// correct writes the correction transaction of a discrepancy after checking
+// it still holds as reported, so concurrent runs do not correct twice. One
+// that changed since is reported as it is now and left alone.
+func (s *ReconciliationService) correct(conn *pgxpool.Conn, d *models.Discrepancy) error {
+	return inTransaction(conn, func() error {
+		current, err := s.ReconciliationRepo.LockUser(conn, d.UserID)
+		if err != nil {
+			return err
+		}
+		if current.Difference != d.Difference {
+			s.Log.Warnf("reconciliation :: %s changed from %.2f to %.2f since it was found, not corrected",
+				d.UserID, d.Difference, current.Difference)
+			d.Expected, d.Actual, d.Difference = current.Expected, current.Actual, current.Difference
+			return nil
+		}
+
+		trx, err := s.BalanceRepo.InsertTransaction(conn, models.UserBalanceUpdate{
+			UserID:      d.UserID,
+			Who:         "reconciliation",
+			Description: fmt.Sprintf("reconciliation correction, expected %.2f actual %.2f", current.Expected, current.Actual),
+			Amount:      current.Difference,
+			Currency:    models.RUB,
+			Operation:   models.OperationCorrection,
+		})
+		if err != nil {
+			return err
+		}
+		d.CorrectionTransaction = &trx.TrxID
+
+		return nil
+	})
+}
+
+// firstDivergentTransaction replays a user's audit chain. A balance change is
+// written before its transaction in the same database transaction, so after
+// every transaction link the balance must equal the running sum. The balance
+// of a hot account is its users row plus its shards, each chained on its own.
+// It returns the transaction that opened the current divergence, nil when the
+// chain does not cover it.
+func firstDivergentTransaction(chain []models.AuditChainEntry) *string {
+	var expected float64
+	var synced bool
+	var first *string
+	// balances holds the latest balance of the users row, under -1, and of
+	// every shard seen
+	balances := map[int]float64{}
+
+	for _, entry := range chain {
+		switch entry.Entity {
+		case "balance":
+			var change struct {
+				Shard *int     `json:"shard"`
+				Old   *float64 `json:"old"`
+				New   float64  `json:"new"`
+			}
+			if err := json.Unmarshal([]byte(entry.Payload), &change); err != nil {
+				continue
+			}
+			part := -1
+			if change.Shard != nil {
+				part = *change.Shard
+			}
+			// the chain may start after the account was opened, the first
+			// link of each part is its baseline
+			if _, seen := balances[part]; !seen && change.Old != nil {
+				expected += *change.Old
+			}
+			synced = true
+			balances[part] = change.New
+		case "transaction":
+			if !synced {
+				continue
+			}
+			var trx struct {
+				ID     string  `json:"trx_uuid"`
+				Amount float64 `json:"amount"`
+			}
+			if err := json.Unmarshal([]byte(entry.Payload), &trx); err != nil {
+				continue
+			}
+			expected += trx.Amount
+
+			var actual float64
+			for _, balance := range balances {
+				actual += balance
+			}
+
+			switch {
+			case math.Abs(actual-expected) <= reconcileTolerance:
+				first = nil
+			case first == nil:
+				id := trx.ID
+				first = &id
+			}
+		}
+	}
+
+	return first
+}
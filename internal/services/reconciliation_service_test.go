@@ -0,0 +1,63 @@
+package balance_services
+
+import (
+	"testing"
+	"users_balance/internal/models"
+)
+
+func balanceLink(payload string) models.AuditChainEntry {
+	return models.AuditChainEntry{Entity: "balance", Payload: payload}
+}
+
+func transactionLink(id string, amount string) models.AuditChainEntry {
+	return models.AuditChainEntry{Entity: "transaction", Payload: `{"trx_uuid":"` + id + `","amount":` + amount + `}`}
+}
+
+func TestFirstDivergentTransactionAddsShards(t *testing.T) {
+	chain := []models.AuditChainEntry{
+		balanceLink(`{"uuid":"u","old":null,"new":0}`),
+		balanceLink(`{"uuid":"u","old":0,"new":100}`),
+		transactionLink("t1", "100"),
+		// credits of two shards, interleaved
+		balanceLink(`{"uuid":"u","shard":0,"old":0,"new":10}`),
+		balanceLink(`{"uuid":"u","shard":1,"old":0,"new":20}`),
+		transactionLink("t2", "10"),
+		transactionLink("t3", "20"),
+		balanceLink(`{"uuid":"u","shard":0,"old":10,"new":15}`),
+		transactionLink("t4", "5"),
+	}
+
+	if first := firstDivergentTransaction(chain); first != nil {
+		t.Fatalf("reported %s, the chain adds up", *first)
+	}
+}
+
+func TestFirstDivergentTransactionFindsShardDivergence(t *testing.T) {
+	chain := []models.AuditChainEntry{
+		balanceLink(`{"uuid":"u","old":0,"new":100}`),
+		transactionLink("t1", "100"),
+		balanceLink(`{"uuid":"u","shard":3,"old":0,"new":10}`),
+		transactionLink("t2", "12"),
+		balanceLink(`{"uuid":"u","shard":3,"old":10,"new":20}`),
+		transactionLink("t3", "10"),
+	}
+
+	first := firstDivergentTransaction(chain)
+	if first == nil || *first != "t2" {
+		t.Fatalf("reported %v, want t2", first)
+	}
+}
+
+func TestFirstDivergentTransactionBaselinesEachPart(t *testing.T) {
+	// the chain starts after the account and its shards were credited
+	chain := []models.AuditChainEntry{
+		balanceLink(`{"uuid":"u","old":50,"new":60}`),
+		transactionLink("t1", "10"),
+		balanceLink(`{"uuid":"u","shard":2,"old":30,"new":35}`),
+		transactionLink("t2", "5"),
+	}
+
+	if first := firstDivergentTransaction(chain); first != nil {
+		t.Fatalf("reported %s, the chain adds up", *first)
+	}
+}
@@ -0,0 +1,385 @@
+package balance_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"time"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+const (
+	defaultRetryInterval = 3600
+	scheduleClaimBatch   = 100
+)
+
+type ScheduleService struct {
+	Log                *zap.SugaredLogger
+	ScheduleRepo       interfaces.IScheduleRepo
+	UserBalanceService interfaces.IUserBalanceService
+	DBHandler          interfaces.IDBHandler
+}
+
+func (s *ScheduleService) CreateSchedule(client string, req models.ScheduleRequest) (models.Schedule, error) {
+	schedule := models.Schedule{
+		Client:        client,
+		Kind:          req.Kind,
+		UserID:        req.UserID,
+		Amount:        req.Amount,
+		Description:   req.Description,
+		Recurrence:    req.Recurrence,
+		MaxRetries:    req.MaxRetries,
+		RetryInterval: req.RetryInterval,
+		OccurrenceAt:  req.FirstRunAt,
+	}
+
+	if req.Kind == models.ScheduleKindTransfer {
+		if req.To == "" || req.To == req.UserID || req.Amount <= 0 {
+			return models.Schedule{}, er.ErrBadRequest
+		}
+		schedule.To = &req.To
+	}
+
+	if req.Recurrence == models.RecurrenceMonthly {
+		day := req.DayOfMonth
+		if day == 0 {
+			day = req.FirstRunAt.Day()
+		}
+		schedule.DayOfMonth = &day
+	}
+
+	if schedule.RetryInterval == 0 {
+		schedule.RetryInterval = defaultRetryInterval
+	}
+
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.Schedule{}, err
+	}
+	defer conn.Release()
+
+	return s.ScheduleRepo.CreateSchedule(conn, schedule)
+}
+
+func (s *ScheduleService) GetSchedule(id string, client string) (models.Schedule, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.Schedule{}, err
+	}
+	defer conn.Release()
+
+	schedule, err := s.ScheduleRepo.GetSchedule(conn, id, client)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.Schedule{}, er.ErrScheduleNotFound
+	case err != nil:
+		return models.Schedule{}, err
+	}
+
+	return schedule, nil
+}
+
+func (s *ScheduleService) ListSchedules(client string) ([]models.Schedule, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	return s.ScheduleRepo.ListSchedules(conn, client)
+}
+
+func (s *ScheduleService) UpdateSchedule(id string, client string, upd models.ScheduleUpdate) (models.Schedule, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.Schedule{}, err
+	}
+	defer conn.Release()
+
+	schedule, err := s.ScheduleRepo.GetSchedule(conn, id, client)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.Schedule{}, er.ErrScheduleNotFound
+	case err != nil:
+		return models.Schedule{}, err
+	}
+
+	// the sign of an update decides the scope it was created with, a credit
+	// can not be turned into a charge
+	if upd.Amount != nil && (*upd.Amount > 0) != (schedule.Amount > 0) {
+		return models.Schedule{}, er.ErrBadRequest
+	}
+
+	schedule, err = s.ScheduleRepo.UpdateSchedule(conn, id, client, upd)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.Schedule{}, er.ErrScheduleState
+	case err != nil:
+		return models.Schedule{}, err
+	}
+
+	return schedule, nil
+}
+
+func (s *ScheduleService) CancelSchedule(id string, client string) (models.Schedule, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.Schedule{}, err
+	}
+	defer conn.Release()
+
+	schedule, err := s.ScheduleRepo.CancelSchedule(conn, id, client)
+	if errors.Cause(err) != pgx.ErrNoRows {
+		return schedule, err
+	}
+
+	_, err = s.ScheduleRepo.GetSchedule(conn, id, client)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.Schedule{}, er.ErrScheduleNotFound
+	case err != nil:
+		return models.Schedule{}, err
+	}
+
+	return models.Schedule{}, er.ErrScheduleState
+}
+
+// ListRuns returns the history of a schedule, latest run first.
+func (s *ScheduleService) ListRuns(id string, client string, limit int64, offset int64) ([]models.ScheduleRun, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	_, err = s.ScheduleRepo.GetSchedule(conn, id, client)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return nil, er.ErrScheduleNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return s.ScheduleRepo.ListRuns(conn, id, limit, offset)
+}
+
+// ReplayRun executes the occurrence of a failed run once more, by hand, and
+// returns the new run. The schedule itself is not moved. A run in an unknown
+// state may have moved money and is only replayed with force.
+func (s *ScheduleService) ReplayRun(id int64, force bool) (models.ScheduleRun, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.ScheduleRun{}, err
+	}
+	defer conn.Release()
+
+	run, err := s.ScheduleRepo.GetRun(conn, id)
+	switch {
+	case errors.Cause(err) == pgx.ErrNoRows:
+		return models.ScheduleRun{}, er.ErrRunNotFound
+	case err != nil:
+		return models.ScheduleRun{}, err
+	case run.Status != models.RunFailed && !(force && run.Status == models.RunUnknown):
+		return models.ScheduleRun{}, er.ErrRunNotReplayable
+	}
+
+	schedule, err := s.ScheduleRepo.GetRunSchedule(conn, run)
+	if err != nil {
+		return models.ScheduleRun{}, err
+	}
+
+	replay, err := s.ScheduleRepo.StartReplay(conn, run)
+	pgErr, isPgErr := errors.Cause(err).(*pgconn.PgError)
+	switch {
+	case isPgErr && pgErr.Code == pgUniqueViolation:
+		return models.ScheduleRun{}, er.ErrRunReplayed
+	case err != nil:
+		return models.ScheduleRun{}, err
+	}
+
+	replay.Status = models.RunSucceeded
+	replay.TrxID, err = s.execute(schedule)
+	if err != nil {
+		replay.Status = models.RunFailed
+		reason := err.Error()
+		replay.Error = &reason
+	}
+
+	return s.ScheduleRepo.FinishReplay(conn, replay)
+}
+
+// RunDue executes the schedules that are due and returns how many ran. It must
+// only be called by the scheduler leader: schedules still marked running
+// belong to a leader that stopped mid-run and are closed first as unknown,
+// without running them again, since the money may have moved.
+func (s *ScheduleService) RunDue(ctx context.Context) (int, error) {
+	conn, err := s.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	interrupted, err := s.ScheduleRepo.ListInterrupted(conn)
+	if err != nil {
+		return 0, err
+	}
+	for _, schedule := range interrupted {
+		s.Log.Warnf("schedules :: run of %s was interrupted, not retrying it", schedule.ID)
+		run := models.ScheduleRun{ScheduleID: schedule.ID, Status: models.RunUnknown}
+		reason := "the scheduler stopped during the run"
+		run.Error = &reason
+		if err := s.finishRun(conn, run, advanceSchedule(schedule, false, time.Now())); err != nil {
+			return 0, err
+		}
+	}
+
+	// schedules are claimed one at a time, so one left marked running can
+	// only be the one whose run was cut short
+	for ran := 0; ran < scheduleClaimBatch; ran++ {
+		if err := ctx.Err(); err != nil {
+			return ran, err
+		}
+
+		schedule, err := s.ScheduleRepo.ClaimNextDue(conn)
+		switch {
+		case errors.Cause(err) == pgx.ErrNoRows:
+			return ran, nil
+		case err != nil:
+			return ran, err
+		}
+
+		if err := s.runSchedule(conn, schedule); err != nil {
+			return ran, err
+		}
+	}
+
+	return scheduleClaimBatch, nil
+}
+
+// runSchedule records the start of the run before moving money, so a crash in
+// between never runs an occurrence twice.
+func (s *ScheduleService) runSchedule(conn *pgxpool.Conn, schedule models.Schedule) error {
+	run, err := s.ScheduleRepo.StartRun(conn, schedule)
+	if err != nil {
+		return err
+	}
+
+	trxID, err := s.execute(schedule)
+	now := time.Now()
+
+	switch {
+	case err == nil:
+		run.Status = models.RunSucceeded
+		run.TrxID = trxID
+		schedule = advanceSchedule(schedule, true, now)
+	case isInsufficientFunds(err) && schedule.Attempt < schedule.MaxRetries:
+		run.Status = models.RunRetrying
+		schedule.Attempt++
+		next := now.Add(time.Duration(schedule.RetryInterval) * time.Second)
+		schedule.NextRunAt = &next
+	default:
+		run.Status = models.RunFailed
+		schedule = advanceSchedule(schedule, false, now)
+	}
+	if err != nil {
+		reason := err.Error()
+		run.Error = &reason
+	}
+
+	return s.finishRun(conn, run, schedule)
+}
+
+func (s *ScheduleService) execute(schedule models.Schedule) (*string, error) {
+	description := schedule.Description
+	if description == "" {
+		description = fmt.Sprintf("schedule %s", schedule.ID)
+	}
+
+	switch schedule.Kind {
+	case models.ScheduleKindTransfer:
+		resp, err := s.UserBalanceService.Transfer(models.Transfer{
+			From:        schedule.UserID,
+			To:          *schedule.To,
+			Amount:      schedule.Amount,
+			Who:         schedule.Client,
+			Description: description,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &resp.TransactionID, nil
+	default:
+		resp, err := s.UserBalanceService.UpdateAccount(models.UserBalanceUpdate{
+			UserID:      schedule.UserID,
+			Who:         schedule.Client,
+			Description: description,
+			Amount:      schedule.Amount,
+			Currency:    models.RUB,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &resp.Transaction.TrxID, nil
+	}
+}
+
+func (s *ScheduleService) finishRun(conn *pgxpool.Conn, run models.ScheduleRun, schedule models.Schedule) error {
+	return inTransaction(conn, func() error {
+		return s.ScheduleRepo.FinishRun(conn, run, schedule)
+	})
+}
+
+func isInsufficientFunds(err error) bool {
+	cause := errors.Cause(err)
+	return cause == er.ErrInsufficientFunds || cause == er.ErrNegativeBalance
+}
+
+// advanceSchedule moves a schedule to its next occurrence after now, a one-off
+// schedule ends instead.
+func advanceSchedule(schedule models.Schedule, succeeded bool, now time.Time) models.Schedule {
+	schedule.Attempt = 0
+
+	if schedule.Recurrence == models.RecurrenceOnce {
+		schedule.Status = models.ScheduleCompleted
+		if !succeeded {
+			schedule.Status = models.ScheduleFailed
+		}
+		schedule.NextRunAt = nil
+		return schedule
+	}
+
+	next := schedule.OccurrenceAt
+	for !next.After(now) {
+		switch schedule.Recurrence {
+		case models.RecurrenceDaily:
+			next = next.AddDate(0, 0, 1)
+		case models.RecurrenceWeekly:
+			next = next.AddDate(0, 0, 7)
+		default:
+			next = nextMonth(next, *schedule.DayOfMonth)
+		}
+	}
+
+	schedule.Status = models.ScheduleActive
+	schedule.OccurrenceAt = next
+	schedule.NextRunAt = &next
+
+	return schedule
+}
+
+// nextMonth returns day of the month after t, or the last day of that month
+// when it is shorter, at the same time of day.
+func nextMonth(t time.Time, day int) time.Time {
+	first := time.Date(t.Year(), t.Month()+1, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+
+	return first.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,135 @@
+package balance_services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"go.uber.org/zap"
+	"strings"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+	"users_balance/internal/webhooks"
+)
+
+type WebhookService struct {
+	Log         *zap.SugaredLogger
+	WebhookRepo interfaces.IWebhookRepo
+	DBHandler   interfaces.IDBHandler
+	// AllowPrivateTargets accepts endpoints on private addresses
+	AllowPrivateTargets bool
+}
+
+// CreateSubscription subscribes an endpoint of the client to the events of the
+// accounts it may see, all of them when accounts is empty.
+func (s *WebhookService) CreateSubscription(clientID string, accounts []string, req models.WebhookSubscriptionRequest) (models.WebhookSubscription, error) {
+	if !s.AllowPrivateTargets {
+		if err := webhooks.CheckURL(context.Background(), req.URL); err != nil {
+			return models.WebhookSubscription{}, err
+		}
+	}
+
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.WebhookSubscription{}, err
+	}
+	defer conn.Release()
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return models.WebhookSubscription{}, err
+	}
+
+	eventTypes := req.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	lowered := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		lowered = append(lowered, strings.ToLower(account))
+	}
+
+	return s.WebhookRepo.CreateSubscription(conn, models.WebhookSubscription{
+		ClientID:   clientID,
+		URL:        req.URL,
+		Secret:     secret,
+		EventTypes: eventTypes,
+		Accounts:   lowered,
+	})
+}
+
+func (s *WebhookService) ListSubscriptions(clientID string) (models.WebhookSubscriptionsResponse, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.WebhookSubscriptionsResponse{}, err
+	}
+	defer conn.Release()
+
+	subs, err := s.WebhookRepo.ListSubscriptions(conn, clientID)
+	if err != nil {
+		return models.WebhookSubscriptionsResponse{}, err
+	}
+
+	return models.WebhookSubscriptionsResponse{Subscriptions: subs}, nil
+}
+
+func (s *WebhookService) DeleteSubscription(clientID string, id string) error {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	deleted, err := s.WebhookRepo.DeleteSubscription(conn, clientID, id)
+	switch {
+	case err != nil:
+		return err
+	case !deleted:
+		return er.ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+func (s *WebhookService) ListDeliveries(clientID string, req models.WebhookDeliveriesRequest) (models.WebhookDeliveriesResponse, error) {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return models.WebhookDeliveriesResponse{}, err
+	}
+	defer conn.Release()
+
+	deliveries, err := s.WebhookRepo.ListDeliveries(conn, clientID, req)
+	if err != nil {
+		return models.WebhookDeliveriesResponse{}, err
+	}
+
+	return models.WebhookDeliveriesResponse{Deliveries: deliveries}, nil
+}
+
+func (s *WebhookService) ReplayDelivery(clientID string, deliveryID int64) error {
+	conn, err := s.DBHandler.AcquireConn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	replayed, err := s.WebhookRepo.ReplayDelivery(conn, clientID, deliveryID)
+	switch {
+	case err != nil:
+		return err
+	case !replayed:
+		return er.ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,67 @@
+package snapshots
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+	"users_balance/internal/interfaces"
+)
+
+// Job snapshots balances so point-in-time queries only sum the transactions
+// made after the closest snapshot. Transactions are stamped before they
+// commit, so snapshots are taken Lag in the past to let most of the ones still
+// in flight commit first. One committing later than that would be missing from
+// a snapshot, so every run first re-verifies the snapshots of the last Verify
+// against the ledger and drops those that no longer add up.
+type Job struct {
+	Log          *zap.SugaredLogger
+	DBHandler    interfaces.IDBHandler
+	SnapshotRepo interfaces.ISnapshotRepo
+	Interval     time.Duration
+	Lag          time.Duration
+	Verify       time.Duration
+}
+
+// Run takes snapshots every Interval until ctx is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.takeSnapshots(ctx); err != nil {
+			j.Log.Warnf("balance snapshots :: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *Job) takeSnapshots(ctx context.Context) error {
+	conn, err := j.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	now := time.Now()
+	dropped, err := j.SnapshotRepo.DropStaleSnapshots(conn, now.Add(-j.Verify))
+	if err != nil {
+		return err
+	}
+	if dropped > 0 {
+		j.Log.Warnf("balance snapshots :: %d missed late transactions, dropped to be taken again", dropped)
+	}
+
+	at := now.Add(-j.Lag)
+	n, err := j.SnapshotRepo.TakeSnapshots(conn, at)
+	if err != nil {
+		return err
+	}
+
+	j.Log.Infof("balance snapshots :: %d taken at %s", n, at.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,54 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"users_balance/internal/models"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	timeLayout = "15:04:05"
+)
+
+var csvHeader = []string{"date", "time", "transaction_id", "operation", "description", "amount", "balance"}
+
+// WriteCSV renders a statement as CSV. The opening balance, the totals and the
+// closing balance are rows of their own, with the operation column naming them.
+func WriteCSV(w io.Writer, s models.Statement) error {
+	from := s.From.Format(dateLayout)
+	to := s.To.Format(dateLayout)
+
+	rows := [][]string{
+		csvHeader,
+		{from, "", "", "opening_balance", "", "", formatAmount(s.OpeningBalance)},
+	}
+	for _, line := range s.Lines {
+		rows = append(rows, []string{
+			line.CreatedAt.Format(dateLayout),
+			line.CreatedAt.Format(timeLayout),
+			line.TrxID,
+			line.Operation,
+			line.Description,
+			formatAmount(line.Amount),
+			formatAmount(line.Balance),
+		})
+	}
+	rows = append(rows,
+		[]string{to, "", "", "total_credits", "", formatAmount(s.TotalCredits), ""},
+		[]string{to, "", "", "total_debits", "", formatAmount(s.TotalDebits), ""},
+		[]string{to, "", "", "closing_balance", "", "", formatAmount(s.ClosingBalance)},
+	)
+
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+
+	return cw.Error()
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
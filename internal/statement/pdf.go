@@ -0,0 +1,206 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+	"users_balance/internal/models"
+)
+
+// A4 in points
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 40
+	leading    = 1.4
+)
+
+// fonts are the standard 14 PDF fonts, viewers provide them so nothing is
+// embedded. They only cover Latin-1, other characters are printed as '?'.
+var fonts = []string{"Helvetica", "Helvetica-Bold", "Courier", "Courier-Bold"}
+
+const (
+	fontRegular  = "F1"
+	fontBold     = "F2"
+	fontMono     = "F3"
+	fontMonoBold = "F4"
+)
+
+// table columns, in characters of the monospace font
+var columns = []struct {
+	title string
+	width int
+	right bool
+}{
+	{"Date", 10, false},
+	{"Time", 8, false},
+	{"Description", 28, false},
+	{"Operation", 12, false},
+	{"Amount", 12, true},
+	{"Balance", 12, true},
+}
+
+// WritePDF renders a statement as a PDF document.
+func WritePDF(w io.Writer, s models.Statement) error {
+	doc := &pdfDocument{}
+	doc.addPage()
+
+	doc.text(fontBold, 16, "Account statement")
+	doc.skip(8)
+	doc.text(fontRegular, 10, "Account: "+s.UserID)
+	doc.text(fontRegular, 10, fmt.Sprintf("Period: %s - %s (%s)", s.From.Format(dateLayout), s.To.Format(dateLayout),
+		s.From.Location()))
+	doc.text(fontRegular, 10, "Generated: "+s.GeneratedAt.Format("2006-01-02 15:04:05 MST"))
+	doc.skip(8)
+	doc.text(fontRegular, 10, fmt.Sprintf("Opening balance: %s %s", formatAmount(s.OpeningBalance), s.Currency))
+	doc.text(fontRegular, 10, fmt.Sprintf("Total credits: %s %s", formatAmount(s.TotalCredits), s.Currency))
+	doc.text(fontRegular, 10, fmt.Sprintf("Total debits: %s %s", formatAmount(s.TotalDebits), s.Currency))
+	doc.text(fontBold, 10, fmt.Sprintf("Closing balance: %s %s", formatAmount(s.ClosingBalance), s.Currency))
+	doc.skip(12)
+
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.title
+	}
+	doc.text(fontMonoBold, 9, tableRow(header))
+
+	if len(s.Lines) == 0 {
+		doc.text(fontRegular, 9, "No transactions in this period.")
+	}
+
+	for _, line := range s.Lines {
+		if doc.full() {
+			doc.addPage()
+			doc.text(fontMonoBold, 9, tableRow(header))
+		}
+		doc.text(fontMono, 9, tableRow([]string{
+			line.CreatedAt.Format(dateLayout),
+			line.CreatedAt.Format(timeLayout),
+			line.Description,
+			line.Operation,
+			formatAmount(line.Amount),
+			formatAmount(line.Balance),
+		}))
+	}
+
+	_, err := w.Write(doc.bytes())
+	return err
+}
+
+func tableRow(cells []string) string {
+	var b strings.Builder
+	for i, col := range columns {
+		cell := []rune(cells[i])
+		if len(cell) > col.width {
+			cell = append(cell[:col.width-1], '~')
+		}
+		pad := strings.Repeat(" ", col.width-len(cell))
+		if col.right {
+			b.WriteString(pad + string(cell))
+		} else {
+			b.WriteString(string(cell) + pad)
+		}
+		b.WriteString(" ")
+	}
+
+	return strings.TrimRight(b.String(), " ")
+}
+
+// pdfDocument lays out lines of text top to bottom, starting a new page when
+// one is full.
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (d *pdfDocument) addPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - margin
+}
+
+func (d *pdfDocument) full() bool {
+	return d.y < margin+20
+}
+
+func (d *pdfDocument) skip(points float64) {
+	d.y -= points
+}
+
+func (d *pdfDocument) text(font string, size float64, s string) {
+	d.y -= size * leading
+	d.write(d.pages[len(d.pages)-1], font, size, margin, d.y, s)
+}
+
+func (d *pdfDocument) write(page *bytes.Buffer, font string, size float64, x float64, y float64, s string) {
+	fmt.Fprintf(page, "BT /%s %.0f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(s))
+}
+
+// bytes assembles the catalog, the page tree, the fonts, the pages and their
+// content streams, then the cross-reference table.
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// objects 1 and 2, fonts from 3, then a page and its stream per page
+	firstPage := 3 + len(fonts)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	var fontRefs strings.Builder
+	for i, name := range fonts {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fmt.Fprintf(&fontRefs, "/F%d %d 0 R ", i+1, 3+i)
+	}
+
+	for i, page := range d.pages {
+		d.write(page, fontRegular, 8, margin, margin/2, fmt.Sprintf("Page %d of %d", i+1, len(d.pages)))
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRefs.String(), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// escape encodes s for a literal string in Latin-1, which matches
+// WinAnsiEncoding for printable characters.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == utf8.RuneError || (r >= 0x7f && r < 0xa0) || r > 0xff:
+			b.WriteByte('?')
+		case r >= 0x80:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+const (
+	channel = "balance_changed"
+	// subscriberBuffer events wait for a slow client before newer ones are
+	// dropped for it
+	subscriberBuffer = 16
+	retryInterval    = time.Second
+)
+
+// Hub listens for the balance changes of every replica, announced by a
+// trigger on the outbox, and hands them to the subscribers of the user.
+type Hub struct {
+	Log        *zap.SugaredLogger
+	DBHandler  interfaces.IDBHandler
+	OutboxRepo interfaces.IOutboxRepo
+	// BalanceCache, when set, drops the balances changed by any replica
+	BalanceCache interfaces.IBalanceCache
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan models.BalanceChangedEvent]struct{}
+}
+
+func NewHub(log *zap.SugaredLogger, db interfaces.IDBHandler, outboxRepo interfaces.IOutboxRepo) *Hub {
+	return &Hub{
+		Log:         log,
+		DBHandler:   db,
+		OutboxRepo:  outboxRepo,
+		subscribers: map[string]map[chan models.BalanceChangedEvent]struct{}{},
+	}
+}
+
+// Subscribe returns the balance changes of a user until cancel is called.
+func (h *Hub) Subscribe(uuid string) (<-chan models.BalanceChangedEvent, func()) {
+	ch := make(chan models.BalanceChangedEvent, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[uuid] == nil {
+		h.subscribers[uuid] = map[chan models.BalanceChangedEvent]struct{}{}
+	}
+	h.subscribers[uuid][ch] = struct{}{}
+	h.mu.Unlock()
+
+	cancel := func() {
+		h.mu.Lock()
+		delete(h.subscribers[uuid], ch)
+		if len(h.subscribers[uuid]) == 0 {
+			delete(h.subscribers, uuid)
+		}
+		h.mu.Unlock()
+	}
+
+	return ch, cancel
+}
+
+// Run listens until ctx is cancelled, reconnecting when the connection is
+// lost. Changes made while it reconnects are not streamed.
+func (h *Hub) Run(ctx context.Context) {
+	for {
+		if err := h.listen(ctx); err != nil && ctx.Err() == nil {
+			h.Log.Warnf("balance stream :: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (h *Hub) listen(ctx context.Context) error {
+	conn, err := h.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "UNLISTEN "+channel)
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var ref struct {
+			ID  int64  `json:"id"`
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal([]byte(notification.Payload), &ref); err != nil {
+			h.Log.Warnf("balance stream :: bad notification %q", notification.Payload)
+			continue
+		}
+		if h.BalanceCache != nil {
+			if err := h.BalanceCache.Invalidate(ctx, ref.Key); err != nil {
+				h.Log.Warnf("balance stream :: invalidate %s :: %s", ref.Key, err)
+			}
+		}
+		if !h.watched(ref.Key) {
+			continue
+		}
+
+		event, err := h.OutboxRepo.GetEvent(conn, ref.ID)
+		if err != nil {
+			return err
+		}
+
+		var change models.BalanceChangedEvent
+		if err := json.Unmarshal(event.Payload, &change); err != nil {
+			h.Log.Warnf("balance stream :: bad event %d: %s", event.ID, err)
+			continue
+		}
+		h.publish(ref.Key, change)
+	}
+}
+
+func (h *Hub) watched(uuid string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers[uuid]) > 0
+}
+
+func (h *Hub) publish(uuid string, change models.BalanceChangedEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[uuid] {
+		select {
+		case ch <- change:
+		default:
+			h.Log.Warnf("balance stream :: subscriber of %s is too slow, change dropped", uuid)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+	"users_balance/internal/config"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/models"
+)
+
+const (
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+
+	batchSize = 20
+	// leaseMargin is added to the time a batch may take at most to send
+	leaseMargin = time.Minute
+)
+
+// Dispatcher POSTs due webhook deliveries. Failed attempts are retried with
+// exponential backoff until MaxAttempts, after which the delivery is dead and
+// only a replay sends it again.
+type Dispatcher struct {
+	Log         *zap.SugaredLogger
+	DBHandler   interfaces.IDBHandler
+	WebhookRepo interfaces.IWebhookRepo
+	Client      *http.Client
+	Config      config.WebhookData
+}
+
+// Run polls for due deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := d.dispatchBatch(ctx)
+			if err != nil {
+				d.Log.Warnf("webhooks :: %s", err)
+				break
+			}
+			if n < batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// attempt is the outcome of sending a delivery, statusCode is 0 when no
+// response came.
+type attempt struct {
+	delivery   models.DueWebhookDelivery
+	statusCode int
+	err        error
+}
+
+// dispatchBatch leases a batch of due deliveries, sends them with no
+// transaction open and records the outcomes in a short one. Deliveries left
+// unrecorded, by a crash or a stop, are sent again once their lease expires.
+func (d *Dispatcher) dispatchBatch(ctx context.Context) (int, error) {
+	due, err := d.claimDue(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	attempts := make([]attempt, 0, len(due))
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		statusCode, sendErr := d.send(ctx, delivery)
+		attempts = append(attempts, attempt{delivery: delivery, statusCode: statusCode, err: sendErr})
+	}
+
+	// outcomes of sent deliveries are kept even when stopping
+	if err := d.record(context.Background(), attempts); err != nil {
+		return 0, err
+	}
+
+	return len(due), nil
+}
+
+// claimDue leases due deliveries for long enough to send all of them.
+func (d *Dispatcher) claimDue(ctx context.Context) ([]models.DueWebhookDelivery, error) {
+	conn, err := d.DBHandler.AcquireConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	return d.WebhookRepo.ClaimDue(conn, batchSize, batchSize*d.Config.Timeout+leaseMargin)
+}
+
+func (d *Dispatcher) record(ctx context.Context, attempts []attempt) (err error) {
+	if len(attempts) == 0 {
+		return nil
+	}
+
+	tx, err := d.DBHandler.StartTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = d.DBHandler.FinishTransaction(ctx, tx, err)
+	}()
+
+	for _, a := range attempts {
+		if a.err == nil {
+			if err := d.WebhookRepo.MarkDelivered(tx, a.delivery.ID, a.statusCode); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var code *int
+		if a.statusCode != 0 {
+			code = &a.statusCode
+		}
+		attempts := a.delivery.Attempts + 1
+		dead := attempts >= d.Config.MaxAttempts
+		next := time.Now().Add(d.backoff(attempts))
+
+		if err := d.WebhookRepo.MarkFailed(tx, a.delivery.ID, code, a.err.Error(), next, dead); err != nil {
+			return err
+		}
+		if dead {
+			d.Log.Warnf("webhooks :: delivery %d dead after %d attempts :: %s", a.delivery.ID, attempts, a.err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery models.DueWebhookDelivery) (int, error) {
+	body, err := json.Marshal(models.WebhookPayload{
+		DeliveryID: delivery.ID,
+		EventID:    delivery.EventID,
+		Type:       delivery.EventType,
+		Data:       delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.Config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "v1="+Sign(delivery.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff doubles the base delay with every attempt, up to MaxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.Config.BaseBackoff
+	for i := 1; i < attempts && delay < d.Config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.Config.MaxBackoff {
+		delay = d.Config.MaxBackoff
+	}
+
+	return delay
+}
+
+// Sign is the hex HMAC-SHA256 of "<timestamp>.<body>" under the subscription
+// secret. Receivers recompute it and reject stale timestamps.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+	er "users_balance/internal/errors"
+)
+
+// blockedNets are the ranges of addresses that are not the internet, beyond
+// the loopback, private, link-local and unspecified ones net.IP reports.
+var blockedNets = parseCIDRs(
+	"0.0.0.0/8",     // this network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"240.0.0.0/4",   // reserved
+	"64:ff9b::/96",  // NAT64, may reach IPv4 ranges above
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets
+}
+
+// IsPublic tells whether ip is an internet address webhooks may be sent to,
+// not one of the service's own network or host.
+func IsPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckURL rejects subscription URLs that are not http(s) or whose host is or
+// resolves to an address that is not public. The dispatcher checks the address
+// again when it connects, the host may resolve differently by then.
+func CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return er.ErrWebhookURL
+	}
+
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if !IsPublic(ip) {
+			return er.ErrWebhookTarget
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return er.ErrWebhookURL
+	}
+	for _, addr := range addrs {
+		if !IsPublic(addr.IP) {
+			return er.ErrWebhookTarget
+		}
+	}
+
+	return nil
+}
+
+// NewClient returns the client deliveries are sent with. It only connects to
+// public addresses unless allowPrivate is set, which is meant for local
+// development, and goes through no proxy.
+func NewClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = dialPublic
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Transport: transport}
+}
+
+// dialPublic runs after the address is resolved and before connecting, it
+// refuses addresses that are not public.
+func dialPublic(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !IsPublic(ip) {
+		return er.ErrWebhookTarget
+	}
+
+	return nil
+}
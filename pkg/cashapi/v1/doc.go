@@ -0,0 +1,16 @@
+// Package cashapi is the Go client of the /cash/v1 API, generated from the
+// OpenAPI spec in api/openapi. The import path carries the API version, a
+// breaking version of the API gets a new package. pkg/cashclient adds
+// retries, idempotency keys and typed errors on top of it.
+//
+//	client, err := cashapi.NewClientWithResponses("https://cash.example.com/cash/v1",
+//		cashapi.WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
+//			req.Header.Set("X-Api-Key", key)
+//			return nil
+//		}))
+package cashapi
+
+//go:generate go run github.com/deepmap/oapi-codegen/cmd/oapi-codegen@v1.8.2 -generate types,client -package cashapi -o cashapi.gen.go ../../../api/openapi/openapi.json
+
+// SpecVersion is the info.version of the spec the client was generated from.
+const SpecVersion = "1.0.0"
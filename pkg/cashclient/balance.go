@@ -0,0 +1,142 @@
+package cashclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+	cashapi "users_balance/pkg/cashapi/v1"
+)
+
+type (
+	Balance        = cashapi.User
+	Transaction    = cashapi.Transaction
+	FeeQuote       = cashapi.FeeQuote
+	UpdateResult   = cashapi.UserBalanceUpdateResponse
+	TransferResult = cashapi.TransferResponse
+)
+
+// RUB is the currency of the ledger, updates in other currencies are
+// converted to it.
+const RUB = "RUB"
+
+var errNotPositive = errors.New("cashclient: amount must be positive")
+
+// BalanceOption changes what GetBalance returns.
+type BalanceOption func(*cashapi.GetBalanceParams)
+
+// InCurrency converts the balance to currency.
+func InCurrency(currency string) BalanceOption {
+	return func(params *cashapi.GetBalanceParams) {
+		params.Currency = &currency
+	}
+}
+
+// At returns the balance the wallet had at that moment.
+func At(at time.Time) BalanceOption {
+	return func(params *cashapi.GetBalanceParams) {
+		params.At = &at
+	}
+}
+
+func (c *Client) GetBalance(ctx context.Context, uuid string, opts ...BalanceOption) (Balance, error) {
+	params := &cashapi.GetBalanceParams{Uuid: uuid}
+	for _, opt := range opts {
+		opt(params)
+	}
+
+	var balance Balance
+	err := c.do(ctx, func() (*http.Response, error) {
+		return c.api.GetBalance(ctx, params)
+	}, &balance)
+
+	return balance, err
+}
+
+// Update credits or debits a wallet. Amount is positive for both, Currency
+// is RUB when empty. IdempotencyKey is generated when empty, set it to make a
+// call that is repeated by the caller, e.g. after a restart, apply once.
+type Update struct {
+	UUID           string
+	Amount         float64
+	Currency       string
+	Description    string
+	DryRun         bool
+	IdempotencyKey string
+}
+
+// Credit adds the amount to the wallet.
+func (c *Client) Credit(ctx context.Context, update Update) (UpdateResult, error) {
+	return c.update(ctx, update, update.Amount)
+}
+
+// Debit takes the amount from the wallet, failing with ErrInsufficientFunds
+// when the balance is too low.
+func (c *Client) Debit(ctx context.Context, update Update) (UpdateResult, error) {
+	return c.update(ctx, update, -update.Amount)
+}
+
+func (c *Client) update(ctx context.Context, update Update, amount float64) (UpdateResult, error) {
+	if update.Amount <= 0 {
+		return UpdateResult{}, errNotPositive
+	}
+	if update.Currency == "" {
+		update.Currency = RUB
+	}
+
+	body := cashapi.UpdateBalanceJSONRequestBody{
+		Uuid:        update.UUID,
+		Amount:      amount,
+		Currency:    update.Currency,
+		Description: &update.Description,
+		DryRun:      &update.DryRun,
+	}
+	params := &cashapi.UpdateBalanceParams{IdempotencyKey: c.idempotencyKey(update.IdempotencyKey)}
+
+	var result UpdateResult
+	err := c.do(ctx, func() (*http.Response, error) {
+		return c.api.UpdateBalance(ctx, params, body)
+	}, &result)
+
+	return result, err
+}
+
+// Transfer moves Amount from one wallet to another, see Update for
+// IdempotencyKey.
+type Transfer struct {
+	From           string
+	To             string
+	Amount         float64
+	DryRun         bool
+	IdempotencyKey string
+}
+
+func (c *Client) Transfer(ctx context.Context, transfer Transfer) (TransferResult, error) {
+	if transfer.Amount <= 0 {
+		return TransferResult{}, errNotPositive
+	}
+
+	body := cashapi.TransferFundsJSONRequestBody{
+		From:   transfer.From,
+		To:     transfer.To,
+		Amount: transfer.Amount,
+		DryRun: &transfer.DryRun,
+	}
+	params := &cashapi.TransferFundsParams{IdempotencyKey: c.idempotencyKey(transfer.IdempotencyKey)}
+
+	var result TransferResult
+	err := c.do(ctx, func() (*http.Response, error) {
+		return c.api.TransferFunds(ctx, params, body)
+	}, &result)
+
+	return result, err
+}
+
+func (c *Client) idempotencyKey(key string) *cashapi.IdempotencyKey {
+	if key == "" {
+		key = c.newKey()
+	}
+	k := cashapi.IdempotencyKey(key)
+
+	return &k
+}
@@ -0,0 +1,204 @@
+// Package cashclient is the Go SDK of the /cash/v1 API. It wraps the client
+// generated in pkg/cashapi/v1 with typed methods, retries and typed errors.
+//
+//	client, err := cashclient.New("https://cash.example.com/cash/v1", cashclient.WithAPIKey(key))
+//	if err != nil {
+//		return err
+//	}
+//	res, err := client.Debit(ctx, cashclient.Update{UUID: wallet, Amount: 150, Description: "order 42"})
+//	if errors.Is(err, cashclient.ErrInsufficientFunds) {
+//		...
+//	}
+//
+// Writes are sent with an Idempotency-Key, generated unless given, so a write
+// retried after a timeout or a 503 is applied once.
+package cashclient
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+	cashapi "users_balance/pkg/cashapi/v1"
+)
+
+// Client calls the cash API. It is safe for concurrent use.
+type Client struct {
+	api       *cashapi.Client
+	retry     RetryPolicy
+	newKey    func() string
+	apiOpts   []cashapi.ClientOption
+	userAgent string
+}
+
+// RetryPolicy sets how failed calls are retried. A call is made at most
+// MaxAttempts times, waiting a random time up to MinBackoff doubled after each
+// attempt, capped at MaxBackoff. A Retry-After sent by the server is honoured
+// when it is longer.
+//
+// Only failures that can not have been applied, or that the Idempotency-Key
+// makes safe to repeat, are retried: network errors, 429, 502, 503, 504 and a
+// 409 for a key whose first request is still in progress.
+type RetryPolicy struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  200 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+type Option func(*Client)
+
+// WithAPIKey authenticates as an API client.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiOpts = append(c.apiOpts, withHeader("X-Api-Key", key))
+	}
+}
+
+// WithBearerToken authenticates with an end-user JWT.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.apiOpts = append(c.apiOpts, withHeader("Authorization", "Bearer "+token))
+	}
+}
+
+// WithHTTPClient sends the requests with doer instead of a default
+// http.Client. Timeouts are better set with the context of each call.
+func WithHTTPClient(doer cashapi.HttpRequestDoer) Option {
+	return func(c *Client) {
+		c.apiOpts = append(c.apiOpts, cashapi.WithHTTPClient(doer))
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy, MaxAttempts 1 turns retries
+// off.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithUserAgent names the calling service in the User-Agent header.
+func WithUserAgent(name string) Option {
+	return func(c *Client) {
+		c.userAgent = name + " " + c.userAgent
+	}
+}
+
+func withHeader(name string, value string) cashapi.ClientOption {
+	return cashapi.WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
+		req.Header.Set(name, value)
+		return nil
+	})
+}
+
+// New returns a client of the API served at baseURL, which ends with the
+// /cash/v1 prefix.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	c := &Client{
+		retry:     DefaultRetryPolicy,
+		newKey:    uuid.NewString,
+		userAgent: "cashclient/" + cashapi.SpecVersion,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+
+	api, err := cashapi.NewClient(baseURL, append(c.apiOpts, withHeader("User-Agent", c.userAgent))...)
+	if err != nil {
+		return nil, err
+	}
+	c.api = api
+
+	return c, nil
+}
+
+// do sends the request made by send until it succeeds, fails for good or the
+// attempts run out, and decodes a successful response into out.
+func (c *Client) do(ctx context.Context, send func() (*http.Response, error), out interface{}) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = c.attempt(send, out)
+		if err == nil || !retryable(err) || attempt >= c.retry.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		wait := c.backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) attempt(send func() (*http.Response, error), out interface{}) (time.Duration, error) {
+	resp, err := send()
+	if err != nil {
+		return 0, &NetworkError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, &NetworkError{Err: err}
+	}
+
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+
+	if resp.StatusCode != http.StatusOK {
+		return retryAfter, newError(resp.StatusCode, body)
+	}
+
+	if out == nil {
+		return 0, nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return 0, &Error{StatusCode: resp.StatusCode, Message: "malformed response: " + err.Error(), kind: ErrServer}
+	}
+
+	return 0, nil
+}
+
+// backoff is the full jitter wait after the given attempt.
+func (c *Client) backoff(attempt int) time.Duration {
+	max := c.retry.MinBackoff << uint(attempt-1)
+	if max <= 0 || max > c.retry.MaxBackoff {
+		max = c.retry.MaxBackoff
+	}
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// parseRetryAfter reads the delay in seconds form, the only one the API
+// sends.
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
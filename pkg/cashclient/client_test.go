@@ -0,0 +1,281 @@
+package cashclient_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"users_balance/internal/config"
+	"users_balance/internal/controllers"
+	er "users_balance/internal/errors"
+	"users_balance/internal/interfaces"
+	"users_balance/internal/middleware"
+	"users_balance/internal/models"
+	cashapi "users_balance/pkg/cashapi/v1"
+	"users_balance/pkg/cashclient"
+)
+
+const testAPIKey = "test-key"
+
+// memoryDB hands out connections that are never used, the repos below keep
+// their state in memory.
+type memoryDB struct {
+	interfaces.IDBHandler
+}
+
+func (db memoryDB) AcquireConn(context.Context) (*pgxpool.Conn, error) {
+	return &pgxpool.Conn{}, nil
+}
+
+type memoryIdempotencyRepo struct {
+	mu   sync.Mutex
+	keys map[string]models.IdempotencyKey
+}
+
+func (r *memoryIdempotencyRepo) Claim(conn *pgxpool.Conn, key models.IdempotencyKey, ttl time.Duration) (models.IdempotencyKey, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.keys[key.ClientID+"/"+key.Key]; ok {
+		return stored, false, nil
+	}
+	r.keys[key.ClientID+"/"+key.Key] = key
+
+	return key, true, nil
+}
+
+func (r *memoryIdempotencyRepo) Complete(conn *pgxpool.Conn, key models.IdempotencyKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key.Response = append([]byte(nil), key.Response...)
+	r.keys[key.ClientID+"/"+key.Key] = key
+	return nil
+}
+
+func (r *memoryIdempotencyRepo) Release(conn *pgxpool.Conn, clientID string, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.keys, clientID+"/"+key)
+	return nil
+}
+
+func (r *memoryIdempotencyRepo) DeleteExpired(conn *pgxpool.Conn, ttl time.Duration) (int64, error) {
+	return 0, nil
+}
+
+// memoryBalances applies updates to balances kept in memory.
+type memoryBalances struct {
+	interfaces.IUserBalanceService
+
+	mu       sync.Mutex
+	balances map[string]float64
+	applied  int
+}
+
+func (s *memoryBalances) UpdateAccount(req models.UserBalanceUpdate) (models.UserBalanceUpdateResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.balances[req.UserID]+req.Amount < 0 {
+		return models.UserBalanceUpdateResponse{}, er.ErrNegativeBalance
+	}
+	s.balances[req.UserID] += req.Amount
+	s.applied++
+
+	return models.UserBalanceUpdateResponse{
+		User: models.User{ID: req.UserID, Balance: s.balances[req.UserID], Currency: req.Currency},
+		Transaction: models.Transaction{
+			TrxID:       uuid.NewString(),
+			CreatedAt:   time.Now().UTC(),
+			Who:         req.Who,
+			Description: req.Description,
+			Amount:      req.Amount,
+			Currency:    req.Currency,
+			Operation:   "update",
+		},
+	}, nil
+}
+
+func (s *memoryBalances) appliedUpdates() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.applied
+}
+
+// newTestServer serves /cash/v1/balance/update with the real authentication,
+// idempotency middleware and controller.
+func newTestServer(t *testing.T) (*httptest.Server, *memoryBalances) {
+	gin.SetMode(gin.TestMode)
+	log := zap.NewNop().Sugar()
+
+	sum := sha256.Sum256([]byte(testAPIKey))
+	cfg := &config.Config{AuthData: config.AuthData{Clients: []config.APIClient{{
+		ID:      "test",
+		KeyHash: hex.EncodeToString(sum[:]),
+		Scopes:  []string{middleware.ScopeBalanceCredit, middleware.ScopeBalanceDebit},
+	}}}}
+	authenticator, err := middleware.NewAuthenticator(log, cfg, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idempotency := &middleware.Idempotency{
+		Log:             log,
+		DBHandler:       memoryDB{},
+		IdempotencyRepo: &memoryIdempotencyRepo{keys: map[string]models.IdempotencyKey{}},
+		TTL:             time.Hour,
+	}
+	balances := &memoryBalances{balances: map[string]float64{}}
+	controller := balance_controllers.UserBalanceController{
+		Log:                log,
+		UserBalanceService: balances,
+		Validator:          validator.New(),
+	}
+
+	router := gin.New()
+	router.POST("/cash/v1/balance/update", authenticator.Authenticate, idempotency.Handle, controller.UpdateAccount)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return server, balances
+}
+
+func newTestClient(t *testing.T, server *httptest.Server, doer cashapi.HttpRequestDoer) *cashclient.Client {
+	opts := []cashclient.Option{
+		cashclient.WithAPIKey(testAPIKey),
+		cashclient.WithRetryPolicy(cashclient.RetryPolicy{MaxAttempts: 3}),
+	}
+	if doer != nil {
+		opts = append(opts, cashclient.WithHTTPClient(doer))
+	}
+
+	client, err := cashclient.New(server.URL+"/cash/v1", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+// dropFirstResponse sends every request but loses the response of the first
+// one, like a timeout after the server applied it.
+type dropFirstResponse struct {
+	mu      sync.Mutex
+	dropped bool
+}
+
+func (d *dropFirstResponse) Do(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.dropped {
+		d.dropped = true
+		resp.Body.Close()
+		return nil, errors.New("connection reset")
+	}
+
+	return resp, nil
+}
+
+func TestSameKeySameBodyReplaysStoredResponse(t *testing.T) {
+	server, balances := newTestServer(t)
+	client := newTestClient(t, server, nil)
+	wallet := uuid.NewString()
+
+	update := cashclient.Update{UUID: wallet, Amount: 100, Description: "order 42", IdempotencyKey: "order-42"}
+	first, err := client.Credit(context.Background(), update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.Credit(context.Background(), update)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := balances.appliedUpdates(); n != 1 {
+		t.Fatalf("applied %d updates, want 1", n)
+	}
+	if second.Transaction.Id != first.Transaction.Id {
+		t.Errorf("replayed transaction %s, want %s", second.Transaction.Id, first.Transaction.Id)
+	}
+	if second.User.Balance != 100 {
+		t.Errorf("replayed balance %v, want 100", second.User.Balance)
+	}
+}
+
+func TestSameKeyDifferentBodyIsRejected(t *testing.T) {
+	server, balances := newTestServer(t)
+	client := newTestClient(t, server, nil)
+	wallet := uuid.NewString()
+
+	_, err := client.Credit(context.Background(), cashclient.Update{UUID: wallet, Amount: 100, IdempotencyKey: "order-42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Credit(context.Background(), cashclient.Update{UUID: wallet, Amount: 250, IdempotencyKey: "order-42"})
+
+	if !errors.Is(err, cashclient.ErrIdempotencyKeyReused) {
+		t.Fatalf("got %v, want ErrIdempotencyKeyReused", err)
+	}
+	var apiErr *cashclient.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("got %v, want a 422", err)
+	}
+	if n := balances.appliedUpdates(); n != 1 {
+		t.Errorf("applied %d updates, want 1", n)
+	}
+}
+
+func TestRetryAfterLostResponseIsAppliedOnce(t *testing.T) {
+	server, balances := newTestServer(t)
+	client := newTestClient(t, server, &dropFirstResponse{})
+	wallet := uuid.NewString()
+
+	result, err := client.Credit(context.Background(), cashclient.Update{UUID: wallet, Amount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := balances.appliedUpdates(); n != 1 {
+		t.Fatalf("applied %d updates, want 1", n)
+	}
+	if result.User.Balance != 100 {
+		t.Errorf("balance %v, want 100", result.User.Balance)
+	}
+}
+
+func TestInsufficientFundsIsMappedByStatus(t *testing.T) {
+	server, balances := newTestServer(t)
+	client := newTestClient(t, server, nil)
+
+	_, err := client.Debit(context.Background(), cashclient.Update{UUID: uuid.NewString(), Amount: 100})
+
+	if !errors.Is(err, cashclient.ErrInsufficientFunds) {
+		t.Fatalf("got %v, want ErrInsufficientFunds", err)
+	}
+	var apiErr *cashclient.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.Code != "insufficient_funds" {
+		t.Errorf("got %v, want a 422 with the insufficient_funds code", err)
+	}
+	if n := balances.appliedUpdates(); n != 0 {
+		t.Errorf("applied %d updates, want 0", n)
+	}
+}
@@ -0,0 +1,137 @@
+package cashclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Every *Error matches one of these with errors.Is, the *Error itself holds
+// the details.
+var (
+	ErrBadRequest            = errors.New("bad request")
+	ErrUnauthorized          = errors.New("unauthorized")
+	ErrForbidden             = errors.New("forbidden")
+	ErrNotFound              = errors.New("not found")
+	ErrInsufficientFunds     = errors.New("insufficient funds")
+	ErrLimitExceeded         = errors.New("spending limit exceeded")
+	ErrConflict              = errors.New("conflict")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was used for a different request")
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is in progress")
+	ErrRateLimited           = errors.New("rate limited")
+	ErrArchived              = errors.New("history has been archived")
+	ErrServer                = errors.New("server error")
+)
+
+// Error is an error answered by the API. Rule and Remaining are set for
+// ErrLimitExceeded, ArchivedBefore for ErrArchived.
+type Error struct {
+	StatusCode int
+	Message    string
+	// Code is the machine readable reason when the API gives one, e.g.
+	// limit_exceeded.
+	Code      string
+	Rule      string
+	Remaining *float64
+	// ArchivedBefore is when the history of the wallet is complete from.
+	ArchivedBefore *time.Time
+
+	kind error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("cash api: %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// NetworkError is a call that got no response, it may have been applied.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return "cash api: " + e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+type errorBody struct {
+	Message        string     `json:"message"`
+	Code           string     `json:"code"`
+	Rule           string     `json:"rule"`
+	Remaining      *float64   `json:"remaining"`
+	ArchivedBefore *time.Time `json:"archived_before"`
+}
+
+func newError(statusCode int, body []byte) *Error {
+	var parsed errorBody
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.Message == "" {
+		parsed.Message = http.StatusText(statusCode)
+	}
+
+	e := &Error{
+		StatusCode:     statusCode,
+		Message:        parsed.Message,
+		Code:           parsed.Code,
+		Rule:           parsed.Rule,
+		Remaining:      parsed.Remaining,
+		ArchivedBefore: parsed.ArchivedBefore,
+	}
+
+	switch {
+	case parsed.Code == "limit_exceeded":
+		e.kind = ErrLimitExceeded
+	case parsed.Code == "idempotency_key_reused":
+		e.kind = ErrIdempotencyKeyReused
+	case parsed.Code == "idempotency_in_progress":
+		e.kind = ErrIdempotencyInProgress
+	case parsed.Code == "archived", statusCode == http.StatusGone:
+		e.kind = ErrArchived
+	case statusCode == http.StatusUnprocessableEntity:
+		e.kind = ErrInsufficientFunds
+	case statusCode == http.StatusBadRequest, statusCode == http.StatusRequestEntityTooLarge:
+		e.kind = ErrBadRequest
+	case statusCode == http.StatusUnauthorized:
+		e.kind = ErrUnauthorized
+	case statusCode == http.StatusForbidden:
+		e.kind = ErrForbidden
+	case statusCode == http.StatusNotFound:
+		e.kind = ErrNotFound
+	case statusCode == http.StatusConflict:
+		e.kind = ErrConflict
+	case statusCode == http.StatusTooManyRequests:
+		e.kind = ErrRateLimited
+	default:
+		e.kind = ErrServer
+	}
+
+	return e
+}
+
+// retryable tells whether err can not have been applied, or is safe to send
+// again with the same Idempotency-Key.
+func retryable(err error) bool {
+	var netErr *NetworkError
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return apiErr.kind == ErrIdempotencyInProgress
+}
@@ -0,0 +1,136 @@
+package cashclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+	cashapi "users_balance/pkg/cashapi/v1"
+)
+
+const defaultPageSize = 100
+
+// TransactionsQuery selects the transactions of a wallet. PageSize is 10 to
+// 100, 100 when zero. Pages follow the order the transactions were made in,
+// SortBy, "date" (the default) or "amount", orders the transactions of each
+// page and Descending reverses it. TZ is the IANA zone created_at is given in,
+// UTC when empty.
+type TransactionsQuery struct {
+	UUID       string
+	PageSize   int64
+	SortBy     string
+	Descending bool
+	TZ         string
+}
+
+// TransactionIterator walks the transactions of a wallet a page at a time.
+//
+//	it := client.ListTransactions(cashclient.TransactionsQuery{UUID: wallet})
+//	for it.Next(ctx) {
+//		trx := it.Transaction()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Pages are read by offset, transactions made while iterating may shift them.
+type TransactionIterator struct {
+	client *Client
+	params cashapi.ListTransactionsParams
+
+	page []Transaction
+	pos  int
+	done bool
+	err  error
+
+	archivedBefore *time.Time
+}
+
+func (c *Client) ListTransactions(query TransactionsQuery) *TransactionIterator {
+	params := cashapi.ListTransactionsParams{
+		Uuid:  query.UUID,
+		Limit: query.PageSize,
+	}
+	if params.Limit == 0 {
+		params.Limit = defaultPageSize
+	}
+	if query.SortBy != "" {
+		sortBy := cashapi.ListTransactionsParamsSortBy(query.SortBy)
+		params.SortBy = &sortBy
+	}
+	cmp := cashapi.ListTransactionsParamsCmp("i")
+	if query.Descending {
+		cmp = "d"
+	}
+	params.Cmp = &cmp
+	if query.TZ != "" {
+		params.Tz = &query.TZ
+	}
+
+	return &TransactionIterator{client: c, params: params, pos: -1}
+}
+
+// Next moves to the next transaction, fetching the next page when needed. It
+// returns false at the end or on an error.
+func (it *TransactionIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.pos++
+	if it.pos < len(it.page) {
+		return true
+	}
+	if it.done {
+		return false
+	}
+
+	offset := int64(0)
+	if it.params.Offset != nil {
+		offset = *it.params.Offset + int64(len(it.page))
+	}
+	params := it.params
+	params.Offset = &offset
+
+	var resp cashapi.TransactionsListResponse
+	err := it.client.do(ctx, func() (*http.Response, error) {
+		return it.client.api.ListTransactions(ctx, &params)
+	}, &resp)
+	// a page past the last transaction is answered with 404
+	if errors.Is(err, ErrNotFound) && offset > 0 {
+		it.done = true
+		return false
+	}
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.params = params
+	it.archivedBefore = resp.ArchivedBefore
+	it.page = nil
+	if resp.Transactions != nil {
+		it.page = *resp.Transactions
+	}
+	it.pos = 0
+	it.done = int64(len(it.page)) < params.Limit
+
+	return len(it.page) > 0
+}
+
+// Transaction is the current transaction.
+func (it *TransactionIterator) Transaction() Transaction {
+	return it.page[it.pos]
+}
+
+// ArchivedBefore is set once a page was read when the transactions made before
+// it were archived, the iteration starts at the oldest one left.
+func (it *TransactionIterator) ArchivedBefore() *time.Time {
+	return it.archivedBefore
+}
+
+// Err is the error that stopped the iteration.
+func (it *TransactionIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,289 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package cashpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// CashServiceClient is the client API for CashService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CashServiceClient interface {
+	// GetBalance needs balance:read. With at, it returns the balance the user
+	// had at that moment.
+	GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*Balance, error)
+	// UpdateAccount needs balance:credit for positive amounts and balance:debit
+	// for negative ones.
+	UpdateAccount(ctx context.Context, in *UpdateAccountRequest, opts ...grpc.CallOption) (*UpdateAccountResponse, error)
+	// Transfer needs the transfer scope.
+	Transfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*TransferResponse, error)
+	// ListTransactions needs balance:read.
+	ListTransactions(ctx context.Context, in *ListTransactionsRequest, opts ...grpc.CallOption) (*ListTransactionsResponse, error)
+	// WatchBalance needs balance:read. It sends the current balance, then the
+	// new balance every time it changes, until the call is cancelled.
+	WatchBalance(ctx context.Context, in *WatchBalanceRequest, opts ...grpc.CallOption) (CashService_WatchBalanceClient, error)
+}
+
+type cashServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCashServiceClient(cc grpc.ClientConnInterface) CashServiceClient {
+	return &cashServiceClient{cc}
+}
+
+func (c *cashServiceClient) GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*Balance, error) {
+	out := new(Balance)
+	err := c.cc.Invoke(ctx, "/cash.v1.CashService/GetBalance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cashServiceClient) UpdateAccount(ctx context.Context, in *UpdateAccountRequest, opts ...grpc.CallOption) (*UpdateAccountResponse, error) {
+	out := new(UpdateAccountResponse)
+	err := c.cc.Invoke(ctx, "/cash.v1.CashService/UpdateAccount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cashServiceClient) Transfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*TransferResponse, error) {
+	out := new(TransferResponse)
+	err := c.cc.Invoke(ctx, "/cash.v1.CashService/Transfer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cashServiceClient) ListTransactions(ctx context.Context, in *ListTransactionsRequest, opts ...grpc.CallOption) (*ListTransactionsResponse, error) {
+	out := new(ListTransactionsResponse)
+	err := c.cc.Invoke(ctx, "/cash.v1.CashService/ListTransactions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cashServiceClient) WatchBalance(ctx context.Context, in *WatchBalanceRequest, opts ...grpc.CallOption) (CashService_WatchBalanceClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CashService_ServiceDesc.Streams[0], "/cash.v1.CashService/WatchBalance", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cashServiceWatchBalanceClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CashService_WatchBalanceClient interface {
+	Recv() (*Balance, error)
+	grpc.ClientStream
+}
+
+type cashServiceWatchBalanceClient struct {
+	grpc.ClientStream
+}
+
+func (x *cashServiceWatchBalanceClient) Recv() (*Balance, error) {
+	m := new(Balance)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CashServiceServer is the server API for CashService service.
+// All implementations must embed UnimplementedCashServiceServer
+// for forward compatibility
+type CashServiceServer interface {
+	// GetBalance needs balance:read. With at, it returns the balance the user
+	// had at that moment.
+	GetBalance(context.Context, *GetBalanceRequest) (*Balance, error)
+	// UpdateAccount needs balance:credit for positive amounts and balance:debit
+	// for negative ones.
+	UpdateAccount(context.Context, *UpdateAccountRequest) (*UpdateAccountResponse, error)
+	// Transfer needs the transfer scope.
+	Transfer(context.Context, *TransferRequest) (*TransferResponse, error)
+	// ListTransactions needs balance:read.
+	ListTransactions(context.Context, *ListTransactionsRequest) (*ListTransactionsResponse, error)
+	// WatchBalance needs balance:read. It sends the current balance, then the
+	// new balance every time it changes, until the call is cancelled.
+	WatchBalance(*WatchBalanceRequest, CashService_WatchBalanceServer) error
+	mustEmbedUnimplementedCashServiceServer()
+}
+
+// UnimplementedCashServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCashServiceServer struct {
+}
+
+func (UnimplementedCashServiceServer) GetBalance(context.Context, *GetBalanceRequest) (*Balance, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedCashServiceServer) UpdateAccount(context.Context, *UpdateAccountRequest) (*UpdateAccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateAccount not implemented")
+}
+func (UnimplementedCashServiceServer) Transfer(context.Context, *TransferRequest) (*TransferResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Transfer not implemented")
+}
+func (UnimplementedCashServiceServer) ListTransactions(context.Context, *ListTransactionsRequest) (*ListTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTransactions not implemented")
+}
+func (UnimplementedCashServiceServer) WatchBalance(*WatchBalanceRequest, CashService_WatchBalanceServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchBalance not implemented")
+}
+func (UnimplementedCashServiceServer) mustEmbedUnimplementedCashServiceServer() {}
+
+// UnsafeCashServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CashServiceServer will
+// result in compilation errors.
+type UnsafeCashServiceServer interface {
+	mustEmbedUnimplementedCashServiceServer()
+}
+
+func RegisterCashServiceServer(s grpc.ServiceRegistrar, srv CashServiceServer) {
+	s.RegisterService(&CashService_ServiceDesc, srv)
+}
+
+func _CashService_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CashServiceServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.v1.CashService/GetBalance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CashServiceServer).GetBalance(ctx, req.(*GetBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CashService_UpdateAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CashServiceServer).UpdateAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.v1.CashService/UpdateAccount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CashServiceServer).UpdateAccount(ctx, req.(*UpdateAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CashService_Transfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CashServiceServer).Transfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.v1.CashService/Transfer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CashServiceServer).Transfer(ctx, req.(*TransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CashService_ListTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CashServiceServer).ListTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.v1.CashService/ListTransactions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CashServiceServer).ListTransactions(ctx, req.(*ListTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CashService_WatchBalance_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchBalanceRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CashServiceServer).WatchBalance(m, &cashServiceWatchBalanceServer{stream})
+}
+
+type CashService_WatchBalanceServer interface {
+	Send(*Balance) error
+	grpc.ServerStream
+}
+
+type cashServiceWatchBalanceServer struct {
+	grpc.ServerStream
+}
+
+func (x *cashServiceWatchBalanceServer) Send(m *Balance) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// CashService_ServiceDesc is the grpc.ServiceDesc for CashService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CashService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cash.v1.CashService",
+	HandlerType: (*CashServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetBalance",
+			Handler:    _CashService_GetBalance_Handler,
+		},
+		{
+			MethodName: "UpdateAccount",
+			Handler:    _CashService_UpdateAccount_Handler,
+		},
+		{
+			MethodName: "Transfer",
+			Handler:    _CashService_Transfer_Handler,
+		},
+		{
+			MethodName: "ListTransactions",
+			Handler:    _CashService_ListTransactions_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchBalance",
+			Handler:       _CashService_WatchBalance_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "cash/v1/cash.proto",
+}